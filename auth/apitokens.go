@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"files-back/dbase/dbapitokens"
+	"files-back/handlers"
+	"files-back/handlers/incoming"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiTokenPrefix = "pat_"
+
+var (
+	LookupAPIToken                        = lookupAPIToken
+	APITokens      dbapitokens.Repository = dbapitokens.SQLRepository{}
+)
+
+var (
+	BadScope      = errors.New("unknown or not granted scope")
+	BadTokenOwner = errors.New("only full admins may issue service account tokens")
+)
+
+func lookupAPIToken(ctx context.Context, tokenStr string) (*Principal, error) {
+	stored, err := APITokens.QueryByHash(ctx, hashToken(tokenStr))
+	if err != nil {
+		return nil, err
+	}
+	var principal *Principal
+	switch {
+	case stored.ServiceAccount != nil:
+		principal, err = LookupServiceAccount(ctx, *stored.ServiceAccount)
+	case stored.Owner != nil:
+		principal, err = LookupPrincipal(ctx, *stored.Owner)
+	default:
+		return nil, BadToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !principal.active() {
+		return nil, Inactive
+	}
+	principal.Scopes = strings.Fields(stored.Scopes)
+	return principal, nil
+}
+
+func CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	principal := principalFrom(r)
+	if denyImpersonated(w, principal) {
+		return
+	}
+	var n incoming.APIToken
+	if err := incoming.Extract(r, &n); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	for _, scope := range n.Scopes {
+		if !ValidScope(scope) || !principal.HasScope(scope) {
+			handlers.StatusBadData(fmt.Errorf("%w: %s", BadScope, scope), w)
+			return
+		}
+	}
+	tokenStr := apiTokenPrefix + randomToken()
+	token := dbapitokens.DBStruct{
+		Name:      n.Name,
+		TokenHash: hashToken(tokenStr),
+		Scopes:    strings.Join(n.Scopes, " "),
+	}
+	if n.ServiceAccount != nil {
+		if principal.Type != RoleFullAdmin || principal.ServiceAccount {
+			handlers.StatusForbidden(BadTokenOwner, w)
+			return
+		}
+		token.ServiceAccount = n.ServiceAccount
+	} else {
+		token.Owner = &principal.Username
+	}
+	if n.ExpiresAt != nil {
+		expiresAt, err := time.Parse("2006-01-02", *n.ExpiresAt)
+		if err != nil {
+			handlers.StatusBadData(err, w)
+			return
+		}
+		token.ExpiresAt = &expiresAt
+	}
+	if err := APITokens.Insert(r.Context(), &token); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, dbapitokens.JSONStruct{
+		ID:             token.ID,
+		Name:           token.Name,
+		Token:          tokenStr,
+		Owner:          token.Owner,
+		ServiceAccount: token.ServiceAccount,
+		Scopes:         n.Scopes,
+		CreatedAt:      token.CreatedAt,
+		ExpiresAt:      token.ExpiresAt,
+	})
+}
+
+func ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := APITokens.Query(r.Context(), tokenFilter(r))
+	if err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	handlers.ResponseJSON(w, tokens)
+}
+
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["tokenID"], 10, 64)
+	if err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	filter := tokenFilter(r)
+	filter.ID = &id
+	if err := APITokens.Revoke(r.Context(), filter); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.StatusDeleted(w)
+}
+
+func tokenFilter(r *http.Request) dbapitokens.Filter {
+	principal := principalFrom(r)
+	if principal.Type == RoleFullAdmin && !principal.ServiceAccount {
+		var filter dbapitokens.Filter
+		if account := r.URL.Query().Get("serviceAccount"); account != "" {
+			filter.ServiceAccount = &account
+		}
+		return filter
+	}
+	if principal.ServiceAccount {
+		return dbapitokens.Filter{ServiceAccount: &principal.Username}
+	}
+	return dbapitokens.Filter{Owner: &principal.Username}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"files-back/dbase/dbapitokens"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeAPITokens struct {
+	mu      sync.Mutex
+	tokens  []*dbapitokens.DBStruct
+	revoked map[int64]bool
+}
+
+func (f *fakeAPITokens) Query(ctx context.Context, filter dbapitokens.Filter) ([]*dbapitokens.JSONStruct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []*dbapitokens.JSONStruct
+	for _, token := range f.tokens {
+		if f.revoked[token.ID] || !f.matches(token, filter) {
+			continue
+		}
+		res = append(res, &dbapitokens.JSONStruct{ID: token.ID, Name: token.Name, Owner: token.Owner, ServiceAccount: token.ServiceAccount})
+	}
+	return res, nil
+}
+
+func (f *fakeAPITokens) QueryByHash(ctx context.Context, tokenHash string) (*dbapitokens.DBStruct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.TokenHash == tokenHash && !f.revoked[token.ID] && (token.ExpiresAt == nil || token.ExpiresAt.After(time.Now())) {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeAPITokens) Insert(ctx context.Context, token *dbapitokens.DBStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token.ID = int64(len(f.tokens) + 1)
+	copied := *token
+	f.tokens = append(f.tokens, &copied)
+	return nil
+}
+
+func (f *fakeAPITokens) Revoke(ctx context.Context, filter dbapitokens.Filter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if filter.ID != nil && token.ID == *filter.ID && !f.revoked[token.ID] && f.matches(token, filter) {
+			f.revoked[token.ID] = true
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (f *fakeAPITokens) matches(token *dbapitokens.DBStruct, filter dbapitokens.Filter) bool {
+	return (filter.Owner == nil || (token.Owner != nil && *token.Owner == *filter.Owner)) &&
+		(filter.ServiceAccount == nil || (token.ServiceAccount != nil && *token.ServiceAccount == *filter.ServiceAccount))
+}
+
+func withAPITokens(t *testing.T, accounts map[string]*Principal) *fakeAPITokens {
+	tokens, lookup := APITokens, LookupServiceAccount
+	fake := &fakeAPITokens{revoked: map[int64]bool{}}
+	APITokens = fake
+	LookupServiceAccount = func(ctx context.Context, name string) (*Principal, error) {
+		if p, ok := accounts[name]; ok {
+			copied := *p
+			return &copied, nil
+		}
+		return nil, sql.ErrNoRows
+	}
+	t.Cleanup(func() {
+		APITokens, LookupServiceAccount = tokens, lookup
+	})
+	return fake
+}
+
+func tokenRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Handle("/tokens", Authenticated(http.HandlerFunc(ListAPITokens))).Methods(http.MethodGet)
+	router.Handle("/tokens", Authenticated(http.HandlerFunc(CreateAPIToken))).Methods(http.MethodPost)
+	router.Handle("/tokens/{tokenID}", Authenticated(http.HandlerFunc(RevokeAPIToken))).Methods(http.MethodDelete)
+	return router
+}
+
+func withBearer(token, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	tokenRouter().ServeHTTP(w, r)
+	return w
+}
+
+func bodyCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	var status struct{ Code int }
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status.Code
+}
+
+func issueAPIToken(t *testing.T, fake *fakeAPITokens, owner, account *string, scopes string) string {
+	t.Helper()
+	tokenStr := apiTokenPrefix + randomToken()
+	err := fake.Insert(context.Background(), &dbapitokens.DBStruct{
+		Name:           "test",
+		TokenHash:      hashToken(tokenStr),
+		Owner:          owner,
+		ServiceAccount: account,
+		Scopes:         scopes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func TestAPITokenInactiveOwner(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com":     {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+		"disabled@d1.com": {Username: "disabled@d1.com", Type: typeDisabled, Domain: "d1", Tenant: "t1"},
+		"deleted@d1.com":  {Username: "deleted@d1.com", Type: typeDeleted, Domain: "d1", Tenant: "t1"},
+	})
+	fake := withAPITokens(t, nil)
+	for _, owner := range []string{"disabled@d1.com", "deleted@d1.com"} {
+		owner := owner
+		token := issueAPIToken(t, fake, &owner, nil, "")
+		if _, err := LookupAPIToken(context.Background(), token); !errors.Is(err, Inactive) {
+			t.Errorf("%s: err = %v, want Inactive", owner, err)
+		}
+		if code := bodyCode(t, withBearer(token, http.MethodPost, "/tokens", `{"name":"more"}`)); code != http.StatusUnauthorized {
+			t.Errorf("%s minting a token: code = %d, want 401", owner, code)
+		}
+	}
+	owner := "user@d1.com"
+	principal, err := LookupAPIToken(context.Background(), issueAPIToken(t, fake, &owner, nil, ""))
+	if err != nil || principal.Username != owner {
+		t.Errorf("active owner = %+v, %v", principal, err)
+	}
+}
+
+func TestAPITokenRevoked(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com": {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+	})
+	fake := withAPITokens(t, nil)
+	owner := "user@d1.com"
+	token := issueAPIToken(t, fake, &owner, nil, "tokens:read")
+	other := issueAPIToken(t, fake, &owner, nil, "tokens:write")
+	if w := withBearer(token, http.MethodGet, "/tokens", ""); w.Code != http.StatusOK {
+		t.Fatalf("list: status = %d", w.Code)
+	}
+	if code := bodyCode(t, withBearer(other, http.MethodDelete, "/tokens/1", "")); code != http.StatusOK {
+		t.Fatalf("revoke: code = %d", code)
+	}
+	if _, err := LookupAPIToken(context.Background(), token); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("revoked token: err = %v, want ErrNoRows", err)
+	}
+	if code := bodyCode(t, withBearer(token, http.MethodGet, "/tokens", "")); code != http.StatusUnauthorized {
+		t.Errorf("request with revoked token: code = %d, want 401", code)
+	}
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com": {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+	})
+	fake := withAPITokens(t, nil)
+	owner := "user@d1.com"
+	token := issueAPIToken(t, fake, &owner, nil, "tokens:read")
+	if w := withBearer(token, http.MethodGet, "/tokens", ""); w.Code != http.StatusOK {
+		t.Errorf("read with read scope: status = %d", w.Code)
+	}
+	if w := withBearer(token, http.MethodPost, "/tokens", `{"name":"more"}`); w.Code != http.StatusForbidden {
+		t.Errorf("write with read scope: status = %d, want 403", w.Code)
+	}
+	if w := withBearer(token, http.MethodDelete, "/tokens/"+strconv.Itoa(1), ""); w.Code != http.StatusForbidden {
+		t.Errorf("revoke with read scope: status = %d, want 403", w.Code)
+	}
+	writer := issueAPIToken(t, fake, &owner, nil, "tokens:read tokens:write")
+	body := `{"name":"wider","scopes":["users:read"]}`
+	if code := bodyCode(t, withBearer(writer, http.MethodPost, "/tokens", body)); code != http.StatusBadRequest {
+		t.Errorf("minting a wider scope: code = %d, want 400", code)
+	}
+}
+
+func TestAPITokenServiceAccount(t *testing.T) {
+	withTokens(t, nil)
+	fake := withAPITokens(t, map[string]*Principal{
+		"backup":  {Username: "backup", Type: RoleRegular, Domain: "d1", Tenant: "t1", ServiceAccount: true},
+		"retired": {Username: "retired", Type: typeDisabled, Domain: "d1", Tenant: "t1", ServiceAccount: true},
+	})
+	account := "backup"
+	principal, err := LookupAPIToken(context.Background(), issueAPIToken(t, fake, nil, &account, "users:read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.ServiceAccount || principal.Username != "backup" || !principal.HasScope("users:read") || principal.HasScope("users:write") {
+		t.Errorf("service account principal = %+v", principal)
+	}
+	retired := "retired"
+	if _, err := LookupAPIToken(context.Background(), issueAPIToken(t, fake, nil, &retired, "")); !errors.Is(err, Inactive) {
+		t.Errorf("disabled service account: err = %v, want Inactive", err)
+	}
+	missing := "missing"
+	if _, err := LookupAPIToken(context.Background(), issueAPIToken(t, fake, nil, &missing, "")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing service account: err = %v, want ErrNoRows", err)
+	}
+	if _, err := LookupAPIToken(context.Background(), issueAPIToken(t, fake, nil, nil, "")); !errors.Is(err, BadToken) {
+		t.Errorf("ownerless token: err = %v, want BadToken", err)
+	}
+}
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"files-back/auth/directory"
 	"files-back/handlers"
 	"github.com/dgrijalva/jwt-go"
 	"log"
@@ -12,14 +14,18 @@ import (
 )
 
 var (
-	SecretKey  []byte
-	TokenTTL   = time.Hour * 24
-	userCtxKey = contextKey("username")
+	SecretKey       []byte
+	TokenTTL        = time.Minute * 15
+	RefreshTokenTTL = time.Hour * 24 * 30
+	userCtxKey      = contextKey("principal")
 )
 
 var (
 	Unauthorized = errors.New("unauthorized users")
 	BadToken     = errors.New("bad token")
+	Forbidden    = errors.New("access denied")
+	Revoked      = errors.New("token revoked")
+	Inactive     = errors.New("account is disabled or deleted")
 )
 
 type contextKey string
@@ -27,59 +33,210 @@ type contextKey string
 type incomingJSON struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Domain   string `json:"domain"`
 }
 
 type Token struct {
-	Token   string `json:"token"`
-	Expires string `json:"expires"`
+	Token        string `json:"token"`
+	Expires      string `json:"expires"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	Name         string `json:"name,omitempty"`
 }
 
 func Middleware(next http.Handler) http.Handler {
+	return authenticate(next, Allowed)
+}
+
+func Authenticated(next http.Handler) http.Handler {
+	return authenticate(next, scopeAllowed)
+}
+
+func authenticate(next http.Handler, allowed func(*Principal, *http.Request) bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := strings.Split(r.Header.Get("Authorization"), " ")
-		if len(authHeader) != 2 {
-			handlers.StatusUnauthorized(Unauthorized, w)
-			return
-		}
-		username, err := ParseToken(authHeader[1])
+		principal, err := requestPrincipal(r)
 		if err != nil {
 			handlers.StatusUnauthorized(err, w)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userCtxKey, &username)
-
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
+		if principal.Impersonator != "" {
+			recorder, err := startImpersonated(w, r, principal)
+			if err != nil {
+				handlers.ReturnError(w, err)
+				return
+			}
+			defer recorder.finish()
+			w = recorder
+		}
+		if !allowed(principal, r) {
+			handlers.StatusForbidden(Forbidden, w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
 	})
 }
 
-func GenerateToken(username string) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = username
-	claims["exp"] = time.Now().Add(TokenTTL).Unix()
-	tokenString, err := token.SignedString(SecretKey)
+func requestPrincipal(r *http.Request) (*Principal, error) {
+	if tokenStr, ok := bearerToken(r); ok {
+		return resolvePrincipal(r.Context(), tokenStr)
+	}
+	if certificate := clientCertificate(r); certificate != nil {
+		return LookupCertificate(r.Context(), certificate)
+	}
+	return nil, Unauthorized
+}
+
+func resolvePrincipal(ctx context.Context, tokenStr string) (*Principal, error) {
+	if strings.HasPrefix(tokenStr, apiTokenPrefix) {
+		return LookupAPIToken(ctx, tokenStr)
+	}
+	claims, err := parseAccessToken(ctx, tokenStr)
 	if err != nil {
-		log.Fatal("Error in Generating key")
+		return nil, err
+	}
+	username, role := claimString(claims, "username"), claimRole(claims)
+	principal, err := LookupPrincipal(ctx, username)
+	switch {
+	case err == nil:
+		if !principal.active() {
+			return nil, Inactive
+		}
+	case role != nil && errors.Is(err, sql.ErrNoRows):
+		principal = &Principal{Username: username, Type: role.Type, Domain: role.Domain, Tenant: role.Tenant}
+	default:
+		return nil, err
+	}
+	if impersonator := claimString(claims, "impersonator"); impersonator != "" {
+		principal.Impersonator, principal.SessionID = impersonator, claimString(claims, "jti")
+	}
+	return principal, nil
+}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, userCtxKey, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(userCtxKey).(*Principal)
+	return principal, ok
+}
+
+func principalFrom(r *http.Request) *Principal {
+	principal, _ := PrincipalFromContext(r.Context())
+	return principal
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(authHeader) != 2 {
+		return "", false
+	}
+	return authHeader[1], true
+}
+
+func GenerateToken(username, familyID string, role *directory.Role) (string, time.Time, error) {
+	expires := time.Now().Add(TokenTTL)
+	claims := jwt.MapClaims{
+		"username": username,
+		"jti":      randomID(),
+		"fam":      familyID,
+		"exp":      expires.Unix(),
+	}
+	setRoleClaims(claims, role)
+	tokenString, err := signClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expires, nil
+}
+
+func signClaims(claims jwt.MapClaims) (string, error) {
+	var token *jwt.Token
+	var signKey interface{} = SecretKey
+	if key := activeKey(); key != nil {
+		token = jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		signKey = key.Private
+	} else {
+		token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	}
+	tokenString, err := token.SignedString(signKey)
+	if err != nil {
+		log.Println("Error in Generating key")
 		return "", err
 	}
 	return tokenString, nil
 }
 
-func ParseToken(tokenStr string) (string, error) {
-	token, err := jwt.Parse(
-		tokenStr,
-		func(token *jwt.Token) (interface{}, error) {
-			return SecretKey, nil
-		},
-	)
+func ParseToken(ctx context.Context, tokenStr string) (string, error) {
+	claims, err := parseAccessToken(ctx, tokenStr)
+	if err != nil {
+		return "", err
+	}
+	return claimString(claims, "username"), nil
+}
+
+func parseAccessToken(ctx context.Context, tokenStr string) (jwt.MapClaims, error) {
+	claims, err := parseClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claimString(claims, "purpose") != "" {
+		return nil, BadToken
+	}
+	for _, id := range []string{claimString(claims, "jti"), claimString(claims, "fam")} {
+		if id == "" {
+			continue
+		}
+		revoked, err := revocations.revoked(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, Revoked
+		}
+	}
+	return claims, nil
+}
+
+func parseClaims(tokenStr string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenStr, verificationKey)
 	if token == nil {
-		return "", BadToken
+		return nil, BadToken
 	}
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		username := claims["username"].(string)
-		return username, nil
+		return claims, nil
 	} else {
-		return "", err
+		return nil, err
+	}
+}
+
+func claimString(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func setRoleClaims(claims jwt.MapClaims, role *directory.Role) {
+	if role == nil {
+		return
+	}
+	claims["role"] = role.Type
+	claims["role_domain"] = role.Domain
+	claims["role_tenant"] = role.Tenant
+}
+
+func claimRole(claims jwt.MapClaims) *directory.Role {
+	roleType := claimString(claims, "role")
+	if roleType == "" {
+		return nil
+	}
+	return &directory.Role{
+		Type:   roleType,
+		Domain: claimString(claims, "role_domain"),
+		Tenant: claimString(claims, "role_tenant"),
 	}
 }
+
+func claimTime(claims jwt.MapClaims, name string) time.Time {
+	value, _ := claims[name].(float64)
+	return time.Unix(int64(value), 0)
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"files-back/auth/directory"
+	"testing"
+)
+
+func withTokens(t *testing.T, users map[string]*Principal) {
+	secret, isRevoked, lookup := SecretKey, IsRevoked, LookupPrincipal
+	SecretKey = []byte("test-secret")
+	IsRevoked = func(ctx context.Context, id string) (bool, error) {
+		return false, nil
+	}
+	LookupPrincipal = func(ctx context.Context, username string) (*Principal, error) {
+		if p, ok := users[username]; ok {
+			copied := *p
+			return &copied, nil
+		}
+		return nil, sql.ErrNoRows
+	}
+	t.Cleanup(func() {
+		SecretKey, IsRevoked, LookupPrincipal = secret, isRevoked, lookup
+	})
+}
+
+func TestResolvePrincipalDatabaseRole(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com":     {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+		"disabled@d1.com": {Username: "disabled@d1.com", Type: typeDisabled, Domain: "d1", Tenant: "t1"},
+		"deleted@d1.com":  {Username: "deleted@d1.com", Type: typeDeleted, Domain: "d1", Tenant: "t1"},
+	})
+	admin := &directory.Role{Type: RoleFullAdmin}
+	tests := []struct {
+		username string
+		role     *directory.Role
+		want     string
+		err      error
+	}{
+		{"user@d1.com", nil, RoleRegular, nil},
+		{"user@d1.com", admin, RoleRegular, nil},
+		{"disabled@d1.com", nil, "", Inactive},
+		{"disabled@d1.com", admin, "", Inactive},
+		{"deleted@d1.com", admin, "", Inactive},
+		{"directory@d1.com", admin, RoleFullAdmin, nil},
+		{"nobody@d1.com", nil, "", sql.ErrNoRows},
+	}
+	for _, test := range tests {
+		token, _, err := GenerateToken(test.username, "", test.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		principal, err := resolvePrincipal(context.Background(), token)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v, want %v", test.username, err, test.err)
+			continue
+		}
+		if err == nil && principal.Type != test.want {
+			t.Errorf("%s: type = %q, want %q", test.username, principal.Type, test.want)
+		}
+	}
+}
+
+func TestRefreshIdentityRereadsRole(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com":     {Username: "user@d1.com", Type: RoleTenantAdmin, Domain: "d1", Tenant: "t1"},
+		"disabled@d1.com": {Username: "disabled@d1.com", Type: typeDisabled, Domain: "d1", Tenant: "t1"},
+	})
+	identity, err := refreshIdentity(context.Background(), "user@d1.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role == nil || *identity.Role != (directory.Role{Type: RoleTenantAdmin, Domain: "d1", Tenant: "t1"}) {
+		t.Errorf("role = %+v", identity.Role)
+	}
+	if _, err := refreshIdentity(context.Background(), "disabled@d1.com"); !errors.Is(err, Inactive) {
+		t.Errorf("disabled: err = %v, want Inactive", err)
+	}
+	if _, err := refreshIdentity(context.Background(), "directory@d1.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown: err = %v, want ErrNoRows", err)
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"files-back/auth/directory"
+	"files-back/dbase/dbdomains"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"net/http"
+	"strings"
+)
+
+var (
+	BadLogin           = errors.New("bad login request")
+	InvalidCredentials = errors.New("invalid credentials")
+	NoBindCredentials  = errors.New("domain directory has no bind credentials")
+)
+
+var (
+	PasswordBackend     Authenticator = LDAPAuthenticator{}
+	DomainDirectory                   = lookupDomainDirectory
+	DomainDirectoryRows               = dbdomains.QueryDirectory
+)
+
+type Authenticator interface {
+	Name() string
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+type Identity struct {
+	Username    string
+	DisplayName string
+	Method      string
+	Role        *directory.Role
+}
+
+type LDAPAuthenticator struct{}
+
+func (LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a LDAPAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	var incomeAuth incomingJSON
+	err := json.NewDecoder(r.Body).Decode(&incomeAuth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", BadLogin, err)
+	}
+	pool, err := DomainDirectory(r.Context(), incomeAuth.Domain, incomeAuth.Username)
+	if err != nil {
+		return nil, err
+	}
+	user, err := pool.CheckAuth(incomeAuth.Username, incomeAuth.Password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, fmt.Errorf("%w: %v", InvalidCredentials, err)
+		}
+		return nil, err
+	}
+	if pool.Config.Domain != "" {
+		principal, err := LookupPrincipal(r.Context(), user.Email)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%w: %v", InvalidCredentials, err)
+			}
+			return nil, err
+		}
+		if principal.Domain != pool.Config.Domain {
+			return nil, fmt.Errorf("%w: %s is not a user of domain %s", InvalidCredentials, user.Email, pool.Config.Domain)
+		}
+	}
+	return &Identity{
+		Username:    user.Email,
+		DisplayName: user.DisplayName,
+		Method:      a.Name(),
+		Role:        user.Role,
+	}, nil
+}
+
+func lookupDomainDirectory(ctx context.Context, domainName, username string) (*directory.Pool, error) {
+	var mailDomain string
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		mailDomain = strings.ToLower(username[i+1:])
+	}
+	domain, err := DomainDirectoryRows(ctx, domainName, mailDomain)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return directory.DefaultPool()
+	case err != nil:
+		return nil, err
+	}
+	if domain.BindUsername == nil || *domain.BindUsername == "" || domain.BindPassword == nil || *domain.BindPassword == "" {
+		return nil, fmt.Errorf("%w: %s", NoBindCredentials, domain.Name)
+	}
+	config := directory.Config{
+		Domain:              domain.Name,
+		Servers:             directory.ParseServers(*domain.Server),
+		BindDN:              *domain.BindUsername,
+		BindPassword:        *domain.BindPassword,
+		ConnectTimeout:      directory.ConnectTimeout,
+		OperationTimeout:    directory.OperationTimeout,
+		PoolSize:            directory.PoolSize,
+		HealthCheckInterval: directory.HealthCheckInterval,
+		UserFilter:          directory.UserFilter,
+		ObjectClasses:       directory.ObjectClasses,
+		MailAttribute:       directory.MailAttribute,
+		NameAttribute:       directory.NameAttribute,
+		GroupAttribute:      directory.GroupAttribute,
+		DisabledAttribute:   directory.DisabledAttribute,
+	}
+	if domain.BaseDN != nil {
+		config.BaseDN = *domain.BaseDN
+	}
+	if domain.UserFilter != nil && *domain.UserFilter != "" {
+		config.UserFilter = *domain.UserFilter
+	}
+	return directory.PoolFor(domain.Name, config)
+}
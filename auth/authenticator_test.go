@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"files-back/auth/directory"
+	"files-back/auth/directory/ldaptest"
+	"files-back/dbase/dbdomains"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withDomainDirectory(t *testing.T, domain string) *ldaptest.Server {
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+	server.Add("dc=d2,dc=com", map[string][]string{"objectClass": {"domain"}})
+	server.Add("cn=admin,dc=d2,dc=com", map[string][]string{"cn": {"admin"}, "userPassword": {"secret"}})
+	for _, email := range []string{"user@d1.com", "user@d2.com"} {
+		server.Add("uid="+email+",dc=d2,dc=com", map[string][]string{
+			"objectClass":  {"inetOrgPerson"},
+			"mail":         {email},
+			"memberOf":     {"cn=admins,dc=d2,dc=com"},
+			"userPassword": {"secret"},
+		})
+	}
+	config := directory.Config{
+		Domain:        domain,
+		Servers:       []string{server.URL},
+		BindDN:        "cn=admin,dc=d2,dc=com",
+		BindPassword:  "secret",
+		BaseDN:        "dc=d2,dc=com",
+		ObjectClasses: []string{"inetOrgPerson"},
+		MailAttribute: "mail",
+	}
+	pool, err := directory.NewPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	lookup := DomainDirectory
+	DomainDirectory = func(ctx context.Context, domainName, username string) (*directory.Pool, error) {
+		return pool, nil
+	}
+	t.Cleanup(func() {
+		DomainDirectory = lookup
+	})
+	return server
+}
+
+func ldapLogin(username string) (*Identity, error) {
+	body := `{"username":"` + username + `","password":"secret","domain":"d2"}`
+	return LDAPAuthenticator{}.Authenticate(httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+}
+
+func TestDomainDirectoryRejectsOtherDomains(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com": {Username: "user@d1.com", Type: RoleFullAdmin, Domain: "d1", Tenant: "t1"},
+		"user@d2.com": {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+	})
+	withDomainDirectory(t, "d2")
+	if _, err := ldapLogin("user@d1.com"); !errors.Is(err, InvalidCredentials) {
+		t.Errorf("foreign domain user: err = %v, want InvalidCredentials", err)
+	}
+	if _, err := ldapLogin("nobody@d2.com"); !errors.Is(err, InvalidCredentials) {
+		t.Errorf("unknown user: err = %v, want InvalidCredentials", err)
+	}
+	identity, err := ldapLogin("user@d2.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "user@d2.com" {
+		t.Errorf("username = %q", identity.Username)
+	}
+}
+
+func TestDomainDirectoryIgnoresGlobalRoles(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d2.com": {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+	})
+	rules := directory.RoleRules
+	defer func() {
+		directory.RoleRules = rules
+	}()
+	var err error
+	directory.RoleRules, err = directory.ParseRoleRules("^cn=admins, => full_Admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withDomainDirectory(t, "d2")
+	identity, err := ldapLogin("user@d2.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != nil {
+		t.Errorf("per-domain directory granted %+v", identity.Role)
+	}
+}
+
+func withDirectoryRows(t *testing.T, rows map[string]*dbdomains.DBStruct) {
+	lookup := DomainDirectoryRows
+	DomainDirectoryRows = func(ctx context.Context, domainName, mailDomain string) (*dbdomains.DBStruct, error) {
+		if row, ok := rows[domainName]; ok {
+			return row, nil
+		}
+		return nil, sql.ErrNoRows
+	}
+	t.Cleanup(func() {
+		DomainDirectoryRows = lookup
+	})
+}
+
+func TestDomainDirectoryOwnCredentials(t *testing.T) {
+	username, password, serverName, caFile := directory.LDAPUsername, directory.LDAPPassword, directory.ServerName, directory.CAFile
+	directory.LDAPUsername, directory.LDAPPassword = "cn=global,dc=example,dc=com", "global-secret"
+	directory.ServerName, directory.CAFile = "ldap.example.com", "/etc/ssl/global.pem"
+	defer func() {
+		directory.LDAPUsername, directory.LDAPPassword, directory.ServerName, directory.CAFile = username, password, serverName, caFile
+	}()
+	server, base := "ldap://ldap.d3.com", "dc=d3,dc=com"
+	bindDN, bindPassword, empty := "cn=reader,dc=d3,dc=com", "domain-secret", ""
+	withDirectoryRows(t, map[string]*dbdomains.DBStruct{
+		"d3": {Name: "d3", DirectoryStruct: dbdomains.DirectoryStruct{
+			Server: &server, BaseDN: &base, BindUsername: &bindDN, BindPassword: &bindPassword,
+		}},
+		"d4": {Name: "d4", DirectoryStruct: dbdomains.DirectoryStruct{Server: &server, BaseDN: &base}},
+		"d5": {Name: "d5", DirectoryStruct: dbdomains.DirectoryStruct{
+			Server: &server, BaseDN: &base, BindUsername: &bindDN, BindPassword: &empty,
+		}},
+	})
+	pool, err := lookupDomainDirectory(context.Background(), "d3", "user@d3.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := pool.Config
+	if config.BindDN != bindDN || config.BindPassword != bindPassword || config.BaseDN != base {
+		t.Errorf("domain credentials not used: %+v", config)
+	}
+	if config.ServerName != "" || config.CAFile != "" {
+		t.Errorf("global TLS settings inherited: %+v", config)
+	}
+	for _, domain := range []string{"d4", "d5"} {
+		if _, err := lookupDomainDirectory(context.Background(), domain, "user@"+domain+".com"); !errors.Is(err, NoBindCredentials) {
+			t.Errorf("%s without bind credentials: err = %v, want NoBindCredentials", domain, err)
+		}
+	}
+}
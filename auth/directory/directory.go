@@ -1,68 +1,321 @@
 package directory
 
 import (
-	"crypto/tls"
-	"fmt"
+	"errors"
 	"github.com/go-ldap/ldap/v3"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	LDAPUsername string
-	LDAPPassword string
-	LDAPServer   string
-	BaseDN       string
+	LDAPUsername        string
+	LDAPPassword        string
+	LDAPServer          string
+	BaseDN              string
+	StartTLS            = true
+	CAFile              string
+	ServerName          string
+	InsecureSkipVerify  bool
+	ConnectTimeout      = time.Second * 5
+	OperationTimeout    = time.Second * 10
+	PoolSize            = 8
+	HealthCheckInterval = time.Second * 30
+	UserFilter          = "(&{objectClasses}({mailAttribute}={username}))"
+	ObjectClasses       = []string{"inetOrgPerson"}
+	MailAttribute       = "mail"
+	NameAttribute       = "displayName"
+	GroupAttribute      = "memberOf"
+	GroupBaseDN         string
+	GroupFilter         string
+	DisabledAttribute   = "pwdAccountLockedTime"
 )
 
-func LDAPDial() (error, *ldap.Conn) {
-	dial, err := ldap.Dial("tcp", LDAPServer)
+var InvalidCredentials = ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+
+type User struct {
+	DN          string
+	Email       string
+	DisplayName string
+	Groups      []string
+	Role        *Role
+	Disabled    bool
+}
+
+var (
+	defaultPool *Pool
+	domainPools = map[string]*Pool{}
+	poolMu      sync.Mutex
+)
+
+func ParseServers(list string) []string {
+	var servers []string
+	for _, server := range strings.Split(list, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+func GlobalConfig() Config {
+	return Config{
+		Servers:             ParseServers(LDAPServer),
+		BindDN:              LDAPUsername,
+		BindPassword:        LDAPPassword,
+		BaseDN:              BaseDN,
+		StartTLS:            StartTLS,
+		CAFile:              CAFile,
+		ServerName:          ServerName,
+		InsecureSkipVerify:  InsecureSkipVerify,
+		ConnectTimeout:      ConnectTimeout,
+		OperationTimeout:    OperationTimeout,
+		PoolSize:            PoolSize,
+		HealthCheckInterval: HealthCheckInterval,
+		UserFilter:          UserFilter,
+		ObjectClasses:       ObjectClasses,
+		MailAttribute:       MailAttribute,
+		NameAttribute:       NameAttribute,
+		GroupAttribute:      GroupAttribute,
+		GroupBaseDN:         GroupBaseDN,
+		GroupFilter:         GroupFilter,
+		DisabledAttribute:   DisabledAttribute,
+	}
+}
+
+func Connect() error {
+	pool, err := NewPool(GlobalConfig())
 	if err != nil {
-		return err, nil
+		return err
+	}
+	poolMu.Lock()
+	old := defaultPool
+	defaultPool = pool
+	poolMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+func DefaultPool() (*Pool, error) {
+	poolMu.Lock()
+	pool := defaultPool
+	poolMu.Unlock()
+	if pool != nil {
+		return pool, nil
 	}
-	err = dial.StartTLS(&tls.Config{InsecureSkipVerify: true})
+	if err := Connect(); err != nil {
+		return nil, err
+	}
+	return DefaultPool()
+}
+
+func CheckAuth(username, password string) (*User, error) {
+	pool, err := DefaultPool()
 	if err != nil {
-		return err, nil
+		return nil, err
 	}
-	err = dial.Bind(LDAPUsername, LDAPPassword)
+	return pool.CheckAuth(username, password)
+}
+
+func PoolFor(key string, config Config) (*Pool, error) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if pool, ok := domainPools[key]; ok {
+		if reflect.DeepEqual(pool.Config, config) {
+			return pool, nil
+		}
+		pool.Close()
+		delete(domainPools, key)
+	}
+	pool, err := NewPool(config)
 	if err != nil {
-		return err, nil
+		return nil, err
 	}
-	return nil, dial
+	domainPools[key] = pool
+	return pool, nil
 }
 
-func CheckAuth(email, password string) error {
-	err, dial := LDAPDial()
+func (p *Pool) CheckAuth(username, password string) (*User, error) {
+	if password == "" {
+		return nil, InvalidCredentials
+	}
+	dial, err := p.Get()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer dial.Close()
+	defer dial.Release()
 
-	result, err := SearchLDAPbyMail(email, dial)
+	result, err := SearchUser(p.Config, username, dial)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(result.Entries) != 1 {
-		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+		return nil, InvalidCredentials
 	}
 
-	err = dial.Bind(result.Entries[0].DN, password)
+	user := p.Config.toUser(result.Entries[0], username)
+	if p.Config.GroupFilter != "" {
+		groups, err := SearchGroups(p.Config, user.DN, dial)
+		if err != nil {
+			return nil, err
+		}
+		user.Groups = append(user.Groups, groups...)
+	}
+	user.Role = MapRole(user.Groups, RoleRules, p.Config.Domain)
+
+	err = dial.Bind(user.DN, password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return user, nil
 }
 
-func SearchLDAPbyMail(email string, dial *ldap.Conn) (*ldap.SearchResult, error) {
-	return dial.Search(ldap.NewSearchRequest(
-		BaseDN,
+func SearchGroups(config Config, userDN string, dial ldap.Client) ([]string, error) {
+	baseDN := config.GroupBaseDN
+	if baseDN == "" {
+		baseDN = config.BaseDN
+	}
+	result, err := dial.Search(ldap.NewSearchRequest(
+		baseDN,
 		ldap.ScopeWholeSubtree,
 		ldap.NeverDerefAliases,
 		0,
 		0,
 		false,
-		fmt.Sprintf("(&(objectClass=inetOrgPerson)(mail=%s))", email),
+		strings.NewReplacer("{dn}", ldap.EscapeFilter(userDN)).Replace(config.GroupFilter),
 		[]string{"dn"},
 		nil,
 	))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+func SearchUser(config Config, username string, dial ldap.Client) (*ldap.SearchResult, error) {
+	return dial.Search(ldap.NewSearchRequest(
+		config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		0,
+		false,
+		config.UserSearchFilter(username),
+		config.userAttributes(),
+		nil,
+	))
+}
+
+func (p *Pool) SearchUsers(baseDN, filter string) ([]*User, error) {
+	dial, err := p.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer dial.Release()
+	if baseDN == "" {
+		baseDN = p.Config.BaseDN
+	}
+	if filter == "" {
+		filter = "(&{objectClasses}(" + p.Config.MailAttribute + "=*))"
+	}
+	result, err := dial.SearchWithPaging(ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		strings.NewReplacer("{objectClasses}", p.Config.objectClassesFilter()).Replace(filter),
+		p.Config.userAttributes(),
+		nil,
+	), 500)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*User, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		user := p.Config.toUser(entry, "")
+		if p.Config.GroupFilter != "" {
+			groups, err := SearchGroups(p.Config, user.DN, dial)
+			if err != nil {
+				return nil, err
+			}
+			user.Groups = append(user.Groups, groups...)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func GroupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return ""
+	}
+	return strings.ToLower(parsed.RDNs[0].Attributes[0].Value)
+}
+
+func (c Config) UserSearchFilter(username string) string {
+	filter := c.UserFilter
+	if filter == "" {
+		filter = UserFilter
+	}
+	mailAttribute := c.MailAttribute
+	if mailAttribute == "" {
+		mailAttribute = "mail"
+	}
+	return strings.NewReplacer(
+		"{username}", ldap.EscapeFilter(username),
+		"{objectClasses}", c.objectClassesFilter(),
+		"{mailAttribute}", mailAttribute,
+	).Replace(filter)
+}
+
+func (c Config) objectClassesFilter() string {
+	var objectClasses strings.Builder
+	for _, class := range c.ObjectClasses {
+		objectClasses.WriteString("(objectClass=" + ldap.EscapeFilter(class) + ")")
+	}
+	return objectClasses.String()
+}
+
+func (c Config) userAttributes() []string {
+	var attributes []string
+	for _, attribute := range []string{c.MailAttribute, c.NameAttribute, c.GroupAttribute, c.DisabledAttribute} {
+		if attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+func (c Config) toUser(entry *ldap.Entry, username string) *User {
+	user := User{
+		DN:    entry.DN,
+		Email: strings.ToLower(username),
+	}
+	if c.MailAttribute != "" {
+		if mail := entry.GetAttributeValue(c.MailAttribute); mail != "" {
+			user.Email = strings.ToLower(mail)
+		}
+	}
+	if c.NameAttribute != "" {
+		user.DisplayName = entry.GetAttributeValue(c.NameAttribute)
+	}
+	if c.GroupAttribute != "" {
+		user.Groups = entry.GetAttributeValues(c.GroupAttribute)
+	}
+	if c.DisabledAttribute != "" {
+		user.Disabled = entry.GetAttributeValue(c.DisabledAttribute) != ""
+	}
+	return &user
 }
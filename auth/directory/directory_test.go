@@ -0,0 +1,45 @@
+package directory
+
+import "testing"
+
+func TestUserSearchFilter(t *testing.T) {
+	tests := []struct {
+		filter        string
+		mailAttribute string
+		want          string
+	}{
+		{"", "mail", "(&(objectClass=inetOrgPerson)(mail=a\\2ab@d1.com))"},
+		{"", "userPrincipalName", "(&(objectClass=inetOrgPerson)(userPrincipalName=a\\2ab@d1.com))"},
+		{"", "", "(&(objectClass=inetOrgPerson)(mail=a\\2ab@d1.com))"},
+		{"(uid={username})", "userPrincipalName", "(uid=a\\2ab@d1.com)"},
+	}
+	for _, test := range tests {
+		config := Config{UserFilter: test.filter, ObjectClasses: []string{"inetOrgPerson"}, MailAttribute: test.mailAttribute}
+		if got := config.UserSearchFilter("a*b@d1.com"); got != test.want {
+			t.Errorf("filter %q with %q: got %s, want %s", test.filter, test.mailAttribute, got, test.want)
+		}
+	}
+}
+
+func TestCheckAuthMailAttribute(t *testing.T) {
+	server, config := newTestServer(t)
+	server.Add("uid=upn,"+testBaseDN, map[string][]string{
+		"objectClass":       {"inetOrgPerson"},
+		"uid":               {"upn"},
+		"userPrincipalName": {"upn@d1.com"},
+		"userPassword":      {testPassword},
+	})
+	config.MailAttribute = "userPrincipalName"
+	pool, err := NewPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	user, err := pool.CheckAuth("upn@d1.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "upn@d1.com" {
+		t.Errorf("email = %q", user.Email)
+	}
+}
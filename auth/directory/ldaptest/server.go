@@ -0,0 +1,637 @@
+package ldaptest
+
+import (
+	"errors"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const passwordModifyOID = "1.3.6.1.4.1.4203.1.11.1"
+
+type Server struct {
+	URL      string
+	listener net.Listener
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	dials   int
+	binds   int
+	conns   map[net.Conn]bool
+}
+
+type entry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+type operationError struct {
+	code    uint16
+	message string
+}
+
+func (e *operationError) Error() string {
+	return e.message
+}
+
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("ldaptest: failed to listen: " + err.Error())
+	}
+	s := &Server{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		entries:  map[string]*entry{},
+		conns:    map[net.Conn]bool{},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) Add(dn string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[normalize(dn)] = &entry{dn: dn, attributes: copyAttributes(attributes)}
+}
+
+func (s *Server) Entry(dn string) map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[normalize(dn)]; ok {
+		return copyAttributes(e.attributes)
+	}
+	return nil
+}
+
+func (s *Server) DNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dns := make([]string, 0, len(s.entries))
+	for _, e := range s.entries {
+		dns = append(dns, e.dn)
+	}
+	sort.Strings(dns)
+	return dns
+}
+
+func (s *Server) Dials() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+func (s *Server) Binds() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.dials++
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	bound := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+		var responses []*ber.Packet
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, err := s.bind(request)
+			if err == nil {
+				bound = dn
+			}
+			responses = append(responses, result(ldap.ApplicationBindResponse, err))
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			entries, err := s.search(request)
+			responses = append(entries, result(ldap.ApplicationSearchResultDone, err))
+		case ldap.ApplicationAddRequest:
+			responses = append(responses, result(ldap.ApplicationAddResponse, s.add(request)))
+		case ldap.ApplicationDelRequest:
+			responses = append(responses, result(ldap.ApplicationDelResponse, s.del(request)))
+		case ldap.ApplicationModifyRequest:
+			responses = append(responses, result(ldap.ApplicationModifyResponse, s.modify(request)))
+		case ldap.ApplicationModifyDNRequest:
+			responses = append(responses, result(ldap.ApplicationModifyDNResponse, s.modifyDN(request)))
+		case ldap.ApplicationExtendedRequest:
+			responses = append(responses, result(ldap.ApplicationExtendedResponse, s.extended(request, bound)))
+		case ldap.ApplicationAbandonRequest:
+			continue
+		default:
+			responses = append(responses, result(ldap.ApplicationExtendedResponse, unsupported()))
+		}
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+			envelope.AppendChild(response)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(request *ber.Packet) (string, error) {
+	if len(request.Children) < 3 {
+		return "", protocolError()
+	}
+	dn := stringValue(request.Children[1])
+	password := string(request.Children[2].Data.Bytes())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binds++
+	if dn == "" && password == "" {
+		return "", nil
+	}
+	e, ok := s.entries[normalize(dn)]
+	if !ok || !contains(e.attributes["userpassword"], password, false) {
+		return "", &operationError{ldap.LDAPResultInvalidCredentials, "invalid credentials"}
+	}
+	return e.dn, nil
+}
+
+func (s *Server) search(request *ber.Packet) ([]*ber.Packet, error) {
+	if len(request.Children) < 8 {
+		return nil, protocolError()
+	}
+	base := normalize(stringValue(request.Children[0]))
+	scope, _ := request.Children[1].Value.(int64)
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+	var selected []string
+	for _, attribute := range request.Children[7].Children {
+		selected = append(selected, stringValue(attribute))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if base == "" && scope == ldap.ScopeBaseObject {
+		rootDSE := &entry{attributes: map[string][]string{"supportedldapversion": {"3"}}}
+		return []*ber.Packet{encodeEntry(rootDSE, selected)}, nil
+	}
+	if _, ok := s.entries[base]; !ok {
+		return nil, &operationError{ldap.LDAPResultNoSuchObject, "no such object"}
+	}
+	var keys []string
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var found []*ber.Packet
+	for _, key := range keys {
+		if !inScope(key, base, scope) || !matches(s.entries[key], filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(found)) == sizeLimit {
+			return found, &operationError{ldap.LDAPResultSizeLimitExceeded, "size limit exceeded"}
+		}
+		found = append(found, encodeEntry(s.entries[key], selected))
+	}
+	return found, nil
+}
+
+func (s *Server) add(request *ber.Packet) error {
+	if len(request.Children) < 2 {
+		return protocolError()
+	}
+	dn := stringValue(request.Children[0])
+	attributes := map[string][]string{}
+	for _, attribute := range request.Children[1].Children {
+		name, values := partialAttribute(attribute)
+		attributes[name] = append(attributes[name], values...)
+	}
+	key := normalize(dn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; ok {
+		return &operationError{ldap.LDAPResultEntryAlreadyExists, "entry already exists"}
+	}
+	if _, ok := s.entries[parent(key)]; !ok {
+		return &operationError{ldap.LDAPResultNoSuchObject, "parent does not exist"}
+	}
+	s.entries[key] = &entry{dn: dn, attributes: attributes}
+	return nil
+}
+
+func (s *Server) del(request *ber.Packet) error {
+	key := normalize(string(request.Data.Bytes()))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		return &operationError{ldap.LDAPResultNoSuchObject, "no such object"}
+	}
+	for other := range s.entries {
+		if parent(other) == key {
+			return &operationError{ldap.LDAPResultNotAllowedOnNonLeaf, "entry has children"}
+		}
+	}
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *Server) modify(request *ber.Packet) error {
+	if len(request.Children) < 2 {
+		return protocolError()
+	}
+	key := normalize(stringValue(request.Children[0]))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return &operationError{ldap.LDAPResultNoSuchObject, "no such object"}
+	}
+	attributes := copyAttributes(e.attributes)
+	for _, change := range request.Children[1].Children {
+		if len(change.Children) < 2 {
+			return protocolError()
+		}
+		operation, _ := change.Children[0].Value.(int64)
+		name, values := partialAttribute(change.Children[1])
+		switch operation {
+		case ldap.AddAttribute:
+			attributes[name] = append(attributes[name], values...)
+		case ldap.DeleteAttribute:
+			if len(values) == 0 {
+				delete(attributes, name)
+				continue
+			}
+			for _, value := range values {
+				attributes[name] = remove(attributes[name], value)
+			}
+			if len(attributes[name]) == 0 {
+				delete(attributes, name)
+			}
+		case ldap.ReplaceAttribute:
+			if len(values) == 0 {
+				delete(attributes, name)
+			} else {
+				attributes[name] = values
+			}
+		default:
+			return protocolError()
+		}
+	}
+	e.attributes = attributes
+	return nil
+}
+
+func (s *Server) modifyDN(request *ber.Packet) error {
+	if len(request.Children) < 3 {
+		return protocolError()
+	}
+	key := normalize(stringValue(request.Children[0]))
+	newRDN := stringValue(request.Children[1])
+	deleteOld, _ := request.Children[2].Value.(bool)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return &operationError{ldap.LDAPResultNoSuchObject, "no such object"}
+	}
+	oldRDN, superior := splitFirst(e.dn)
+	if len(request.Children) > 3 {
+		superior = "," + string(request.Children[3].Data.Bytes())
+		if _, ok := s.entries[normalize(superior[1:])]; !ok {
+			return &operationError{ldap.LDAPResultNoSuchObject, "new superior does not exist"}
+		}
+	}
+	newDN := newRDN + superior
+	newKey := normalize(newDN)
+	if _, ok := s.entries[newKey]; ok && newKey != key {
+		return &operationError{ldap.LDAPResultEntryAlreadyExists, "entry already exists"}
+	}
+	oldName, oldValue := splitRDN(oldRDN)
+	name, value := splitRDN(newRDN)
+	if deleteOld {
+		e.attributes[oldName] = remove(e.attributes[oldName], oldValue)
+	}
+	if !contains(e.attributes[name], value, true) {
+		e.attributes[name] = append(e.attributes[name], value)
+	}
+	for other, child := range s.entries {
+		if other != key && strings.HasSuffix(other, ","+key) {
+			delete(s.entries, other)
+			child.dn = child.dn[:len(child.dn)-len(e.dn)] + newDN
+			s.entries[normalize(child.dn)] = child
+		}
+	}
+	delete(s.entries, key)
+	e.dn = newDN
+	s.entries[newKey] = e
+	return nil
+}
+
+func (s *Server) extended(request *ber.Packet, bound string) error {
+	if len(request.Children) < 1 || string(request.Children[0].Data.Bytes()) != passwordModifyOID {
+		return unsupported()
+	}
+	var identity, oldPassword, newPassword string
+	if len(request.Children) > 1 {
+		value := ber.DecodePacket(request.Children[1].Data.Bytes())
+		for _, field := range value.Children {
+			switch field.Tag {
+			case 0:
+				identity = string(field.Data.Bytes())
+			case 1:
+				oldPassword = string(field.Data.Bytes())
+			case 2:
+				newPassword = string(field.Data.Bytes())
+			}
+		}
+	}
+	if identity == "" {
+		identity = bound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[normalize(identity)]
+	if !ok {
+		return &operationError{ldap.LDAPResultNoSuchObject, "no such object"}
+	}
+	if oldPassword != "" && !contains(e.attributes["userpassword"], oldPassword, false) {
+		return &operationError{ldap.LDAPResultInvalidCredentials, "invalid credentials"}
+	}
+	e.attributes["userpassword"] = []string{newPassword}
+	return nil
+}
+
+func result(tag ber.Tag, err error) *ber.Packet {
+	code, message := uint16(ldap.LDAPResultSuccess), ""
+	if err != nil {
+		var opErr *operationError
+		if !errors.As(err, &opErr) {
+			opErr = &operationError{ldap.LDAPResultOther, err.Error()}
+		}
+		code, message = opErr.code, opErr.message
+	}
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnosticMessage"))
+	return response
+}
+
+func encodeEntry(e *entry, selected []string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	names := map[string]string{}
+	for name := range e.attributes {
+		names[name] = name
+	}
+	if len(selected) > 0 && !contains(selected, "*", false) {
+		names = map[string]string{}
+		for _, name := range selected {
+			if _, ok := e.attributes[strings.ToLower(name)]; ok {
+				names[strings.ToLower(name)] = name
+			}
+		}
+	}
+	delete(names, "userpassword")
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, names[key], "type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, value := range e.attributes[key] {
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(values)
+		attributes.AppendChild(attribute)
+	}
+	packet.AppendChild(attributes)
+	return packet
+}
+
+func matches(e *entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(e, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(e, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matches(e, filter.Children[0])
+	case ldap.FilterPresent:
+		return len(e.attributes[strings.ToLower(string(filter.Data.Bytes()))]) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		name, value := assertion(filter)
+		return contains(e.attributes[name], value, true)
+	case ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		name, value := assertion(filter)
+		for _, have := range e.attributes[name] {
+			compare := strings.Compare(strings.ToLower(have), strings.ToLower(value))
+			if (filter.Tag == ldap.FilterGreaterOrEqual && compare >= 0) || (filter.Tag == ldap.FilterLessOrEqual && compare <= 0) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, have := range e.attributes[strings.ToLower(stringValue(filter.Children[0]))] {
+			if substringMatch(strings.ToLower(have), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func substringMatch(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		piece := strings.ToLower(string(part.Data.Bytes()))
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, piece) {
+				return false
+			}
+			value = value[len(piece):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, piece)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(piece):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, piece) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func assertion(filter *ber.Packet) (string, string) {
+	if len(filter.Children) != 2 {
+		return "", ""
+	}
+	return strings.ToLower(stringValue(filter.Children[0])), stringValue(filter.Children[1])
+}
+
+func partialAttribute(packet *ber.Packet) (string, []string) {
+	if len(packet.Children) < 2 {
+		return "", nil
+	}
+	var values []string
+	for _, value := range packet.Children[1].Children {
+		values = append(values, stringValue(value))
+	}
+	return strings.ToLower(stringValue(packet.Children[0])), values
+}
+
+func inScope(key, base string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return key == base
+	case ldap.ScopeSingleLevel:
+		return parent(key) == base
+	default:
+		return key == base || strings.HasSuffix(key, ","+base)
+	}
+}
+
+func normalize(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		attributes := make([]string, 0, len(rdn.Attributes))
+		for _, attribute := range rdn.Attributes {
+			attributes = append(attributes, strings.ToLower(attribute.Type)+"="+strings.ToLower(attribute.Value))
+		}
+		rdns = append(rdns, strings.Join(attributes, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
+
+func parent(key string) string {
+	parsed, err := ldap.ParseDN(key)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return ""
+	}
+	rdns := make([]string, 0, len(parsed.RDNs)-1)
+	for _, rdn := range parsed.RDNs[1:] {
+		rdns = append(rdns, strings.ToLower(rdn.Attributes[0].Type)+"="+strings.ToLower(rdn.Attributes[0].Value))
+	}
+	return strings.Join(rdns, ",")
+}
+
+func splitFirst(dn string) (string, string) {
+	escaped := false
+	for i, c := range dn {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			return dn[:i], dn[i:]
+		}
+	}
+	return dn, ""
+}
+
+func splitRDN(rdn string) (string, string) {
+	parsed, err := ldap.ParseDN(rdn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return "", ""
+	}
+	attribute := parsed.RDNs[0].Attributes[0]
+	return strings.ToLower(attribute.Type), attribute.Value
+}
+
+func stringValue(packet *ber.Packet) string {
+	if value, ok := packet.Value.(string); ok {
+		return value
+	}
+	return string(packet.Data.Bytes())
+}
+
+func contains(values []string, value string, fold bool) bool {
+	for _, have := range values {
+		if have == value || (fold && strings.EqualFold(have, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(values []string, value string) []string {
+	kept := values[:0]
+	for _, have := range values {
+		if !strings.EqualFold(have, value) {
+			kept = append(kept, have)
+		}
+	}
+	return kept
+}
+
+func copyAttributes(attributes map[string][]string) map[string][]string {
+	copied := make(map[string][]string, len(attributes))
+	for name, values := range attributes {
+		copied[strings.ToLower(name)] = append([]string(nil), values...)
+	}
+	return copied
+}
+
+func protocolError() error {
+	return &operationError{ldap.LDAPResultProtocolError, "malformed request"}
+}
+
+func unsupported() error {
+	return &operationError{ldap.LDAPResultUnwillingToPerform, "operation not supported"}
+}
@@ -0,0 +1,50 @@
+package directory
+
+import (
+	"github.com/go-ldap/ldap/v3"
+)
+
+func (p *Pool) ChangePassword(username, oldPassword, newPassword string) error {
+	if oldPassword == "" {
+		return InvalidCredentials
+	}
+	dial, err := p.Get()
+	if err != nil {
+		return err
+	}
+	defer dial.Release()
+	dn, err := p.userDN(username, dial)
+	if err != nil {
+		return err
+	}
+	if err := dial.Bind(dn, oldPassword); err != nil {
+		return err
+	}
+	_, err = dial.PasswordModify(ldap.NewPasswordModifyRequest("", oldPassword, newPassword))
+	return err
+}
+
+func (p *Pool) ResetPassword(username, newPassword string) error {
+	dial, err := p.Get()
+	if err != nil {
+		return err
+	}
+	defer dial.Release()
+	dn, err := p.userDN(username, dial)
+	if err != nil {
+		return err
+	}
+	_, err = dial.PasswordModify(ldap.NewPasswordModifyRequest(dn, "", newPassword))
+	return err
+}
+
+func (p *Pool) userDN(username string, dial ldap.Client) (string, error) {
+	result, err := SearchUser(p.Config, username, dial)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Entries) != 1 {
+		return "", InvalidCredentials
+	}
+	return result.Entries[0].DN, nil
+}
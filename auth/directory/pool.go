@@ -0,0 +1,223 @@
+package directory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	NoServers = errors.New("no ldap servers configured")
+	BadCAFile = errors.New("no certificates found in ca file")
+)
+
+type Config struct {
+	Domain              string
+	Servers             []string
+	BindDN              string
+	BindPassword        string
+	BaseDN              string
+	StartTLS            bool
+	CAFile              string
+	ServerName          string
+	InsecureSkipVerify  bool
+	ConnectTimeout      time.Duration
+	OperationTimeout    time.Duration
+	PoolSize            int
+	HealthCheckInterval time.Duration
+	UserFilter          string
+	ObjectClasses       []string
+	MailAttribute       string
+	NameAttribute       string
+	GroupAttribute      string
+	GroupBaseDN         string
+	GroupFilter         string
+	DisabledAttribute   string
+}
+
+type Pool struct {
+	Config    Config
+	tlsConfig *tls.Config
+	idle      chan *Conn
+	mu        sync.Mutex
+	preferred int
+}
+
+type Conn struct {
+	*ldap.Conn
+	pool    *Pool
+	server  string
+	checked time.Time
+	dirty   bool
+}
+
+func NewPool(config Config) (*Pool, error) {
+	if len(config.Servers) == 0 {
+		return nil, NoServers
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: %w", config.CAFile, BadCAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	size := config.PoolSize
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		Config:    config,
+		tlsConfig: tlsConfig,
+		idle:      make(chan *Conn, size),
+	}, nil
+}
+
+func (p *Pool) Get() (*Conn, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			if p.healthy(conn) {
+				return conn, nil
+			}
+			conn.Conn.Close()
+		default:
+			return p.dial()
+		}
+	}
+}
+
+func (p *Pool) Close() {
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (p *Pool) healthy(conn *Conn) bool {
+	if conn.IsClosing() {
+		return false
+	}
+	if p.Config.HealthCheckInterval <= 0 || time.Since(conn.checked) < p.Config.HealthCheckInterval {
+		return true
+	}
+	_, err := conn.Search(ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1,
+		0,
+		false,
+		"(objectClass=*)",
+		[]string{"supportedLDAPVersion"},
+		nil,
+	))
+	if err != nil {
+		return false
+	}
+	conn.checked = time.Now()
+	return true
+}
+
+func (p *Pool) dial() (*Conn, error) {
+	p.mu.Lock()
+	start := p.preferred
+	p.mu.Unlock()
+	var lastErr error
+	for i := range p.Config.Servers {
+		index := (start + i) % len(p.Config.Servers)
+		conn, err := p.dialServer(p.Config.Servers[index])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		p.mu.Lock()
+		p.preferred = index
+		p.mu.Unlock()
+		return conn, nil
+	}
+	return nil, lastErr
+}
+
+func (p *Pool) dialServer(server string) (*Conn, error) {
+	address := server
+	if !strings.Contains(address, "://") {
+		address = "ldap://" + address
+	}
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := p.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = parsed.Hostname()
+	}
+	dial, err := ldap.DialURL(
+		address,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.Config.ConnectTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	dial.SetTimeout(p.Config.OperationTimeout)
+	if parsed.Scheme == "ldap" && p.Config.StartTLS {
+		if err := dial.StartTLS(tlsConfig); err != nil {
+			dial.Close()
+			return nil, err
+		}
+	}
+	if err := dial.Bind(p.Config.BindDN, p.Config.BindPassword); err != nil {
+		dial.Close()
+		return nil, err
+	}
+	return &Conn{
+		Conn:    dial,
+		pool:    p,
+		server:  server,
+		checked: time.Now(),
+	}, nil
+}
+
+func (c *Conn) Bind(username, password string) error {
+	c.dirty = c.dirty || username != c.pool.Config.BindDN
+	return c.Conn.Bind(username, password)
+}
+
+func (c *Conn) Release() {
+	if c.IsClosing() {
+		return
+	}
+	if c.dirty {
+		if err := c.Conn.Bind(c.pool.Config.BindDN, c.pool.Config.BindPassword); err != nil {
+			c.Conn.Close()
+			return
+		}
+		c.dirty = false
+	}
+	select {
+	case c.pool.idle <- c:
+	default:
+		c.Conn.Close()
+	}
+}
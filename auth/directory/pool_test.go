@@ -0,0 +1,152 @@
+package directory
+
+import (
+	"files-back/auth/directory/ldaptest"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testBaseDN   = "dc=example,dc=com"
+	testBindDN   = "cn=admin,dc=example,dc=com"
+	testPassword = "secret"
+)
+
+func newTestServer(tb testing.TB) (*ldaptest.Server, Config) {
+	tb.Helper()
+	server := ldaptest.NewServer()
+	tb.Cleanup(server.Close)
+	server.Add(testBaseDN, map[string][]string{"objectClass": {"domain"}, "dc": {"example"}})
+	server.Add(testBindDN, map[string][]string{"objectClass": {"person"}, "cn": {"admin"}, "userPassword": {testPassword}})
+	server.Add("uid=user@d1.com,"+testBaseDN, map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"uid":          {"user@d1.com"},
+		"mail":         {"User@d1.com"},
+		"displayName":  {"Test User"},
+		"userPassword": {testPassword},
+	})
+	config := GlobalConfig()
+	config.Servers = []string{server.URL}
+	config.BindDN = testBindDN
+	config.BindPassword = testPassword
+	config.BaseDN = testBaseDN
+	config.StartTLS = false
+	config.CAFile = ""
+	config.ConnectTimeout = time.Second
+	config.OperationTimeout = time.Second
+	return server, config
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	server, config := newTestServer(t)
+	pool, err := NewPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for i := 0; i < 10; i++ {
+		user, err := pool.CheckAuth("user@d1.com", testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "user@d1.com" || user.DisplayName != "Test User" {
+			t.Fatalf("unexpected user %+v", user)
+		}
+	}
+	if _, err := pool.CheckAuth("user@d1.com", "wrong"); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Errorf("wrong password: err = %v", err)
+	}
+	if dials := server.Dials(); dials != 1 {
+		t.Errorf("dials = %d, want 1", dials)
+	}
+}
+
+func TestPoolFailover(t *testing.T) {
+	server, config := newTestServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := "ldap://" + listener.Addr().String()
+	listener.Close()
+	config.Servers = []string{down, server.URL}
+	pool, err := NewPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if _, err := pool.CheckAuth("user@d1.com", testPassword); err != nil {
+		t.Fatalf("failover: %v", err)
+	}
+	if pool.preferred != 1 {
+		t.Errorf("preferred server = %d, want 1", pool.preferred)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	server, config := newTestServer(t)
+	config.HealthCheckInterval = time.Nanosecond
+	pool, err := NewPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	conn, err = pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+	if dials := server.Dials(); dials != 1 {
+		t.Errorf("healthy connection redialed: dials = %d", dials)
+	}
+}
+
+func BenchmarkCheckAuth(b *testing.B) {
+	for _, size := range []int{1, 8} {
+		b.Run("pooled/"+strconv.Itoa(size), func(b *testing.B) {
+			_, config := newTestServer(b)
+			config.PoolSize = size
+			pool, err := NewPool(config)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer pool.Close()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := pool.CheckAuth("user@d1.com", testPassword); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+	b.Run("dial-per-login", func(b *testing.B) {
+		_, config := newTestServer(b)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				pool, err := NewPool(config)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				_, err = pool.CheckAuth("user@d1.com", testPassword)
+				pool.Close()
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
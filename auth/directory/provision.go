@@ -0,0 +1,291 @@
+package directory
+
+import (
+	"errors"
+	"github.com/go-ldap/ldap/v3"
+	"strings"
+)
+
+const baseDNPlaceholder = "{baseDN}"
+
+var Provisioning Provisioner = NopProvisioner{}
+
+var BadLayout = errors.New("bad ou layout")
+
+type UserEntry struct {
+	Email       string
+	DisplayName string
+	Domain      string
+	Tenant      string
+	Disabled    bool
+}
+
+type GroupEntry struct {
+	Name   string
+	Domain string
+	Tenant string
+}
+
+type Provisioner interface {
+	CreateUser(user UserEntry) error
+	UpdateUser(old, user UserEntry) error
+	DisableUser(user UserEntry) error
+	DeleteUser(user UserEntry) error
+	CreateGroup(group GroupEntry) error
+	UpdateGroup(oldName string, group GroupEntry) error
+	DeleteGroup(group GroupEntry) error
+}
+
+type NopProvisioner struct{}
+
+func (NopProvisioner) CreateUser(UserEntry) error            { return nil }
+func (NopProvisioner) UpdateUser(UserEntry, UserEntry) error { return nil }
+func (NopProvisioner) DisableUser(UserEntry) error           { return nil }
+func (NopProvisioner) DeleteUser(UserEntry) error            { return nil }
+func (NopProvisioner) CreateGroup(GroupEntry) error          { return nil }
+func (NopProvisioner) UpdateGroup(string, GroupEntry) error  { return nil }
+func (NopProvisioner) DeleteGroup(GroupEntry) error          { return nil }
+
+type LDAPProvisioner struct {
+	Pools            func(domain string) (*Pool, error)
+	UserOU           string
+	GroupOU          string
+	UserRDN          string
+	UserClasses      []string
+	GroupClass       string
+	GroupMember      string
+	DisableAttribute string
+	DisableValue     string
+}
+
+func NewLDAPProvisioner(pools func(domain string) (*Pool, error)) *LDAPProvisioner {
+	return &LDAPProvisioner{
+		Pools:            pools,
+		UserOU:           "ou=people,ou={tenant},ou={domain}," + baseDNPlaceholder,
+		GroupOU:          "ou=groups,ou={tenant},ou={domain}," + baseDNPlaceholder,
+		UserRDN:          "uid",
+		UserClasses:      []string{"top", "person", "organizationalPerson", "inetOrgPerson"},
+		GroupClass:       "groupOfNames",
+		GroupMember:      "cn=nobody," + baseDNPlaceholder,
+		DisableAttribute: DisabledAttribute,
+		DisableValue:     "000001010000Z",
+	}
+}
+
+func (p *LDAPProvisioner) CreateUser(user UserEntry) error {
+	return p.with(user.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.UserOU, pool.Config.BaseDN, user.Domain, user.Tenant)
+		if err := ensureOUs(conn, ou); err != nil {
+			return err
+		}
+		add := ldap.NewAddRequest(p.userDN(ou, user.Email), nil)
+		add.Attribute("objectClass", p.UserClasses)
+		for attribute, values := range p.userAttributes(user) {
+			add.Attribute(attribute, values)
+		}
+		return conn.Add(add)
+	})
+}
+
+func (p *LDAPProvisioner) UpdateUser(old, user UserEntry) error {
+	if old.Email == "" {
+		old.Email = user.Email
+	}
+	if old.Tenant == "" {
+		old.Tenant = user.Tenant
+	}
+	return p.with(user.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.UserOU, pool.Config.BaseDN, user.Domain, user.Tenant)
+		oldOU := p.layout(p.UserOU, pool.Config.BaseDN, user.Domain, old.Tenant)
+		dn := p.userDN(ou, user.Email)
+		if oldDN := p.userDN(oldOU, old.Email); oldDN != dn {
+			var superior string
+			if oldOU != ou {
+				if err := ensureOUs(conn, ou); err != nil {
+					return err
+				}
+				superior = ou
+			}
+			rename := ldap.NewModifyDNRequest(oldDN, p.UserRDN+"="+EscapeDNValue(user.Email), true, superior)
+			if err := conn.ModifyDN(rename); err != nil {
+				return err
+			}
+		}
+		modify := ldap.NewModifyRequest(dn, nil)
+		for attribute, values := range p.userAttributes(user) {
+			if attribute != p.UserRDN {
+				modify.Replace(attribute, values)
+			}
+		}
+		if p.DisableAttribute != "" {
+			if user.Disabled {
+				modify.Replace(p.DisableAttribute, []string{p.DisableValue})
+			} else {
+				modify.Replace(p.DisableAttribute, []string{})
+			}
+		}
+		return conn.Modify(modify)
+	})
+}
+
+func (p *LDAPProvisioner) DisableUser(user UserEntry) error {
+	return p.with(user.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.UserOU, pool.Config.BaseDN, user.Domain, user.Tenant)
+		modify := ldap.NewModifyRequest(p.userDN(ou, user.Email), nil)
+		modify.Replace(p.DisableAttribute, []string{p.DisableValue})
+		return conn.Modify(modify)
+	})
+}
+
+func (p *LDAPProvisioner) DeleteUser(user UserEntry) error {
+	return p.with(user.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.UserOU, pool.Config.BaseDN, user.Domain, user.Tenant)
+		return ignoreNoSuchObject(conn.Del(ldap.NewDelRequest(p.userDN(ou, user.Email), nil)))
+	})
+}
+
+func (p *LDAPProvisioner) CreateGroup(group GroupEntry) error {
+	return p.with(group.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.GroupOU, pool.Config.BaseDN, group.Domain, group.Tenant)
+		if err := ensureOUs(conn, ou); err != nil {
+			return err
+		}
+		add := ldap.NewAddRequest(groupDN(ou, group.Name), nil)
+		add.Attribute("objectClass", []string{"top", p.GroupClass})
+		add.Attribute("cn", []string{group.Name})
+		if p.GroupMember != "" {
+			add.Attribute("member", []string{p.layout(p.GroupMember, pool.Config.BaseDN, group.Domain, group.Tenant)})
+		}
+		return conn.Add(add)
+	})
+}
+
+func (p *LDAPProvisioner) UpdateGroup(oldName string, group GroupEntry) error {
+	if oldName == "" || oldName == group.Name {
+		return nil
+	}
+	return p.with(group.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.GroupOU, pool.Config.BaseDN, group.Domain, group.Tenant)
+		return conn.ModifyDN(ldap.NewModifyDNRequest(groupDN(ou, oldName), "cn="+EscapeDNValue(group.Name), true, ""))
+	})
+}
+
+func (p *LDAPProvisioner) DeleteGroup(group GroupEntry) error {
+	return p.with(group.Domain, func(pool *Pool, conn *Conn) error {
+		ou := p.layout(p.GroupOU, pool.Config.BaseDN, group.Domain, group.Tenant)
+		return ignoreNoSuchObject(conn.Del(ldap.NewDelRequest(groupDN(ou, group.Name), nil)))
+	})
+}
+
+func (p *LDAPProvisioner) with(domain string, fn func(pool *Pool, conn *Conn) error) error {
+	pool, err := p.Pools(domain)
+	if err != nil {
+		return err
+	}
+	conn, err := pool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return fn(pool, conn)
+}
+
+func (p *LDAPProvisioner) userDN(ou, email string) string {
+	return p.UserRDN + "=" + EscapeDNValue(email) + "," + ou
+}
+
+func (p *LDAPProvisioner) userAttributes(user UserEntry) map[string][]string {
+	name := strings.TrimSpace(user.DisplayName)
+	if name == "" {
+		name = user.Email
+	}
+	fields := strings.Fields(name)
+	return map[string][]string{
+		p.UserRDN:     {user.Email},
+		"mail":        {user.Email},
+		"cn":          {name},
+		"sn":          {fields[len(fields)-1]},
+		"displayName": {name},
+	}
+}
+
+func groupDN(ou, name string) string {
+	return "cn=" + EscapeDNValue(name) + "," + ou
+}
+
+func (p *LDAPProvisioner) layout(template, baseDN, domain, tenant string) string {
+	replacer := strings.NewReplacer(
+		"{domain}", EscapeDNValue(domain),
+		"{tenant}", EscapeDNValue(tenant),
+		baseDNPlaceholder, baseDN,
+	)
+	return replacer.Replace(template)
+}
+
+func ensureOUs(conn *Conn, dn string) error {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return err
+	}
+	rdns := splitDN(dn)
+	if len(rdns) != len(parsed.RDNs) {
+		return BadLayout
+	}
+	for i := len(parsed.RDNs) - 1; i >= 0; i-- {
+		attributes := parsed.RDNs[i].Attributes
+		if len(attributes) != 1 || !strings.EqualFold(attributes[0].Type, "ou") {
+			continue
+		}
+		add := ldap.NewAddRequest(strings.Join(rdns[i:], ","), nil)
+		add.Attribute("objectClass", []string{"top", "organizationalUnit"})
+		add.Attribute("ou", []string{attributes[0].Value})
+		err := conn.Add(add)
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitDN(dn string) []string {
+	var parts []string
+	var current strings.Builder
+	escaped := false
+	for _, c := range dn {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	return append(parts, strings.TrimSpace(current.String()))
+}
+
+func EscapeDNValue(value string) string {
+	var b strings.Builder
+	for i, c := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, c):
+			b.WriteRune('\\')
+		case (c == ' ' || c == '#') && i == 0:
+			b.WriteRune('\\')
+		case c == ' ' && i == len(value)-1:
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func ignoreNoSuchObject(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil
+	}
+	return err
+}
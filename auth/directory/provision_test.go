@@ -0,0 +1,170 @@
+package directory
+
+import (
+	"files-back/auth/directory/ldaptest"
+	"github.com/go-ldap/ldap/v3"
+	"testing"
+)
+
+const (
+	t1People = "ou=people,ou=t1,ou=d1," + testBaseDN
+	t2People = "ou=people,ou=t2,ou=d1," + testBaseDN
+)
+
+func newTestProvisioner(t *testing.T) (*ldaptest.Server, *LDAPProvisioner) {
+	t.Helper()
+	server, config := newTestServer(t)
+	pool, err := NewPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return server, NewLDAPProvisioner(func(string) (*Pool, error) {
+		return pool, nil
+	})
+}
+
+func TestProvisionUserLifecycle(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	user := UserEntry{Email: "new@d1.com", DisplayName: "New User", Domain: "d1", Tenant: "t1"}
+	if err := p.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	entry := server.Entry("uid=new@d1.com," + t1People)
+	if entry == nil || entry["sn"][0] != "User" || entry["mail"][0] != "new@d1.com" {
+		t.Fatalf("created entry = %v", entry)
+	}
+	if err := p.CreateUser(user); !ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		t.Errorf("duplicate create: err = %v", err)
+	}
+
+	renamed := user
+	renamed.Email, renamed.DisplayName = "renamed@d1.com", "Renamed"
+	if err := p.UpdateUser(user, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if server.Entry("uid=new@d1.com,"+t1People) != nil {
+		t.Error("old dn still present after rename")
+	}
+	entry = server.Entry("uid=renamed@d1.com," + t1People)
+	if entry == nil || entry["uid"][0] != "renamed@d1.com" || entry["displayname"][0] != "Renamed" {
+		t.Fatalf("renamed entry = %v", entry)
+	}
+
+	if err := p.DisableUser(renamed); err != nil {
+		t.Fatal(err)
+	}
+	if entry := server.Entry("uid=renamed@d1.com," + t1People); len(entry["pwdaccountlockedtime"]) != 1 {
+		t.Errorf("disabled entry = %v", entry)
+	}
+	if err := p.DeleteUser(renamed); err != nil {
+		t.Fatal(err)
+	}
+	if server.Entry("uid=renamed@d1.com,"+t1People) != nil {
+		t.Error("entry still present after delete")
+	}
+	if err := p.DeleteUser(renamed); err != nil {
+		t.Errorf("deleting a missing entry: %v", err)
+	}
+}
+
+func TestProvisionUserReenable(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	user := UserEntry{Email: "user@d1.com", DisplayName: "User", Domain: "d1", Tenant: "t1"}
+	if err := p.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DisableUser(user); err != nil {
+		t.Fatal(err)
+	}
+	disabled := user
+	disabled.Disabled = true
+	if err := p.UpdateUser(disabled, disabled); err != nil {
+		t.Fatal(err)
+	}
+	if entry := server.Entry("uid=user@d1.com," + t1People); len(entry["pwdaccountlockedtime"]) != 1 {
+		t.Fatalf("updating a disabled user re-enabled it: %v", entry)
+	}
+	if err := p.UpdateUser(disabled, user); err != nil {
+		t.Fatal(err)
+	}
+	if entry := server.Entry("uid=user@d1.com," + t1People); entry == nil || len(entry["pwdaccountlockedtime"]) != 0 {
+		t.Errorf("re-enabled entry = %v", entry)
+	}
+	if err := p.UpdateUser(user, user); err != nil {
+		t.Errorf("updating an enabled user: %v", err)
+	}
+}
+
+func TestProvisionUserTenantMove(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	user := UserEntry{Email: "user@d1.com", DisplayName: "User", Domain: "d1", Tenant: "t1"}
+	if err := p.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	moved := user
+	moved.Tenant = "t2"
+	if err := p.UpdateUser(user, moved); err != nil {
+		t.Fatal(err)
+	}
+	if server.Entry("uid=user@d1.com,"+t1People) != nil {
+		t.Error("entry left behind in the old tenant")
+	}
+	if server.Entry("uid=user@d1.com,"+t2People) == nil {
+		t.Errorf("entry not moved to the new tenant: %v", server.DNs())
+	}
+
+	back := moved
+	back.Email, back.Tenant = "back@d1.com", "t1"
+	if err := p.UpdateUser(moved, back); err != nil {
+		t.Fatal(err)
+	}
+	if entry := server.Entry("uid=back@d1.com," + t1People); entry == nil || len(entry["uid"]) != 1 {
+		t.Errorf("moved and renamed entry = %v", entry)
+	}
+}
+
+func TestProvisionGroups(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	groups := "ou=groups,ou=t1,ou=d1," + testBaseDN
+	group := GroupEntry{Name: "staff", Domain: "d1", Tenant: "t1"}
+	if err := p.CreateGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if entry := server.Entry("cn=staff," + groups); entry == nil || entry["member"][0] != "cn=nobody,"+testBaseDN {
+		t.Fatalf("group entry = %v", entry)
+	}
+	if err := p.UpdateGroup("staff", GroupEntry{Name: "crew", Domain: "d1", Tenant: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if server.Entry("cn=staff,"+groups) != nil || server.Entry("cn=crew,"+groups) == nil {
+		t.Errorf("group not renamed: %v", server.DNs())
+	}
+	if err := p.DeleteGroup(GroupEntry{Name: "crew", Domain: "d1", Tenant: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if server.Entry("cn=crew,"+groups) != nil {
+		t.Error("group still present after delete")
+	}
+}
+
+func TestProvisionGroupMember(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	groups := "ou=groups,ou=t1,ou=d1," + testBaseDN
+	p.GroupMember = "cn=placeholder,ou={tenant},ou={domain},{baseDN}"
+	if err := p.CreateGroup(GroupEntry{Name: "staff", Domain: "d1", Tenant: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	entry := server.Entry("cn=staff," + groups)
+	if entry == nil || len(entry["member"]) != 1 || entry["member"][0] != "cn=placeholder,ou=t1,ou=d1,"+testBaseDN {
+		t.Fatalf("group entry = %v", entry)
+	}
+
+	p.GroupClass, p.GroupMember = "groupOfMembers", ""
+	if err := p.CreateGroup(GroupEntry{Name: "crew", Domain: "d1", Tenant: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if entry := server.Entry("cn=crew," + groups); entry == nil || len(entry["member"]) != 0 {
+		t.Errorf("empty group entry = %v", entry)
+	}
+}
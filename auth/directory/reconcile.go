@@ -0,0 +1,81 @@
+package directory
+
+import (
+	"sort"
+	"strings"
+)
+
+type Account struct {
+	Email       string
+	DisplayName string
+	Tenant      string
+	Disabled    bool
+}
+
+type DriftEntry struct {
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant,omitempty"`
+	DN     string `json:"dn,omitempty"`
+}
+
+type Mismatch struct {
+	DriftEntry
+	Attribute string `json:"attribute"`
+	Database  string `json:"database"`
+	Directory string `json:"directory"`
+}
+
+type Drift struct {
+	Missing           []DriftEntry `json:"missing"`
+	Extra             []DriftEntry `json:"extra"`
+	Mismatched        []Mismatch   `json:"mismatched"`
+	DisabledButActive []DriftEntry `json:"disabledButActive"`
+}
+
+func Reconcile(accounts []Account, users []*User) *Drift {
+	drift := Drift{
+		Missing:           []DriftEntry{},
+		Extra:             []DriftEntry{},
+		Mismatched:        []Mismatch{},
+		DisabledButActive: []DriftEntry{},
+	}
+	byEmail := make(map[string]*User, len(users))
+	for _, user := range users {
+		if user.Email != "" {
+			byEmail[strings.ToLower(user.Email)] = user
+		}
+	}
+	seen := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		email := strings.ToLower(account.Email)
+		seen[email] = true
+		user, ok := byEmail[email]
+		entry := DriftEntry{Email: account.Email, Name: account.DisplayName, Tenant: account.Tenant}
+		switch {
+		case !ok && account.Disabled:
+		case !ok:
+			drift.Extra = append(drift.Extra, entry)
+		case account.Disabled && !user.Disabled:
+			entry.DN = user.DN
+			drift.DisabledButActive = append(drift.DisabledButActive, entry)
+		case !account.Disabled && user.DisplayName != account.DisplayName:
+			entry.DN = user.DN
+			drift.Mismatched = append(drift.Mismatched, Mismatch{
+				DriftEntry: entry,
+				Attribute:  "displayName",
+				Database:   account.DisplayName,
+				Directory:  user.DisplayName,
+			})
+		}
+	}
+	for email, user := range byEmail {
+		if !seen[email] && !user.Disabled {
+			drift.Missing = append(drift.Missing, DriftEntry{Email: user.Email, Name: user.DisplayName, DN: user.DN})
+		}
+	}
+	sort.Slice(drift.Missing, func(i, j int) bool {
+		return drift.Missing[i].Email < drift.Missing[j].Email
+	})
+	return &drift
+}
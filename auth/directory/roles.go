@@ -0,0 +1,89 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const ruleSeparator = "=>"
+
+var roleRank = map[string]int{
+	"tenant_admin": 1,
+	"domain_admin": 2,
+	"full_Admin":   3,
+}
+
+var (
+	RoleRules = []RoleRule{}
+	BadRule   = errors.New("bad role mapping rule")
+)
+
+type RoleRule struct {
+	Pattern *regexp.Regexp
+	Role    string
+}
+
+type Role struct {
+	Type   string
+	Domain string
+	Tenant string
+}
+
+func ParseRoleRules(spec string) ([]RoleRule, error) {
+	rules := []RoleRule{}
+	for _, item := range strings.Split(spec, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, ruleSeparator)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", BadRule, item)
+		}
+		role := strings.TrimSpace(item[i+len(ruleSeparator):])
+		if _, ok := roleRank[role]; !ok {
+			return nil, fmt.Errorf("%w: unknown role %s", BadRule, role)
+		}
+		pattern, err := regexp.Compile("(?i)" + strings.TrimSpace(item[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", BadRule, err)
+		}
+		rules = append(rules, RoleRule{Pattern: pattern, Role: role})
+	}
+	return rules, nil
+}
+
+func MapRole(groups []string, rules []RoleRule, domain string) *Role {
+	var best *Role
+	for _, group := range groups {
+		for _, rule := range rules {
+			match := rule.Pattern.FindStringSubmatch(group)
+			if match == nil {
+				continue
+			}
+			role := Role{Type: rule.Role}
+			for i, name := range rule.Pattern.SubexpNames() {
+				switch name {
+				case "domain":
+					role.Domain = strings.ToLower(match[i])
+				case "tenant":
+					role.Tenant = strings.ToLower(match[i])
+				}
+			}
+			if role.Type == "domain_admin" && role.Domain == "" {
+				continue
+			}
+			if role.Type == "tenant_admin" && (role.Domain == "" || role.Tenant == "") {
+				continue
+			}
+			if domain != "" && (role.Type == "full_Admin" || role.Domain != domain) {
+				continue
+			}
+			if best == nil || roleRank[role.Type] > roleRank[best.Type] {
+				best = &role
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,30 @@
+package directory
+
+import "testing"
+
+func TestMapRoleDomainScope(t *testing.T) {
+	rules, err := ParseRoleRules(`^cn=admins,` + "=> full_Admin;" +
+		`^cn=(?P<domain>[^,]+)-admins,` + "=> domain_admin;" +
+		`^cn=(?P<domain>[^-,]+)-(?P<tenant>[^,]+)-admins,` + "=> tenant_admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		groups []string
+		domain string
+		want   *Role
+	}{
+		{[]string{"cn=admins,dc=example"}, "", &Role{Type: "full_Admin"}},
+		{[]string{"cn=admins,dc=example"}, "d1", nil},
+		{[]string{"cn=d1-admins,dc=example"}, "d1", &Role{Type: "domain_admin", Domain: "d1"}},
+		{[]string{"cn=d2-admins,dc=example"}, "d1", nil},
+		{[]string{"cn=admins,dc=example", "cn=d1-t1-admins,dc=example"}, "d1", &Role{Type: "tenant_admin", Domain: "d1", Tenant: "t1"}},
+		{[]string{"cn=d2-admins,dc=example", "cn=d1-t1-admins,dc=example"}, "d1", &Role{Type: "tenant_admin", Domain: "d1", Tenant: "t1"}},
+	}
+	for _, test := range tests {
+		got := MapRole(test.groups, rules, test.domain)
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("groups %v in %q: role = %+v, want %+v", test.groups, test.domain, got, test.want)
+		}
+	}
+}
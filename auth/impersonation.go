@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"files-back/dbase/dbimpersonations"
+	"files-back/dbase/dbtokens"
+	"files-back/handlers"
+	"files-back/handlers/incoming"
+	"files-back/handlers/params"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	ImpersonationTTL = time.Minute * 30
+	AuditTimeout     = time.Second * 5
+)
+
+var (
+	ImpersonationDenied = errors.New("only full admins may impersonate")
+	BadImpersonation    = errors.New("only tenant users may be impersonated")
+	Impersonating       = errors.New("not allowed while impersonating")
+)
+
+type ImpersonationToken struct {
+	Token     string `json:"token"`
+	Expires   string `json:"expires"`
+	SessionID string `json:"sessionId"`
+	Subject   string `json:"subject"`
+}
+
+type ImpersonationJSON struct {
+	*dbimpersonations.DBStruct
+	Log []*dbimpersonations.RequestStruct `json:"log"`
+}
+
+type auditRecorder struct {
+	http.ResponseWriter
+	request dbimpersonations.RequestStruct
+	status  int
+}
+
+func (a *auditRecorder) WriteHeader(status int) {
+	a.status = status
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditRecorder) finish() {
+	ctx, cancel := context.WithTimeout(context.Background(), AuditTimeout)
+	defer cancel()
+	a.request.Status = &a.status
+	if err := dbimpersonations.RecordStatus(ctx, &a.request); err != nil {
+		log.Println(err)
+	}
+}
+
+func Impersonate(w http.ResponseWriter, r *http.Request) {
+	impersonator := principalFrom(r)
+	if impersonator.Type != RoleFullAdmin || impersonator.ServiceAccount || impersonator.Impersonator != "" {
+		handlers.StatusForbidden(ImpersonationDenied, w)
+		return
+	}
+	var n incoming.Impersonation
+	if err := incoming.Extract(r, &n); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	subject, err := LookupPrincipal(r.Context(), n.Email)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	switch subject.Type {
+	case RoleDomainAdmin, RoleTenantAdmin, RoleRegular:
+	default:
+		handlers.StatusForbidden(BadImpersonation, w)
+		return
+	}
+	ttl := ImpersonationTTL
+	if n.Minutes > 0 {
+		ttl = time.Duration(n.Minutes) * time.Minute
+	}
+	session := dbimpersonations.DBStruct{
+		ID:           randomID(),
+		Impersonator: impersonator.Username,
+		Subject:      subject.Username,
+		Domain:       subject.Domain,
+		Tenant:       subject.Tenant,
+		Reason:       n.Reason,
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+	if err := dbimpersonations.Insert(r.Context(), &session); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	token, err := signClaims(jwt.MapClaims{
+		"username":     subject.Username,
+		"impersonator": impersonator.Username,
+		"jti":          session.ID,
+		"exp":          session.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, ImpersonationToken{
+		Token:     token,
+		Expires:   session.ExpiresAt.Format(time.RFC3339),
+		SessionID: session.ID,
+		Subject:   subject.Username,
+	})
+}
+
+func ListImpersonations(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	sessions, err := dbimpersonations.Query(r.Context(), dbimpersonations.Filter{
+		Domain: p.DomainName,
+		Tenant: p.TenantName,
+	})
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, sessions)
+}
+
+func GetImpersonation(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	id := mux.Vars(r)["sessionID"]
+	sessions, err := dbimpersonations.Query(r.Context(), dbimpersonations.Filter{
+		ID:     &id,
+		Domain: p.DomainName,
+		Tenant: p.TenantName,
+	})
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if len(sessions) == 0 {
+		handlers.StatusNotFound(errors.New("impersonation session not found"), w)
+		return
+	}
+	requests, err := dbimpersonations.QueryRequests(r.Context(), id)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, ImpersonationJSON{DBStruct: sessions[0], Log: requests})
+}
+
+func EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	session, err := dbimpersonations.End(r.Context(), mux.Vars(r)["sessionID"])
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	revoked := dbtokens.RevokedStruct{ID: session.ID, ExpiresAt: session.ExpiresAt}
+	if err := RefreshTokens.Revoke(r.Context(), &revoked); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	revocations.mark(revoked.ID, revoked.ExpiresAt)
+	handlers.StatusDeleted(w)
+}
+
+func startImpersonated(w http.ResponseWriter, r *http.Request, principal *Principal) (*auditRecorder, error) {
+	recorder := auditRecorder{
+		ResponseWriter: w,
+		request: dbimpersonations.RequestStruct{
+			SessionID: principal.SessionID,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+		},
+		status: http.StatusOK,
+	}
+	if err := dbimpersonations.RecordRequest(r.Context(), &recorder.request); err != nil {
+		return nil, err
+	}
+	return &recorder, nil
+}
+
+func denyImpersonated(w http.ResponseWriter, principal *Principal) bool {
+	if principal.Impersonator == "" {
+		return false
+	}
+	handlers.StatusForbidden(Impersonating, w)
+	return true
+}
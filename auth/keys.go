@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"files-back/handlers"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+var (
+	KeyDir      string
+	ActiveKeyID string
+	keys        = keyRing{byID: map[string]*signingKey{}}
+)
+
+var (
+	UnknownKey     = errors.New("unknown signing key")
+	UnsupportedKey = errors.New("unsupported key type")
+)
+
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+type keyRing struct {
+	mu     sync.RWMutex
+	byID   map[string]*signingKey
+	active *signingKey
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func LoadKeys() error {
+	if KeyDir == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(KeyDir, "*"+privateKeySuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	var private, public []string
+	for _, file := range files {
+		if strings.HasSuffix(file, publicKeySuffix) {
+			public = append(public, file)
+		} else {
+			private = append(private, file)
+		}
+	}
+	byID := map[string]*signingKey{}
+	var active *signingKey
+	for _, file := range private {
+		key, err := readKey(file, privateKeySuffix)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		byID[key.ID] = key
+		if key.Private != nil && (ActiveKeyID == "" || ActiveKeyID == key.ID) {
+			active = key
+		}
+	}
+	for _, file := range public {
+		key, err := readKey(file, publicKeySuffix)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if _, ok := byID[key.ID]; !ok {
+			byID[key.ID] = key
+		}
+	}
+	if ActiveKeyID != "" && active == nil {
+		return fmt.Errorf("%s: %w", ActiveKeyID, UnknownKey)
+	}
+	keys.mu.Lock()
+	keys.byID = byID
+	keys.active = active
+	keys.mu.Unlock()
+	return nil
+}
+
+func readKey(file, suffix string) (*signingKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, UnsupportedKey
+	}
+	key := signingKey{ID: strings.TrimSuffix(filepath.Base(file), suffix)}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, UnsupportedKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = SigningMethodEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PublicKey:
+		key.Method, key.Public = SigningMethodEdDSA, k
+	default:
+		return nil, UnsupportedKey
+	}
+	return &key, nil
+}
+
+func activeKey() *signingKey {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	return keys.active
+}
+
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(SecretKey) == 0 {
+			return nil, UnknownKey
+		}
+		return SecretKey, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	keys.mu.RLock()
+	key, ok := keys.byID[kid]
+	keys.mu.RUnlock()
+	if !ok || key.Method.Alg() != token.Method.Alg() {
+		return nil, UnknownKey
+	}
+	return key.Public, nil
+}
+
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	keys.mu.RLock()
+	ids := make([]string, 0, len(keys.byID))
+	for id := range keys.byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range ids {
+		key := keys.byID[id]
+		jwk := JWK{
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+		}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	keys.mu.RUnlock()
+	handlers.ResponseJSON(w, set)
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func withKeyDir(t *testing.T) string {
+	withTokens(t, nil)
+	dir, activeID := KeyDir, ActiveKeyID
+	keys.mu.RLock()
+	byID, active := keys.byID, keys.active
+	keys.mu.RUnlock()
+	KeyDir, ActiveKeyID = t.TempDir(), ""
+	t.Cleanup(func() {
+		KeyDir, ActiveKeyID = dir, activeID
+		keys.mu.Lock()
+		keys.byID, keys.active = byID, active
+		keys.mu.Unlock()
+	})
+	return KeyDir
+}
+
+func writeKey(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(KeyDir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePrivateKey(t *testing.T, id string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, id+privateKeySuffix, "PRIVATE KEY", der)
+}
+
+func writePublicKey(t *testing.T, id string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, id+publicKeySuffix, "PUBLIC KEY", der)
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func loadKeys(t *testing.T, activeID string) {
+	t.Helper()
+	ActiveKeyID = activeID
+	if err := LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signedWith(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"username": "user@d1.com"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func tokenHeader(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Header
+}
+
+func TestLoadKeys(t *testing.T) {
+	withKeyDir(t)
+	rsaKey, edKey, publicOnly := newRSAKey(t), newEd25519Key(t), newEd25519Key(t)
+	writePrivateKey(t, "a", rsaKey)
+	writePublicKey(t, "a", &rsaKey.PublicKey)
+	writePrivateKey(t, "b", edKey)
+	writePublicKey(t, "c", publicOnly.Public())
+
+	loadKeys(t, "")
+	if len(keys.byID) != 3 {
+		t.Fatalf("loaded %d keys, want 3", len(keys.byID))
+	}
+	tests := []struct {
+		id      string
+		alg     string
+		private bool
+	}{
+		{"a", "RS256", true},
+		{"b", "EdDSA", true},
+		{"c", "EdDSA", false},
+	}
+	for _, test := range tests {
+		key, ok := keys.byID[test.id]
+		if !ok {
+			t.Errorf("%s: not loaded", test.id)
+			continue
+		}
+		if key.Method.Alg() != test.alg || (key.Private != nil) != test.private {
+			t.Errorf("%s: alg = %s, private = %v", test.id, key.Method.Alg(), key.Private != nil)
+		}
+	}
+	if active := activeKey(); active == nil || active.ID != "b" {
+		t.Errorf("active = %+v, want the last private key", active)
+	}
+
+	loadKeys(t, "a")
+	if active := activeKey(); active == nil || active.ID != "a" {
+		t.Errorf("active = %+v, want a", active)
+	}
+	for _, id := range []string{"c", "missing"} {
+		ActiveKeyID = id
+		if err := LoadKeys(); !errors.Is(err, UnknownKey) {
+			t.Errorf("ActiveKeyID %s: err = %v, want %v", id, err, UnknownKey)
+		}
+	}
+	if active := activeKey(); active == nil || active.ID != "a" {
+		t.Errorf("failed load replaced the key ring: active = %+v", active)
+	}
+
+	writeKey(t, "bad.pem", "CERTIFICATE", []byte("junk"))
+	ActiveKeyID = ""
+	if err := LoadKeys(); !errors.Is(err, UnsupportedKey) {
+		t.Errorf("unsupported key: err = %v, want %v", err, UnsupportedKey)
+	}
+}
+
+func TestSigningKeyID(t *testing.T) {
+	withKeyDir(t)
+	writePrivateKey(t, "a", newRSAKey(t))
+	writePrivateKey(t, "b", newEd25519Key(t))
+	for _, test := range []struct{ kid, alg string }{{"a", "RS256"}, {"b", "EdDSA"}} {
+		loadKeys(t, test.kid)
+		token, _, err := GenerateToken("user@d1.com", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := tokenHeader(t, token)
+		if header["kid"] != test.kid || header["alg"] != test.alg {
+			t.Errorf("header = %v, want kid %s and alg %s", header, test.kid, test.alg)
+		}
+		if _, err := parseClaims(token); err != nil {
+			t.Errorf("%s: %v", test.kid, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	withKeyDir(t)
+	writePrivateKey(t, "2020", newRSAKey(t))
+	loadKeys(t, "")
+	old, _, err := GenerateToken("user@d1.com", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePrivateKey(t, "2021", newEd25519Key(t))
+	loadKeys(t, "")
+	current, _, err := GenerateToken("user@d1.com", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenHeader(t, current)["kid"]; kid != "2021" {
+		t.Errorf("kid = %v, want 2021", kid)
+	}
+	for _, token := range []string{old, current} {
+		if _, err := parseClaims(token); err != nil {
+			t.Errorf("token with kid %v: %v", tokenHeader(t, token)["kid"], err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(KeyDir, "2020"+privateKeySuffix)); err != nil {
+		t.Fatal(err)
+	}
+	loadKeys(t, "")
+	if _, err := parseClaims(old); err == nil {
+		t.Error("token signed by a retired key still verifies")
+	}
+	if _, err := parseClaims(current); err != nil {
+		t.Errorf("current token: %v", err)
+	}
+}
+
+func TestVerificationKeyMismatch(t *testing.T) {
+	withKeyDir(t)
+	rsaKey, edKey := newRSAKey(t), newEd25519Key(t)
+	writePrivateKey(t, "a", rsaKey)
+	writePublicKey(t, "a", &rsaKey.PublicKey)
+	writePrivateKey(t, "b", edKey)
+	loadKeys(t, "")
+	publicPEM, err := ioutil.ReadFile(filepath.Join(KeyDir, "a"+publicKeySuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"EdDSA under an RSA kid", signedWith(t, SigningMethodEdDSA, "a", edKey)},
+		{"RS256 under an Ed25519 kid", signedWith(t, jwt.SigningMethodRS256, "b", rsaKey)},
+		{"unknown kid", signedWith(t, jwt.SigningMethodRS256, "z", rsaKey)},
+		{"missing kid", signedWith(t, jwt.SigningMethodRS256, "", rsaKey)},
+		{"HS256 keyed with the key file", signedWith(t, jwt.SigningMethodHS256, "a", publicPEM)},
+	}
+	for _, test := range tests {
+		if _, err := parseClaims(test.token); err == nil {
+			t.Errorf("%s: token accepted", test.name)
+		}
+	}
+	if _, err := parseClaims(signedWith(t, jwt.SigningMethodRS256, "a", rsaKey)); err != nil {
+		t.Errorf("matching kid and alg: %v", err)
+	}
+
+	secret := signedWith(t, jwt.SigningMethodHS256, "", SecretKey)
+	if _, err := parseClaims(secret); err != nil {
+		t.Errorf("HS256 with the shared secret: %v", err)
+	}
+	SecretKey = nil
+	if _, err := parseClaims(secret); err == nil {
+		t.Error("HS256 accepted without a shared secret")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	withKeyDir(t)
+	rsaKey, edKey := newRSAKey(t), newEd25519Key(t)
+	writePrivateKey(t, "b", rsaKey)
+	writePublicKey(t, "a", edKey.Public())
+	loadKeys(t, "")
+
+	w := httptest.NewRecorder()
+	JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	var set JWKSet
+	if err := json.NewDecoder(w.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("keys = %+v, want 2", set.Keys)
+	}
+	okp, rsaJWK := set.Keys[0], set.Keys[1]
+	if okp.KeyID != "a" || okp.KeyType != "OKP" || okp.Curve != "Ed25519" || okp.Algorithm != "EdDSA" || okp.Use != "sig" {
+		t.Errorf("Ed25519 key = %+v", okp)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(okp.X); !ed25519.PublicKey(x).Equal(edKey.Public()) {
+		t.Errorf("Ed25519 x = %s", okp.X)
+	}
+	if rsaJWK.KeyID != "b" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" || rsaJWK.Use != "sig" || rsaJWK.X != "" {
+		t.Errorf("RSA key = %+v", rsaJWK)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	if new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(rsaKey.E) {
+		t.Errorf("RSA n/e = %s/%s", rsaJWK.N, rsaJWK.E)
+	}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+type Limiter struct {
+	Clock           Clock
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*limiterEntry
+}
+
+type limiterEntry struct {
+	failures    int
+	lastFailure time.Time
+	nextAttempt time.Time
+	lockedUntil time.Time
+}
+
+type Lockout struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+func NewLimiter(clock Clock, maxAttempts int) *Limiter {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Limiter{
+		Clock:           clock,
+		MaxAttempts:     maxAttempts,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: time.Minute * 15,
+		Window:          time.Hour,
+		entries:         map[string]*limiterEntry{},
+	}
+}
+
+func (l *Limiter) Check(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Clock.Now()
+	e := l.entry(key, now)
+	if e == nil {
+		return 0
+	}
+	switch {
+	case now.Before(e.lockedUntil):
+		return e.lockedUntil.Sub(now)
+	case now.Before(e.nextAttempt):
+		return e.nextAttempt.Sub(now)
+	default:
+		return 0
+	}
+}
+
+func (l *Limiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Clock.Now()
+	e := l.entry(key, now)
+	if e == nil {
+		e = &limiterEntry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if l.MaxAttempts > 0 && e.failures >= l.MaxAttempts {
+		e.lockedUntil = now.Add(l.LockoutDuration)
+		return
+	}
+	delay := l.BaseDelay
+	for i := 1; i < e.failures && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.MaxDelay {
+		delay = l.MaxDelay
+	}
+	e.nextAttempt = now.Add(delay)
+}
+
+func (l *Limiter) Reset(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.entries[key]
+	delete(l.entries, key)
+	return ok
+}
+
+func (l *Limiter) Sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Clock.Now()
+	for key := range l.entries {
+		l.entry(key, now)
+	}
+}
+
+func (l *Limiter) Lockouts() []Lockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Clock.Now()
+	res := []Lockout{}
+	for key := range l.entries {
+		e := l.entry(key, now)
+		if e != nil && now.Before(e.lockedUntil) {
+			res = append(res, Lockout{
+				Key:         key,
+				Failures:    e.failures,
+				LockedUntil: e.lockedUntil,
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+func (l *Limiter) entry(key string, now time.Time) *limiterEntry {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	lockExpired := !e.lockedUntil.IsZero() && !now.Before(e.lockedUntil)
+	if lockExpired || (e.lockedUntil.IsZero() && now.Sub(e.lastFailure) > l.Window) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
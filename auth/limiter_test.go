@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(clock, 0)
+	l.MaxDelay = time.Second * 5
+	want := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5}
+	for i, delay := range want {
+		l.Fail("user")
+		if wait := l.Check("user"); wait != delay {
+			t.Errorf("failure %d: wait = %v, want %v", i+1, wait, delay)
+		}
+	}
+	clock.Advance(time.Second * 5)
+	if wait := l.Check("user"); wait != 0 {
+		t.Errorf("after delay: wait = %v, want 0", wait)
+	}
+	if wait := l.Check("other"); wait != 0 {
+		t.Errorf("other key: wait = %v, want 0", wait)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(clock, 3)
+	for i := 0; i < 3; i++ {
+		l.Fail("user")
+		clock.Advance(time.Minute)
+	}
+	if wait := l.Check("user"); wait != l.LockoutDuration-time.Minute {
+		t.Errorf("locked: wait = %v, want %v", wait, l.LockoutDuration-time.Minute)
+	}
+	lockouts := l.Lockouts()
+	if len(lockouts) != 1 || lockouts[0].Key != "user" || lockouts[0].Failures != 3 {
+		t.Errorf("lockouts = %+v", lockouts)
+	}
+	clock.Advance(l.LockoutDuration)
+	if wait := l.Check("user"); wait != 0 {
+		t.Errorf("after lockout: wait = %v, want 0", wait)
+	}
+	if lockouts := l.Lockouts(); len(lockouts) != 0 {
+		t.Errorf("expired lockouts listed: %+v", lockouts)
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	l := NewLimiter(newFakeClock(), 1)
+	l.Fail("user")
+	if l.Check("user") == 0 {
+		t.Fatal("user should be locked")
+	}
+	if !l.Reset("user") {
+		t.Error("Reset should report an existing entry")
+	}
+	if l.Check("user") != 0 {
+		t.Error("user should be unlocked after reset")
+	}
+	if l.Reset("user") {
+		t.Error("Reset should report a missing entry")
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(clock, 3)
+	l.Fail("user")
+	l.Fail("user")
+	clock.Advance(l.Window + time.Second)
+	l.Fail("user")
+	if wait := l.Check("user"); wait != l.BaseDelay {
+		t.Errorf("failures outside the window should be forgotten: wait = %v", wait)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(clock, 2)
+	l.Window = time.Minute
+	for i := 0; i < 1000; i++ {
+		l.Fail(string(rune('a'+i%26)) + time.Duration(i).String())
+	}
+	l.Fail("locked")
+	l.Fail("locked")
+	clock.Advance(time.Minute * 2)
+	l.Sweep()
+	if len(l.entries) != 1 {
+		t.Fatalf("entries after sweep = %d, want 1", len(l.entries))
+	}
+	clock.Advance(l.LockoutDuration)
+	l.Sweep()
+	if len(l.entries) != 0 {
+		t.Errorf("entries after lockout expiry = %d, want 0", len(l.entries))
+	}
+}
@@ -1,38 +1,67 @@
 package auth
 
 import (
-	"encoding/json"
-	"files-back/auth/directory"
+	"errors"
 	"files-back/handlers"
-	"github.com/go-ldap/ldap/v3"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 func Login(w http.ResponseWriter, r *http.Request) {
-	var IncomeAuth incomingJSON
-	err := json.NewDecoder(r.Body).Decode(&IncomeAuth)
-	if err != nil {
-		handlers.StatusBadData(err, w)
-		return
-	}
+	LoginWith(Throttled{PasswordBackend})(w, r)
+}
+
+func LoginWith(authenticator Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, err := authenticator.Authenticate(r)
+		if err != nil {
+			recordAttempt(r, authenticator.Name(), attemptedUsername(err), "", err)
+			var throttled *ThrottledError
+			switch {
+			case errors.As(err, &throttled):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.Wait.Seconds()))))
+				handlers.StatusTooManyRequests(err, w)
+			case errors.Is(err, BadLogin):
+				handlers.StatusBadData(err, w)
+			case errors.Is(err, InvalidCredentials):
+				handlers.StatusInvalidCredentials(err, w)
+			default:
+				handlers.StatusError(err, w)
+			}
+			return
+		}
 
-	err = directory.CheckAuth(IncomeAuth.Username, IncomeAuth.Password)
-	if err != nil {
-		switch {
-		case ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials):
-			handlers.StatusInvalidCredentials(err, w)
-		default:
-			handlers.StatusError(err, w)
+		required, err := secondFactorRequired(r.Context(), identity.Username)
+		if err != nil {
+			handlers.ReturnError(w, err)
+			return
 		}
-		return
+		if required {
+			challenge, err := issueChallenge(identity, loginMethod(authenticator, identity))
+			if err != nil {
+				handlers.ReturnError(w, err)
+				return
+			}
+			handlers.ResponseJSON(w, challenge)
+			return
+		}
+
+		familyID := randomID()
+		token, err := issueToken(r.Context(), identity, familyID)
+		if err != nil {
+			handlers.ReturnError(w, err)
+			return
+		}
+		recordAttempt(r, loginMethod(authenticator, identity), identity.Username, familyID, nil)
+		token.Name = identity.DisplayName
+		handlers.ResponseJSON(w, token)
 	}
+}
 
-	token, err := GenerateToken(IncomeAuth.Username)
-	if err != nil {
-		handlers.ReturnError(w, err)
+func loginMethod(authenticator Authenticator, identity *Identity) string {
+	if identity.Method != "" {
+		return identity.Method
 	}
-	handlers.ResponseJSON(w, Token{
-		Token:   token,
-		Expires: "",
-	})
+	return authenticator.Name()
 }
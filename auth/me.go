@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"files-back/dbase/dbusers"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type Action struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+type MeJSON struct {
+	Email          string   `json:"email"`
+	DisplayName    *string  `json:"name,omitempty"`
+	Type           string   `json:"type"`
+	Tenant         string   `json:"tenant,omitempty"`
+	Domain         string   `json:"domain,omitempty"`
+	Tariff         string   `json:"tariff,omitempty"`
+	ServiceAccount bool     `json:"serviceAccount,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
+	ImpersonatedBy string   `json:"impersonatedBy,omitempty"`
+	Actions        []Action `json:"actions"`
+}
+
+func Me(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFrom(r)
+		me := MeJSON{
+			Email:          principal.Username,
+			Type:           principal.Type,
+			Tenant:         principal.Tenant,
+			Domain:         principal.Domain,
+			ServiceAccount: principal.ServiceAccount,
+			Scopes:         principal.Scopes,
+			ImpersonatedBy: principal.Impersonator,
+		}
+		if !principal.ServiceAccount {
+			user, err := dbusers.QueryByEmail(r.Context(), principal.Username)
+			switch {
+			case err == nil:
+				me.DisplayName = user.DisplayName
+				if user.Tariff != nil {
+					me.Tariff = user.Tariff.Name
+				}
+			case !errors.Is(err, sql.ErrNoRows):
+				handlers.ReturnError(w, err)
+				return
+			}
+		}
+		actions, err := AllowedActions(principal, router)
+		if err != nil {
+			handlers.StatusError(err, w)
+			return
+		}
+		me.Actions = actions
+		handlers.ResponseJSON(w, me)
+	}
+}
+
+func AllowedActions(p *Principal, router *mux.Router) ([]Action, error) {
+	known := map[string]string{
+		"domainName": p.Domain,
+		"tenantName": p.Tenant,
+	}
+	if p.Type == RoleRegular {
+		known["email"] = p.Username
+	}
+	actions := []Action{}
+	seen := map[Action]bool{}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		resource := strings.SplitN(strings.TrimPrefix(tpl, "/"), "/", 2)[0]
+		if !managedResource(resource) {
+			return nil
+		}
+		vars := map[string]string{}
+		path := tpl
+		for name, value := range known {
+			if value != "" && strings.Contains(tpl, "{"+name+"}") {
+				vars[name] = value
+				path = strings.Replace(path, "{"+name+"}", value, 1)
+			}
+		}
+		for _, method := range methods {
+			req, err := http.NewRequest(method, "/", nil)
+			if err != nil {
+				return err
+			}
+			req.URL.Path = tpl
+			req = mux.SetURLVars(req, vars)
+			allowed := Allowed(p, req)
+			if resource == "tokens" || resource == "me" {
+				allowed = scopeAllowed(p, req)
+			}
+			action := Action{Method: method, Path: path}
+			if allowed && !seen[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+		return nil
+	})
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Path == actions[j].Path {
+			return actions[i].Method < actions[j].Method
+		}
+		return actions[i].Path < actions[j].Path
+	})
+	return actions, err
+}
+
+func managedResource(resource string) bool {
+	for _, known := range scopeResources {
+		if resource == known {
+			return true
+		}
+	}
+	return false
+}
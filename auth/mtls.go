@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"files-back/dbase/dbserviceaccounts"
+	"io/ioutil"
+	"net/http"
+)
+
+var LookupCertificate = lookupCertificate
+
+func lookupCertificate(ctx context.Context, certificate *x509.Certificate) (*Principal, error) {
+	account, err := dbserviceaccounts.QueryByCertificate(ctx, CertificateIdentities(certificate))
+	if err != nil {
+		return nil, err
+	}
+	return serviceAccountPrincipal(account), nil
+}
+
+func CertificateIdentities(certificate *x509.Certificate) []string {
+	identities := []string{certificate.Subject.String()}
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, "CN="+certificate.Subject.CommonName)
+	}
+	for _, name := range certificate.DNSNames {
+		identities = append(identities, "DNS:"+name)
+	}
+	for _, email := range certificate.EmailAddresses {
+		identities = append(identities, "email:"+email)
+	}
+	for _, uri := range certificate.URIs {
+		identities = append(identities, "URI:"+uri.String())
+	}
+	return identities
+}
+
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+func ClientTLSConfig(clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, BadCertificate
+	}
+	config.ClientCAs = roots
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	key         *ecdsa.PrivateKey
+	certificate *x509.Certificate
+	serial      int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{key: key, certificate: certificate, serial: 1}
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template.SerialNumber = big.NewInt(ca.serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) file(t *testing.T) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw})
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func withCertificates(t *testing.T, accounts map[string]*Principal) {
+	lookup := LookupCertificate
+	LookupCertificate = func(ctx context.Context, certificate *x509.Certificate) (*Principal, error) {
+		for _, identity := range CertificateIdentities(certificate) {
+			if p, ok := accounts[identity]; ok {
+				copied := *p
+				return &copied, nil
+			}
+		}
+		return nil, sql.ErrNoRows
+	}
+	t.Cleanup(func() {
+		LookupCertificate = lookup
+	})
+}
+
+func newMTLSServer(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	config, err := ClientTLSConfig(ca.file(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(Authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		_, _ = w.Write([]byte(principal.Username))
+	})))
+	server.TLS = config
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func mtlsGet(t *testing.T, server *httptest.Server, certificates ...tls.Certificate) (string, error) {
+	t.Helper()
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = certificates
+	defer transport.CloseIdleConnections()
+	response, err := (&http.Client{Transport: transport}).Get(server.URL + "/users")
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	return string(body), err
+}
+
+func TestClientCertificateServiceAccounts(t *testing.T) {
+	withCertificates(t, map[string]*Principal{
+		"CN=backup":                   {Username: "backup", Type: RoleRegular, Domain: "d1", Tenant: "t1", ServiceAccount: true},
+		"DNS:sync.d1.com":             {Username: "sync", Type: RoleRegular, Domain: "d1", Tenant: "t1", ServiceAccount: true},
+		"URI:spiffe://d1.com/monitor": {Username: "monitor", Type: RoleRegular, Domain: "d1", Tenant: "t1", ServiceAccount: true},
+	})
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+	monitor, err := url.Parse("spiffe://d1.com/monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		template *x509.Certificate
+		want     string
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "backup", Organization: []string{"d1"}}}, "backup"},
+		{"dns name", &x509.Certificate{Subject: pkix.Name{CommonName: "client"}, DNSNames: []string{"sync.d1.com"}}, "sync"},
+		{"uri", &x509.Certificate{URIs: []*url.URL{monitor}}, "monitor"},
+	}
+	for _, test := range tests {
+		body, err := mtlsGet(t, server, ca.issue(t, test.template))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if body != test.want {
+			t.Errorf("%s: principal = %q, want %q", test.name, body, test.want)
+		}
+	}
+}
+
+func TestClientCertificateRejected(t *testing.T) {
+	withCertificates(t, map[string]*Principal{
+		"CN=backup": {Username: "backup", Type: RoleRegular, Domain: "d1", Tenant: "t1", ServiceAccount: true},
+	})
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+
+	body, err := mtlsGet(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, `"Code":401`) {
+		t.Errorf("no certificate: body = %s", body)
+	}
+	body, err = mtlsGet(t, server, ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, `"Code":401`) {
+		t.Errorf("unknown subject: body = %s", body)
+	}
+	untrusted := newTestCA(t).issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "backup"}})
+	if body, err := mtlsGet(t, server, untrusted); err == nil {
+		t.Errorf("untrusted issuer accepted: body = %s", body)
+	}
+}
+
+func TestCertificateIdentities(t *testing.T) {
+	ca := newTestCA(t)
+	issued := ca.issue(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "svc", Organization: []string{"d1"}},
+		DNSNames:       []string{"svc.d1.com"},
+		EmailAddresses: []string{"svc@d1.com"},
+	})
+	certificate, err := x509.ParseCertificate(issued.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(CertificateIdentities(certificate), "|")
+	if want := "CN=svc,O=d1|CN=svc|DNS:svc.d1.com|email:svc@d1.com"; got != want {
+		t.Errorf("identities = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var BadHeader = errors.New("line break in message header")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+type Notifier interface {
+	Send(message Message) error
+}
+
+type SMTP struct {
+	Address  string
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTP) Send(message Message) error {
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return BadHeader
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", s.From)
+	fmt.Fprintf(&body, "To: %s\r\n", message.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(message.Body)
+	return smtp.SendMail(s.Address, auth, s.From, []string{message.To}, []byte(body.String()))
+}
+
+type Sink struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *Sink) Send(message Message) error {
+	message.SentAt = time.Now()
+	s.mu.Lock()
+	s.messages = append(s.messages, message)
+	s.mu.Unlock()
+	log.Printf("notification to %s: %s", message.To, message.Subject)
+	return nil
+}
+
+func (s *Sink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Sink) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"files-back/handlers"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	OIDCBackend    *OIDC
+	OIDCStateTTL   = time.Minute * 10
+	OIDCKeyRefresh = time.Minute
+	defaultScopes  = []string{"openid", "email", "profile"}
+	UnknownState   = errors.New("unknown or expired oidc state")
+	UnverifiedMail = errors.New("email is not verified")
+)
+
+type OIDC struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu        sync.Mutex
+	provider  *oidcProvider
+	keys      map[string]interface{}
+	keysFetch time.Time
+	pending   map[string]oidcPending
+}
+
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPending struct {
+	verifier string
+	nonce    string
+	expires  time.Time
+}
+
+type oidcTokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+func (o *OIDC) Name() string {
+	return "oidc"
+}
+
+func (o *OIDC) Start(w http.ResponseWriter, r *http.Request) {
+	provider, err := o.discover()
+	if err != nil {
+		handlers.StatusError(err, w)
+		return
+	}
+	state, verifier, nonce := randomToken(), randomToken(), randomToken()
+	o.mu.Lock()
+	o.prune()
+	o.pending[state] = oidcPending{
+		verifier: verifier,
+		nonce:    nonce,
+		expires:  time.Now().Add(OIDCStateTTL),
+	}
+	o.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	scopes := o.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+func (o *OIDC) Authenticate(r *http.Request) (*Identity, error) {
+	query := r.URL.Query()
+	if idpError := query.Get("error"); idpError != "" {
+		return nil, fmt.Errorf("%w: %s", InvalidCredentials, idpError)
+	}
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		return nil, fmt.Errorf("%w: missing state or code", BadLogin)
+	}
+	o.mu.Lock()
+	pending, ok := o.pending[state]
+	delete(o.pending, state)
+	o.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, fmt.Errorf("%w: %v", InvalidCredentials, UnknownState)
+	}
+
+	provider, err := o.discover()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := o.exchange(provider, code, pending.verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := o.verify(provider, idToken, pending.nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCredentials, err)
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, fmt.Errorf("%w: %v", InvalidCredentials, UnverifiedMail)
+	}
+	email := strings.ToLower(claimString(claims, "email"))
+	if email == "" {
+		return nil, fmt.Errorf("%w: no email claim", InvalidCredentials)
+	}
+	principal, err := LookupPrincipal(r.Context(), email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %v", InvalidCredentials, err)
+		}
+		return nil, err
+	}
+	return &Identity{
+		Username:    principal.Username,
+		DisplayName: claimString(claims, "name"),
+		Method:      o.Name(),
+	}, nil
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+	return http.DefaultClient
+}
+
+func (o *OIDC) prune() {
+	if o.pending == nil {
+		o.pending = map[string]oidcPending{}
+	}
+	now := time.Now()
+	for state, pending := range o.pending {
+		if now.After(pending.expires) {
+			delete(o.pending, state)
+		}
+	}
+}
+
+func (o *OIDC) discover() (*oidcProvider, error) {
+	o.mu.Lock()
+	provider := o.provider
+	o.mu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+	var discovered oidcProvider
+	err := o.getJSON(strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &discovered)
+	if err != nil {
+		return nil, err
+	}
+	if discovered.Issuer != o.Issuer {
+		return nil, fmt.Errorf("oidc issuer mismatch: %s", discovered.Issuer)
+	}
+	o.mu.Lock()
+	o.provider = &discovered
+	o.mu.Unlock()
+	return &discovered, nil
+}
+
+func (o *OIDC) exchange(provider *oidcProvider, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.RedirectURL},
+		"client_id":     {o.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return "", fmt.Errorf("%w: token endpoint: %s %s", InvalidCredentials, resp.Status, token.Error)
+	}
+	return token.IDToken, nil
+}
+
+func (o *OIDC) verify(provider *oidcProvider, idToken, nonce string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			return nil, UnknownKey
+		}
+		kid, _ := token.Header["kid"].(string)
+		return o.publicKey(provider, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, BadToken
+	}
+	if !claims.VerifyIssuer(o.Issuer, true) {
+		return nil, fmt.Errorf("%w: issuer", BadToken)
+	}
+	if !audienceContains(claims["aud"], o.ClientID) {
+		return nil, fmt.Errorf("%w: audience", BadToken)
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce", BadToken)
+	}
+	return claims, nil
+}
+
+func (o *OIDC) publicKey(provider *oidcProvider, kid string) (interface{}, error) {
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	recent := time.Since(o.keysFetch) < OIDCKeyRefresh
+	if !ok && !recent {
+		o.keysFetch = time.Now()
+	}
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if recent {
+		return nil, UnknownKey
+	}
+	var set JWKSet
+	if err := o.getJSON(provider.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	fetched := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if publicKey, err := jwk.PublicKey(); err == nil {
+			fetched[jwk.KeyID] = publicKey
+		}
+	}
+	o.mu.Lock()
+	o.keys = fetched
+	o.mu.Unlock()
+	if key, ok := fetched[kid]; ok {
+		return key, nil
+	}
+	return nil, UnknownKey
+}
+
+func (o *OIDC) getJSON(url string, dest interface{}) error {
+	resp, err := o.client().Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+func (jwk JWK) PublicKey() (interface{}, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, UnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, UnsupportedKey
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, UnsupportedKey
+	}
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, item := range value {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
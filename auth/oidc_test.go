@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const stubCode = "stub-code"
+
+type stubIdP struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	kid       string
+	claims    jwt.MapClaims
+	challenge string
+	nonce     string
+	jwksHits  int
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, kid: "k1", claims: jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcProvider{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksHits++
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+			KeyType:   "RSA",
+			KeyID:     "k1",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != stubCode || base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            idp.URL,
+			"aud":            "client",
+			"sub":            "42",
+			"email":          "User@d1.com",
+			"email_verified": true,
+			"name":           "Test User",
+			"nonce":          idp.nonce,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+		for name, value := range idp.claims {
+			claims[name] = value
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = idp.kid
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = json.NewEncoder(w).Encode(oidcTokenResponse{IDToken: signed})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func stubPrincipals(t *testing.T) {
+	lookup := LookupPrincipal
+	LookupPrincipal = func(ctx context.Context, username string) (*Principal, error) {
+		if username != "user@d1.com" {
+			return nil, sql.ErrNoRows
+		}
+		return &Principal{Username: username, Type: RoleRegular, Domain: "d1", Tenant: "t1"}, nil
+	}
+	t.Cleanup(func() {
+		LookupPrincipal = lookup
+	})
+}
+
+func (idp *stubIdP) login(o *OIDC, code string) (*Identity, error) {
+	w := httptest.NewRecorder()
+	o.Start(w, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		return nil, err
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		return nil, errors.New("missing pkce challenge")
+	}
+	idp.challenge, idp.nonce = query.Get("code_challenge"), query.Get("nonce")
+	callback := url.Values{"state": {query.Get("state")}, "code": {code}}
+	return o.Authenticate(httptest.NewRequest(http.MethodGet, "/login/oidc/callback?"+callback.Encode(), nil))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	stubPrincipals(t)
+	idp := newStubIdP(t)
+	o := &OIDC{Issuer: idp.URL, ClientID: "client", RedirectURL: "http://localhost/login/oidc/callback"}
+	identity, err := idp.login(o, stubCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "user@d1.com" || identity.DisplayName != "Test User" || identity.Method != "oidc" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+}
+
+func TestOIDCRejects(t *testing.T) {
+	stubPrincipals(t)
+	tests := []struct {
+		name   string
+		code   string
+		claims jwt.MapClaims
+		kid    string
+	}{
+		{name: "bad code", code: "other"},
+		{name: "unverified email", claims: jwt.MapClaims{"email_verified": false}},
+		{name: "missing email", claims: jwt.MapClaims{"email": ""}},
+		{name: "unknown user", claims: jwt.MapClaims{"email": "nobody@d1.com"}},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "someone-else"}},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example"}},
+		{name: "wrong nonce", claims: jwt.MapClaims{"nonce": "replayed"}},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{name: "unknown key", kid: "k2"},
+	}
+	for _, test := range tests {
+		idp := newStubIdP(t)
+		idp.claims = test.claims
+		if test.kid != "" {
+			idp.kid = test.kid
+		}
+		code := test.code
+		if code == "" {
+			code = stubCode
+		}
+		o := &OIDC{Issuer: idp.URL, ClientID: "client"}
+		if _, err := idp.login(o, code); !errors.Is(err, InvalidCredentials) {
+			t.Errorf("%s: err = %v, want InvalidCredentials", test.name, err)
+		}
+	}
+}
+
+func TestOIDCUnknownState(t *testing.T) {
+	idp := newStubIdP(t)
+	o := &OIDC{Issuer: idp.URL, ClientID: "client"}
+	r := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?state=forged&code="+stubCode, nil)
+	if _, err := o.Authenticate(r); !errors.Is(err, InvalidCredentials) {
+		t.Errorf("err = %v, want InvalidCredentials", err)
+	}
+}
+
+func TestOIDCKeyRefetchLimited(t *testing.T) {
+	stubPrincipals(t)
+	refresh := OIDCKeyRefresh
+	defer func() {
+		OIDCKeyRefresh = refresh
+	}()
+	OIDCKeyRefresh = time.Hour
+	idp := newStubIdP(t)
+	o := &OIDC{Issuer: idp.URL, ClientID: "client"}
+	if _, err := idp.login(o, stubCode); err != nil {
+		t.Fatal(err)
+	}
+	idp.kid = "random"
+	for i := 0; i < 5; i++ {
+		if _, err := idp.login(o, stubCode); err == nil {
+			t.Fatal("token with unknown kid accepted")
+		}
+	}
+	if idp.jwksHits != 1 {
+		t.Errorf("jwks fetched %d times, want 1", idp.jwksHits)
+	}
+	OIDCKeyRefresh = 0
+	if _, err := idp.login(o, stubCode); err == nil {
+		t.Fatal("token with unknown kid accepted")
+	}
+	if idp.jwksHits != 2 {
+		t.Errorf("jwks fetched %d times after refresh window, want 2", idp.jwksHits)
+	}
+}
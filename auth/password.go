@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"files-back/auth/notify"
+	"files-back/dbase/dbpasswordresets"
+	"files-back/handlers"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	Passwords = PasswordPolicy{
+		MinLength:      12,
+		MaxLength:      128,
+		RequireUpper:   true,
+		RequireLower:   true,
+		RequireDigit:   true,
+		ForbidUsername: true,
+	}
+	ResetLimiter                                 = NewLimiter(nil, 5)
+	PasswordResetTTL                             = time.Hour
+	PasswordResetURL                             = "{token}"
+	Notifier         notify.Notifier             = &notify.Sink{}
+	PasswordResets   dbpasswordresets.Repository = dbpasswordresets.SQLRepository{}
+)
+
+var (
+	WeakPassword    = errors.New("password does not meet policy")
+	BadResetToken   = errors.New("invalid or expired reset token")
+	NoPasswordLogin = errors.New("service accounts have no password")
+)
+
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	ForbidUsername bool
+}
+
+type passwordJSON struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+type resetJSON struct {
+	Email       string `json:"email"`
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+func (p PasswordPolicy) Check(username, password string) error {
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", WeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: at most %d characters allowed", WeakPassword, p.MaxLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return fmt.Errorf("%w: an upper case letter is required", WeakPassword)
+	case p.RequireLower && !lower:
+		return fmt.Errorf("%w: a lower case letter is required", WeakPassword)
+	case p.RequireDigit && !digit:
+		return fmt.Errorf("%w: a digit is required", WeakPassword)
+	case p.RequireSymbol && !symbol:
+		return fmt.Errorf("%w: a symbol is required", WeakPassword)
+	}
+	if p.ForbidUsername {
+		name := strings.ToLower(username)
+		if i := strings.Index(name, "@"); i >= 0 {
+			name = name[:i]
+		}
+		if len(name) >= 3 && strings.Contains(strings.ToLower(password), name) {
+			return fmt.Errorf("%w: must not contain the user name", WeakPassword)
+		}
+	}
+	return nil
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	principal := principalFrom(r)
+	if denyImpersonated(w, principal) {
+		return
+	}
+	if principal.ServiceAccount {
+		handlers.StatusForbidden(NoPasswordLogin, w)
+		return
+	}
+	var incomePassword passwordJSON
+	if err := json.NewDecoder(r.Body).Decode(&incomePassword); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	if err := Passwords.Check(principal.Username, incomePassword.NewPassword); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	username := principal.Username
+	if wait := UserLimiter.Check(username); wait > 0 {
+		handlers.StatusTooManyRequests(&ThrottledError{Wait: wait}, w)
+		return
+	}
+	pool, err := DomainDirectory(r.Context(), principal.Domain, username)
+	if err != nil {
+		handlers.StatusDirectoryError(err, w)
+		return
+	}
+	err = pool.ChangePassword(username, incomePassword.OldPassword, incomePassword.NewPassword)
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials):
+		UserLimiter.Fail(username)
+		handlers.StatusInvalidCredentials(err, w)
+		return
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultConstraintViolation):
+		handlers.StatusBadData(fmt.Errorf("%w: %v", WeakPassword, err), w)
+		return
+	case err != nil:
+		handlers.StatusDirectoryError(err, w)
+		return
+	}
+	UserLimiter.Reset(username)
+	if err := revokeSessions(r.Context(), username, currentFamily(r)); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.StatusPasswordChanged(w)
+}
+
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var incomeReset resetJSON
+	if err := json.NewDecoder(r.Body).Decode(&incomeReset); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(incomeReset.Email))
+	if wait := ResetLimiter.Check(email); wait > 0 {
+		handlers.StatusTooManyRequests(&ThrottledError{Wait: wait}, w)
+		return
+	}
+	ResetLimiter.Fail(email)
+	principal, err := LookupPrincipal(r.Context(), email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		handlers.StatusResetRequested(w)
+		return
+	case err != nil:
+		handlers.ReturnError(w, err)
+		return
+	}
+	if !resettable(principal) {
+		handlers.StatusResetRequested(w)
+		return
+	}
+	tokenStr := randomToken()
+	err = PasswordResets.Insert(r.Context(), &dbpasswordresets.DBStruct{
+		TokenHash: hashToken(tokenStr),
+		Email:     principal.Username,
+		ExpiresAt: time.Now().Add(PasswordResetTTL),
+	})
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	err = Notifier.Send(notify.Message{
+		To:      principal.Username,
+		Subject: "Password reset",
+		Body: "A password reset was requested for your account.\r\n\r\n" +
+			strings.Replace(PasswordResetURL, "{token}", tokenStr, 1) + "\r\n\r\n" +
+			"The link expires in " + PasswordResetTTL.String() + " and can be used once.\r\n",
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	handlers.StatusResetRequested(w)
+}
+
+func ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var incomeReset resetJSON
+	if err := json.NewDecoder(r.Body).Decode(&incomeReset); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	if err := Passwords.Check("", incomeReset.NewPassword); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	var email string
+	var directoryErr error
+	err := PasswordResets.Use(r.Context(), hashToken(incomeReset.Token), func(owner string) error {
+		email = owner
+		if err := Passwords.Check(email, incomeReset.NewPassword); err != nil {
+			return err
+		}
+		principal, err := LookupPrincipal(r.Context(), email)
+		if err != nil {
+			return err
+		}
+		if !resettable(principal) {
+			return BadResetToken
+		}
+		pool, err := DomainDirectory(r.Context(), principal.Domain, email)
+		if err != nil {
+			directoryErr = err
+			return err
+		}
+		if err := pool.ResetPassword(email, incomeReset.NewPassword); err != nil {
+			if ldap.IsErrorWithCode(err, ldap.LDAPResultConstraintViolation) {
+				return fmt.Errorf("%w: %v", WeakPassword, err)
+			}
+			directoryErr = err
+			return err
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, BadResetToken):
+		handlers.StatusUnauthorized(BadResetToken, w)
+		return
+	case errors.Is(err, WeakPassword):
+		handlers.StatusBadData(err, w)
+		return
+	case directoryErr != nil:
+		handlers.StatusDirectoryError(err, w)
+		return
+	case err != nil:
+		handlers.ReturnError(w, err)
+		return
+	}
+	if err := PasswordResets.Invalidate(r.Context(), email); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if err := revokeSessions(r.Context(), email, ""); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	UserLimiter.Reset(email)
+	ResetLimiter.Reset(email)
+	handlers.StatusPasswordChanged(w)
+}
+
+func resettable(principal *Principal) bool {
+	return principal.active() && !principal.ServiceAccount
+}
+
+func revokeSessions(ctx context.Context, username, keepFamily string) error {
+	families, err := RevokeUser(ctx, username, keepFamily)
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		revocations.mark(family.FamilyID, family.ExpiresAt)
+	}
+	return nil
+}
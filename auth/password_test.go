@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/auth/notify"
+	"files-back/dbase/dbmemory"
+	"files-back/dbase/dbpasswordresets"
+	"files-back/dbase/dbtokens"
+	"files-back/handlers"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withPasswordResets(t *testing.T) dbpasswordresets.Repository {
+	resets, revokeUser := PasswordResets, RevokeUser
+	PasswordResets = dbmemory.New().PasswordResets()
+	RevokeUser = func(ctx context.Context, username, keepFamily string) ([]dbtokens.DBStruct, error) {
+		return nil, nil
+	}
+	t.Cleanup(func() {
+		PasswordResets, RevokeUser = resets, revokeUser
+	})
+	return PasswordResets
+}
+
+func addReset(t *testing.T, resets dbpasswordresets.Repository, token, email string, ttl time.Duration) {
+	t.Helper()
+	err := resets.Insert(context.Background(), &dbpasswordresets.DBStruct{
+		TokenHash: hashToken(token),
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func confirmReset(t *testing.T, token, password string) (int, int) {
+	t.Helper()
+	body := `{"token":"` + token + `","newPassword":"` + password + `"}`
+	w := httptest.NewRecorder()
+	ConfirmPasswordReset(w, httptest.NewRequest(http.MethodPost, "/password/reset/confirm", strings.NewReader(body)))
+	var status handlers.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, status.Code
+}
+
+func TestConfirmPasswordResetSingleUse(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d2.com": {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+	})
+	server := withDomainDirectory(t, "")
+	resets := withPasswordResets(t)
+	addReset(t, resets, "token", "user@d2.com", time.Hour)
+	addReset(t, resets, "other", "user@d2.com", time.Hour)
+
+	if _, code := confirmReset(t, "token", "Changed12345"); code != http.StatusOK {
+		t.Fatalf("first use: code = %d", code)
+	}
+	if entry := server.Entry("uid=user@d2.com,dc=d2,dc=com"); entry["userpassword"][0] != "Changed12345" {
+		t.Errorf("password = %v", entry["userpassword"])
+	}
+	if _, code := confirmReset(t, "token", "Another12345"); code != http.StatusUnauthorized {
+		t.Errorf("second use: code = %d, want 401", code)
+	}
+	if _, code := confirmReset(t, "other", "Another12345"); code != http.StatusUnauthorized {
+		t.Errorf("sibling token: code = %d, want 401", code)
+	}
+}
+
+func TestConfirmPasswordResetExpired(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d2.com": {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+	})
+	server := withDomainDirectory(t, "")
+	resets := withPasswordResets(t)
+	addReset(t, resets, "token", "user@d2.com", -time.Minute)
+
+	if _, code := confirmReset(t, "token", "Changed12345"); code != http.StatusUnauthorized {
+		t.Errorf("expired token: code = %d, want 401", code)
+	}
+	if entry := server.Entry("uid=user@d2.com,dc=d2,dc=com"); entry["userpassword"][0] != "secret" {
+		t.Errorf("password changed with an expired token: %v", entry["userpassword"])
+	}
+}
+
+func TestConfirmPasswordResetKeepsTokenOnFailure(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d2.com":    {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+		"missing@d2.com": {Username: "missing@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+	})
+	withDomainDirectory(t, "")
+	resets := withPasswordResets(t)
+	addReset(t, resets, "token", "user@d2.com", time.Hour)
+	addReset(t, resets, "missing", "missing@d2.com", time.Hour)
+
+	if _, code := confirmReset(t, "token", "Username12345"); code != http.StatusBadRequest {
+		t.Errorf("weak password: code = %d, want 400", code)
+	}
+	if status, _ := confirmReset(t, "missing", "Changed12345"); status != http.StatusBadGateway {
+		t.Errorf("directory failure: status = %d, want 502", status)
+	}
+	if _, code := confirmReset(t, "token", "Changed12345"); code != http.StatusOK {
+		t.Errorf("retry after weak password: code = %d", code)
+	}
+	if err := resets.Use(context.Background(), hashToken("missing"), func(string) error { return nil }); err != nil {
+		t.Errorf("token consumed by a failed reset: %v", err)
+	}
+}
+
+func withNotifier(t *testing.T) *notify.Sink {
+	notifier, limiter := Notifier, ResetLimiter
+	sink := &notify.Sink{}
+	Notifier, ResetLimiter = sink, NewLimiter(nil, 100)
+	t.Cleanup(func() {
+		Notifier, ResetLimiter = notifier, limiter
+	})
+	return sink
+}
+
+func requestReset(t *testing.T, email string) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	RequestPasswordReset(w, httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(`{"email":"`+email+`"}`)))
+	var status handlers.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status.Code
+}
+
+func TestRequestPasswordResetSkipsInactive(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d2.com":     {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+		"disabled@d2.com": {Username: "disabled@d2.com", Type: typeDisabled, Domain: "d2", Tenant: "t1"},
+		"deleted@d2.com":  {Username: "deleted@d2.com", Type: typeDeleted, Domain: "d2", Tenant: "t1"},
+		"ci@d2.com":       {Username: "ci@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1", ServiceAccount: true},
+	})
+	withPasswordResets(t)
+	sink := withNotifier(t)
+	for _, email := range []string{"user@d2.com", "disabled@d2.com", "deleted@d2.com", "ci@d2.com", "nobody@d2.com"} {
+		if code := requestReset(t, email); code != http.StatusOK {
+			t.Errorf("%s: code = %d", email, code)
+		}
+	}
+	if _, ok := sink.Last("user@d2.com"); !ok {
+		t.Error("no reset link sent to an active user")
+	}
+	if messages := sink.Messages(); len(messages) != 1 {
+		t.Errorf("reset links sent: %v", messages)
+	}
+}
+
+func TestConfirmPasswordResetSkipsInactive(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com": {Username: "user@d1.com", Type: typeDisabled, Domain: "d2", Tenant: "t1"},
+		"user@d2.com": {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1", ServiceAccount: true},
+	})
+	server := withDomainDirectory(t, "")
+	resets := withPasswordResets(t)
+	addReset(t, resets, "disabled", "user@d1.com", time.Hour)
+	addReset(t, resets, "service", "user@d2.com", time.Hour)
+
+	for _, token := range []string{"disabled", "service"} {
+		if _, code := confirmReset(t, token, "Changed12345"); code != http.StatusUnauthorized {
+			t.Errorf("%s: code = %d, want 401", token, code)
+		}
+	}
+	for _, dn := range []string{"uid=user@d1.com,dc=d2,dc=com", "uid=user@d2.com,dc=d2,dc=com"} {
+		if entry := server.Entry(dn); entry["userpassword"][0] != "secret" {
+			t.Errorf("%s: password changed: %v", dn, entry["userpassword"])
+		}
+	}
+}
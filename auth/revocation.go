@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"files-back/dbase/dbtokens"
+	"sync"
+	"time"
+)
+
+var (
+	IsRevoked          = dbtokens.IsRevoked
+	RevokeUser         = dbtokens.RevokeUser
+	RevocationCacheTTL = time.Minute
+	revocations        = revocationCache{entries: map[string]revocationEntry{}}
+)
+
+type revocationEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+type revocationCache struct {
+	mu        sync.Mutex
+	entries   map[string]revocationEntry
+	nextPrune time.Time
+}
+
+func (c *revocationCache) revoked(ctx context.Context, id string) (bool, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && now.Before(entry.until) {
+		return entry.revoked, nil
+	}
+	revoked, err := IsRevoked(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	until := now.Add(RevocationCacheTTL)
+	if revoked {
+		until = now.Add(TokenTTL)
+	}
+	c.store(id, revocationEntry{revoked: revoked, until: until})
+	return revoked, nil
+}
+
+func (c *revocationCache) mark(id string, until time.Time) {
+	c.store(id, revocationEntry{revoked: true, until: until})
+}
+
+func (c *revocationCache) store(id string, entry revocationEntry) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[id] = entry
+	if now.Before(c.nextPrune) {
+		return
+	}
+	for key, value := range c.entries {
+		if now.After(value.until) {
+			delete(c.entries, key)
+		}
+	}
+	c.nextPrune = now.Add(RevocationCacheTTL)
+}
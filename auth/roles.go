@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"files-back/dbase/dbserviceaccounts"
+	"files-back/dbase/dbusers"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+const (
+	RoleFullAdmin   = "full_Admin"
+	RoleDomainAdmin = "domain_admin"
+	RoleTenantAdmin = "tenant_admin"
+	RoleRegular     = "regular"
+	typeDisabled    = "disabled"
+	typeDeleted     = "deleted"
+)
+
+const (
+	domainRoute = "/domains/{domainName}"
+	tenantRoute = "/domains/{domainName}/tenants/{tenantName}"
+)
+
+var roleRanks = map[string]int{
+	RoleRegular:     1,
+	RoleTenantAdmin: 2,
+	RoleDomainAdmin: 3,
+	RoleFullAdmin:   4,
+}
+
+var (
+	LookupPrincipal      = lookupPrincipal
+	LookupServiceAccount = lookupServiceAccount
+)
+
+type Principal struct {
+	Username       string
+	Type           string
+	Domain         string
+	Tenant         string
+	ServiceAccount bool
+	Scopes         []string
+	Impersonator   string
+	SessionID      string
+}
+
+func lookupPrincipal(ctx context.Context, username string) (*Principal, error) {
+	user, err := dbusers.QueryByEmail(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	p := Principal{
+		Username: user.Email,
+	}
+	if user.Type != nil {
+		p.Type = *user.Type
+	}
+	if user.Domain != nil {
+		p.Domain = user.Domain.Name
+	}
+	if user.Tenant != nil {
+		p.Tenant = user.Tenant.Name
+	}
+	return &p, nil
+}
+
+func (p *Principal) active() bool {
+	return p.Type != typeDisabled && p.Type != typeDeleted
+}
+
+func lookupServiceAccount(ctx context.Context, name string) (*Principal, error) {
+	account, err := dbserviceaccounts.QueryByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return serviceAccountPrincipal(account), nil
+}
+
+func serviceAccountPrincipal(account *dbserviceaccounts.DBStruct) *Principal {
+	p := Principal{
+		Username:       account.Name,
+		Domain:         account.Domain.Name,
+		Tenant:         account.Tenant.Name,
+		ServiceAccount: true,
+	}
+	if account.Type != nil {
+		p.Type = *account.Type
+	}
+	return &p
+}
+
+func Allowed(p *Principal, r *http.Request) bool {
+	if !scopeAllowed(p, r) {
+		return false
+	}
+	vars := mux.Vars(r)
+	domain, tenant, email := vars["domainName"], vars["tenantName"], vars["email"]
+	readOnly := r.Method == http.MethodGet
+	switch p.Type {
+	case RoleFullAdmin:
+		return true
+	case RoleDomainAdmin:
+		if domain == "" || domain != p.Domain {
+			return false
+		}
+		return readOnly || routeTemplate(r) != domainRoute
+	case RoleTenantAdmin:
+		if domain == "" || domain != p.Domain || tenant == "" || tenant != p.Tenant {
+			return false
+		}
+		return readOnly || routeTemplate(r) != tenantRoute
+	case RoleRegular:
+		return readOnly && domain == p.Domain && tenant == p.Tenant && email != "" && email == p.Username
+	default:
+		return false
+	}
+}
+
+func CanAssign(p *Principal, role string) bool {
+	rank, ok := roleRanks[role]
+	return ok && p != nil && rank <= roleRanks[p.Type]
+}
+
+func CanManage(p *Principal, role string) bool {
+	return p != nil && roleRanks[role] <= roleRanks[p.Type]
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
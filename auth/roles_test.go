@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var roleRoutes = []string{
+	"/domains",
+	"/domains/{domainName}",
+	"/domains/{domainName}/tenants/{tenantName}",
+	"/domains/{domainName}/tenants/{tenantName}/users",
+	"/domains/{domainName}/tenants/{tenantName}/users/{email}",
+}
+
+var (
+	fullAdmin   = &Principal{Username: "root@d1", Type: RoleFullAdmin, Domain: "d1", Tenant: "t1"}
+	domainAdmin = &Principal{Username: "domain@d1", Type: RoleDomainAdmin, Domain: "d1", Tenant: "t1"}
+	tenantAdmin = &Principal{Username: "tenant@d1", Type: RoleTenantAdmin, Domain: "d1", Tenant: "t1"}
+	regular     = &Principal{Username: "user@d1", Type: RoleRegular, Domain: "d1", Tenant: "t1"}
+	disabled    = &Principal{Username: "gone@d1", Type: "disabled", Domain: "d1", Tenant: "t1"}
+)
+
+func allowedOn(p *Principal, method, path string) bool {
+	var allowed bool
+	router := mux.NewRouter()
+	for _, route := range roleRoutes {
+		router.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			allowed = Allowed(p, r)
+		})
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	return allowed
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		method  string
+		path    string
+		allowed map[*Principal]bool
+	}{
+		{http.MethodGet, "/domains",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: false, tenantAdmin: false, regular: false, disabled: false}},
+		{http.MethodGet, "/domains/d1",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: false, regular: false, disabled: false}},
+		{http.MethodPut, "/domains/d1",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: false, tenantAdmin: false, regular: false, disabled: false}},
+		{http.MethodGet, "/domains/d2",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: false, tenantAdmin: false, regular: false, disabled: false}},
+		{http.MethodPut, "/domains/d1/tenants/t1",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: false, regular: false, disabled: false}},
+		{http.MethodPost, "/domains/d1/tenants/t1/users",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: true, regular: false, disabled: false}},
+		{http.MethodPost, "/domains/d1/tenants/t2/users",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: false, regular: false, disabled: false}},
+		{http.MethodGet, "/domains/d1/tenants/t1/users/user@d1",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: true, regular: true, disabled: false}},
+		{http.MethodPut, "/domains/d1/tenants/t1/users/user@d1",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: true, regular: false, disabled: false}},
+		{http.MethodGet, "/domains/d1/tenants/t1/users/other@d1",
+			map[*Principal]bool{fullAdmin: true, domainAdmin: true, tenantAdmin: true, regular: false, disabled: false}},
+	}
+	for _, test := range tests {
+		for p, want := range test.allowed {
+			if got := allowedOn(p, test.method, test.path); got != want {
+				t.Errorf("%s %s as %s: allowed = %v, want %v", test.method, test.path, p.Type, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowedScopes(t *testing.T) {
+	p := &Principal{Username: "ci", Type: RoleFullAdmin, Scopes: []string{"domains:read"}}
+	if !allowedOn(p, http.MethodGet, "/domains") {
+		t.Error("read scope should allow GET /domains")
+	}
+	if allowedOn(p, http.MethodPut, "/domains/d1") {
+		t.Error("read scope should not allow PUT /domains/d1")
+	}
+	if allowedOn(p, http.MethodGet, "/domains/d1/tenants/t1/users") {
+		t.Error("domains scope should not allow users routes")
+	}
+}
+
+func TestCanAssign(t *testing.T) {
+	roles := []string{RoleRegular, RoleTenantAdmin, RoleDomainAdmin, RoleFullAdmin}
+	tests := []struct {
+		caller     *Principal
+		assignable int
+	}{
+		{fullAdmin, 4},
+		{domainAdmin, 3},
+		{tenantAdmin, 2},
+		{regular, 1},
+		{disabled, 0},
+		{nil, 0},
+	}
+	for _, test := range tests {
+		for i, role := range roles {
+			want := i < test.assignable
+			if got := CanAssign(test.caller, role); got != want {
+				t.Errorf("CanAssign(%v, %s) = %v, want %v", test.caller, role, got, want)
+			}
+		}
+		if CanAssign(test.caller, "disabled") {
+			t.Errorf("CanAssign(%v, disabled) should be false", test.caller)
+		}
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	if !CanManage(tenantAdmin, RoleRegular) || !CanManage(tenantAdmin, "disabled") {
+		t.Error("tenant admin should manage regular and disabled users")
+	}
+	if CanManage(tenantAdmin, RoleDomainAdmin) || CanManage(domainAdmin, RoleFullAdmin) {
+		t.Error("admins should not manage higher roles")
+	}
+	if CanManage(nil, RoleRegular) {
+		t.Error("missing principal should manage nothing")
+	}
+}
@@ -0,0 +1,430 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"files-back/dbase/dbdomains"
+	"files-back/handlers"
+	"fmt"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	samlProtocolNS   = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS  = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlMetadataNS   = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlPostBinding  = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlEmailFormat  = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlBearer       = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlTimeFormat   = "2006-01-02T15:04:05Z"
+	samlMetadataType = "application/samlmetadata+xml"
+)
+
+var (
+	SAMLBackend        *SAML
+	SAMLRequestTTL     = time.Minute * 10
+	SAMLClockSkew      = time.Minute * 2
+	LookupSAMLProvider = lookupSAMLProvider
+)
+
+var (
+	UnknownRelayState = errors.New("unknown or expired saml relay state")
+	BadAssertion      = errors.New("invalid saml assertion")
+	BadCertificate    = errors.New("no certificates found in saml configuration")
+)
+
+type SAMLProvider struct {
+	Domain         string
+	EntityID       string
+	SSOURL         string
+	Certificates   []*x509.Certificate
+	EmailAttribute string
+}
+
+type SAML struct {
+	EntityID string
+	ACSURL   string
+
+	mu      sync.Mutex
+	pending map[string]samlPending
+	seen    map[string]time.Time
+}
+
+type samlPending struct {
+	requestID string
+	domain    string
+	expires   time.Time
+}
+
+func lookupSAMLProvider(ctx context.Context, domainName string) (*SAMLProvider, error) {
+	domain, err := dbdomains.QuerySAML(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+	certificates, err := ParseCertificates(*domain.SAMLStruct.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	provider := SAMLProvider{
+		Domain:       domain.Name,
+		EntityID:     *domain.SAMLStruct.EntityID,
+		SSOURL:       *domain.SAMLStruct.SSOURL,
+		Certificates: certificates,
+	}
+	if domain.SAMLStruct.EmailAttribute != nil {
+		provider.EmailAttribute = *domain.SAMLStruct.EmailAttribute
+	}
+	return &provider, nil
+}
+
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+		if err != nil {
+			return nil, BadCertificate
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+func (s *SAML) Name() string {
+	return "saml"
+}
+
+func (s *SAML) Metadata(w http.ResponseWriter, r *http.Request) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	entity := doc.CreateElement("md:EntityDescriptor")
+	entity.CreateAttr("xmlns:md", samlMetadataNS)
+	entity.CreateAttr("entityID", s.EntityID)
+	descriptor := entity.CreateElement("md:SPSSODescriptor")
+	descriptor.CreateAttr("AuthnRequestsSigned", "false")
+	descriptor.CreateAttr("WantAssertionsSigned", "true")
+	descriptor.CreateAttr("protocolSupportEnumeration", samlProtocolNS)
+	descriptor.CreateElement("md:NameIDFormat").SetText(samlEmailFormat)
+	acs := descriptor.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", samlPostBinding)
+	acs.CreateAttr("Location", s.ACSURL)
+	acs.CreateAttr("index", "0")
+	acs.CreateAttr("isDefault", "true")
+	doc.Indent(2)
+	w.Header().Set("Content-Type", samlMetadataType)
+	if _, err := doc.WriteTo(w); err != nil {
+		handlers.StatusError(err, w)
+	}
+}
+
+func (s *SAML) Start(w http.ResponseWriter, r *http.Request) {
+	provider, err := LookupSAMLProvider(r.Context(), r.URL.Query().Get("domain"))
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	requestID, relayState := "_"+randomID(), randomToken()
+	s.mu.Lock()
+	s.prune()
+	s.pending[relayState] = samlPending{
+		requestID: requestID,
+		domain:    provider.Domain,
+		expires:   time.Now().Add(SAMLRequestTTL),
+	}
+	s.mu.Unlock()
+
+	request, err := s.authnRequest(provider, requestID)
+	if err != nil {
+		handlers.StatusError(err, w)
+		return
+	}
+	query := url.Values{
+		"SAMLRequest": {request},
+		"RelayState":  {relayState},
+	}
+	separator := "?"
+	if strings.Contains(provider.SSOURL, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, provider.SSOURL+separator+query.Encode(), http.StatusFound)
+}
+
+func (s *SAML) authnRequest(provider *SAMLProvider, requestID string) (string, error) {
+	doc := etree.NewDocument()
+	request := doc.CreateElement("samlp:AuthnRequest")
+	request.CreateAttr("xmlns:samlp", samlProtocolNS)
+	request.CreateAttr("xmlns:saml", samlAssertionNS)
+	request.CreateAttr("ID", requestID)
+	request.CreateAttr("Version", "2.0")
+	request.CreateAttr("IssueInstant", time.Now().UTC().Format(samlTimeFormat))
+	request.CreateAttr("Destination", provider.SSOURL)
+	request.CreateAttr("AssertionConsumerServiceURL", s.ACSURL)
+	request.CreateAttr("ProtocolBinding", samlPostBinding)
+	request.CreateElement("saml:Issuer").SetText(s.EntityID)
+	policy := request.CreateElement("samlp:NameIDPolicy")
+	policy.CreateAttr("Format", samlEmailFormat)
+	policy.CreateAttr("AllowCreate", "false")
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(deflated.Bytes()), nil
+}
+
+func (s *SAML) Authenticate(r *http.Request) (*Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", BadLogin, err)
+	}
+	response, relayState := r.PostForm.Get("SAMLResponse"), r.PostForm.Get("RelayState")
+	if response == "" || relayState == "" {
+		return nil, fmt.Errorf("%w: missing SAMLResponse or RelayState", BadLogin)
+	}
+	s.mu.Lock()
+	pending, ok := s.pending[relayState]
+	delete(s.pending, relayState)
+	s.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, fmt.Errorf("%w: %v", InvalidCredentials, UnknownRelayState)
+	}
+	provider, err := LookupSAMLProvider(r.Context(), pending.domain)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", BadLogin, err)
+	}
+	email, name, err := s.verify(provider, raw, pending.requestID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCredentials, err)
+	}
+	principal, err := LookupPrincipal(r.Context(), email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %v", InvalidCredentials, err)
+		}
+		return nil, err
+	}
+	if principal.Domain != provider.Domain {
+		return nil, fmt.Errorf("%w: %s is not a user of domain %s", InvalidCredentials, email, provider.Domain)
+	}
+	return &Identity{
+		Username:    principal.Username,
+		DisplayName: name,
+		Method:      s.Name(),
+	}, nil
+}
+
+func (s *SAML) verify(provider *SAMLProvider, raw []byte, requestID string) (string, string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return "", "", err
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != samlProtocolNS {
+		return "", "", fmt.Errorf("%w: not a saml response", BadAssertion)
+	}
+	if status := root.FindElement("./Status/StatusCode"); status == nil || status.SelectAttrValue("Value", "") != samlSuccess {
+		return "", "", fmt.Errorf("%w: unsuccessful status", BadAssertion)
+	}
+	assertions := root.SelectElements("Assertion")
+	if len(assertions) != 1 || root.SelectElement("EncryptedAssertion") != nil {
+		return "", "", fmt.Errorf("%w: expected exactly one plain assertion", BadAssertion)
+	}
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: provider.Certificates})
+	assertion, err := validator.Validate(assertions[0])
+	if errors.Is(err, dsig.ErrMissingSignature) {
+		var validated *etree.Element
+		validated, err = validator.Validate(root)
+		if err == nil {
+			if destination := validated.SelectAttrValue("Destination", ""); destination != "" && destination != s.ACSURL {
+				return "", "", fmt.Errorf("%w: destination", BadAssertion)
+			}
+			assertion = validated.SelectElement("Assertion")
+		}
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if assertion == nil {
+		return "", "", fmt.Errorf("%w: assertion not signed", BadAssertion)
+	}
+	now := time.Now()
+	if issuer := assertion.SelectElement("Issuer"); issuer == nil || strings.TrimSpace(issuer.Text()) != provider.EntityID {
+		return "", "", fmt.Errorf("%w: issuer", BadAssertion)
+	}
+	if err := s.checkConditions(assertion.SelectElement("Conditions"), now); err != nil {
+		return "", "", err
+	}
+	subject := assertion.SelectElement("Subject")
+	if subject == nil {
+		return "", "", fmt.Errorf("%w: no subject", BadAssertion)
+	}
+	if err := s.checkConfirmation(subject, requestID, now); err != nil {
+		return "", "", err
+	}
+	expires := now.Add(SAMLRequestTTL)
+	if notOnOrAfter, ok := samlTime(assertion.FindElement("./Conditions"), "NotOnOrAfter"); ok {
+		expires = notOnOrAfter.Add(SAMLClockSkew)
+	}
+	if !s.markSeen(assertion.SelectAttrValue("ID", ""), expires) {
+		return "", "", fmt.Errorf("%w: assertion replayed", BadAssertion)
+	}
+
+	var email string
+	if provider.EmailAttribute != "" {
+		email = samlAttribute(assertion, provider.EmailAttribute)
+	} else if nameID := subject.SelectElement("NameID"); nameID != nil {
+		email = nameID.Text()
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", "", fmt.Errorf("%w: no email", BadAssertion)
+	}
+	return email, samlAttribute(assertion, "displayName"), nil
+}
+
+func (s *SAML) checkConditions(conditions *etree.Element, now time.Time) error {
+	if conditions == nil {
+		return fmt.Errorf("%w: no conditions", BadAssertion)
+	}
+	if notBefore, ok := samlTime(conditions, "NotBefore"); ok && now.Add(SAMLClockSkew).Before(notBefore) {
+		return fmt.Errorf("%w: not yet valid", BadAssertion)
+	}
+	if notOnOrAfter, ok := samlTime(conditions, "NotOnOrAfter"); ok && !now.Add(-SAMLClockSkew).Before(notOnOrAfter) {
+		return fmt.Errorf("%w: expired", BadAssertion)
+	}
+	restrictions := conditions.SelectElements("AudienceRestriction")
+	if len(restrictions) == 0 {
+		return fmt.Errorf("%w: no audience", BadAssertion)
+	}
+	for _, restriction := range restrictions {
+		allowed := false
+		for _, audience := range restriction.SelectElements("Audience") {
+			allowed = allowed || strings.TrimSpace(audience.Text()) == s.EntityID
+		}
+		if !allowed {
+			return fmt.Errorf("%w: audience", BadAssertion)
+		}
+	}
+	return nil
+}
+
+func (s *SAML) checkConfirmation(subject *etree.Element, requestID string, now time.Time) error {
+	for _, confirmation := range subject.SelectElements("SubjectConfirmation") {
+		if confirmation.SelectAttrValue("Method", "") != samlBearer {
+			continue
+		}
+		data := confirmation.SelectElement("SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		notOnOrAfter, ok := samlTime(data, "NotOnOrAfter")
+		if ok && now.Add(-SAMLClockSkew).Before(notOnOrAfter) &&
+			data.SelectAttrValue("Recipient", "") == s.ACSURL &&
+			data.SelectAttrValue("InResponseTo", "") == requestID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: subject confirmation", BadAssertion)
+}
+
+func (s *SAML) markSeen(id string, expires time.Time) bool {
+	if id == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	if _, ok := s.seen[id]; ok {
+		return false
+	}
+	s.seen[id] = expires
+	return true
+}
+
+func (s *SAML) prune() {
+	if s.pending == nil {
+		s.pending = map[string]samlPending{}
+	}
+	if s.seen == nil {
+		s.seen = map[string]time.Time{}
+	}
+	now := time.Now()
+	for state, pending := range s.pending {
+		if now.After(pending.expires) {
+			delete(s.pending, state)
+		}
+	}
+	for id, expires := range s.seen {
+		if now.After(expires) {
+			delete(s.seen, id)
+		}
+	}
+}
+
+func samlTime(el *etree.Element, attribute string) (time.Time, bool) {
+	if el == nil {
+		return time.Time{}, false
+	}
+	value := el.SelectAttrValue(attribute, "")
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
+
+func samlAttribute(assertion *etree.Element, name string) string {
+	for _, statement := range assertion.SelectElements("AttributeStatement") {
+		for _, attribute := range statement.SelectElements("Attribute") {
+			if attribute.SelectAttrValue("Name", "") != name && attribute.SelectAttrValue("FriendlyName", "") != name {
+				continue
+			}
+			if value := attribute.SelectElement("AttributeValue"); value != nil {
+				return strings.TrimSpace(value.Text())
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	samlEntityID = "https://files.example.com/saml"
+	samlACSURL   = "https://files.example.com/login/saml/acs"
+	samlIdP      = "https://idp.example.com"
+)
+
+type samlIdentityProvider struct {
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newSAMLIdentityProvider(t *testing.T) *samlIdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &samlIdentityProvider{key: key, certificate: certificate}
+}
+
+func withSAMLProvider(t *testing.T, idp *samlIdentityProvider) *SAML {
+	lookup := LookupSAMLProvider
+	LookupSAMLProvider = func(ctx context.Context, domainName string) (*SAMLProvider, error) {
+		return &SAMLProvider{
+			Domain:       "d1",
+			EntityID:     samlIdP,
+			SSOURL:       samlIdP + "/sso",
+			Certificates: []*x509.Certificate{idp.certificate},
+		}, nil
+	}
+	t.Cleanup(func() {
+		LookupSAMLProvider = lookup
+	})
+	return &SAML{EntityID: samlEntityID, ACSURL: samlACSURL}
+}
+
+func startSAML(t *testing.T, s *SAML) (string, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.Start(w, httptest.NewRequest(http.MethodGet, "/login/saml?domain=d1", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("start: status = %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deflated, err := base64.StdEncoding.DecodeString(location.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Root().SelectAttrValue("ID", ""), location.Query().Get("RelayState")
+}
+
+type samlAssertion struct {
+	id           string
+	inResponseTo string
+	email        string
+	audience     string
+	notOnOrAfter time.Time
+}
+
+func (idp *samlIdentityProvider) assertion(requestID string) samlAssertion {
+	return samlAssertion{
+		id:           "_" + randomID(),
+		inResponseTo: requestID,
+		email:        "user@d1.com",
+		audience:     samlEntityID,
+		notOnOrAfter: time.Now().Add(5 * time.Minute),
+	}
+}
+
+func (idp *samlIdentityProvider) response(t *testing.T, a samlAssertion, tamper func(*etree.Element)) string {
+	t.Helper()
+	now := time.Now().UTC()
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", samlAssertionNS)
+	assertion.CreateAttr("ID", a.id)
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", now.Format(samlTimeFormat))
+	assertion.CreateElement("saml:Issuer").SetText(samlIdP)
+	subject := assertion.CreateElement("saml:Subject")
+	subject.CreateElement("saml:NameID").SetText(a.email)
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", samlBearer)
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	data.CreateAttr("InResponseTo", a.inResponseTo)
+	data.CreateAttr("Recipient", samlACSURL)
+	data.CreateAttr("NotOnOrAfter", a.notOnOrAfter.UTC().Format(samlTimeFormat))
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", now.Add(-time.Minute).Format(samlTimeFormat))
+	conditions.CreateAttr("NotOnOrAfter", a.notOnOrAfter.UTC().Format(samlTimeFormat))
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(a.audience)
+	attribute := assertion.CreateElement("saml:AttributeStatement").CreateElement("saml:Attribute")
+	attribute.CreateAttr("Name", "displayName")
+	attribute.CreateElement("saml:AttributeValue").SetText("Test User")
+
+	signer, err := dsig.NewSigningContext(idp.key, [][]byte{idp.certificate.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.SignEnveloped(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(signed)
+	}
+
+	doc := etree.NewDocument()
+	response := doc.CreateElement("samlp:Response")
+	response.CreateAttr("xmlns:samlp", samlProtocolNS)
+	response.CreateAttr("ID", "_"+randomID())
+	response.CreateAttr("Version", "2.0")
+	response.CreateAttr("IssueInstant", now.Format(samlTimeFormat))
+	response.CreateAttr("Destination", samlACSURL)
+	response.CreateAttr("InResponseTo", a.inResponseTo)
+	response.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").CreateAttr("Value", samlSuccess)
+	response.AddChild(signed)
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func samlLogin(s *SAML, relayState, response string) (*Identity, error) {
+	form := url.Values{"SAMLResponse": {response}, "RelayState": {relayState}}
+	r := httptest.NewRequest(http.MethodPost, "/login/saml/acs", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.Authenticate(r)
+}
+
+func TestSAMLSignedAssertion(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com": {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+	})
+	idp := newSAMLIdentityProvider(t)
+	s := withSAMLProvider(t, idp)
+	requestID, relayState := startSAML(t, s)
+	assertion := idp.assertion(requestID)
+	response := idp.response(t, assertion, nil)
+
+	identity, err := samlLogin(s, relayState, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "user@d1.com" || identity.DisplayName != "Test User" || identity.Method != "saml" {
+		t.Errorf("identity = %+v", identity)
+	}
+	if _, err := samlLogin(s, relayState, response); !errors.Is(err, InvalidCredentials) {
+		t.Errorf("reused relay state: err = %v, want InvalidCredentials", err)
+	}
+	_, relayState = startSAML(t, s)
+	if _, err := samlLogin(s, relayState, response); !errors.Is(err, InvalidCredentials) {
+		t.Errorf("replayed assertion: err = %v, want InvalidCredentials", err)
+	}
+}
+
+func TestSAMLRejectsInvalidAssertions(t *testing.T) {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com":  {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+		"admin@d1.com": {Username: "admin@d1.com", Type: RoleFullAdmin, Domain: "d1", Tenant: "t1"},
+		"user@d2.com":  {Username: "user@d2.com", Type: RoleRegular, Domain: "d2", Tenant: "t1"},
+	})
+	idp := newSAMLIdentityProvider(t)
+	other := newSAMLIdentityProvider(t)
+	s := withSAMLProvider(t, idp)
+	tests := []struct {
+		name   string
+		signer *samlIdentityProvider
+		change func(*samlAssertion)
+		tamper func(*etree.Element)
+	}{
+		{name: "untrusted key", signer: other},
+		{name: "expired", change: func(a *samlAssertion) {
+			a.notOnOrAfter = time.Now().Add(-time.Hour)
+		}},
+		{name: "wrong audience", change: func(a *samlAssertion) {
+			a.audience = "https://other.example.com"
+		}},
+		{name: "unsolicited", change: func(a *samlAssertion) {
+			a.inResponseTo = "_other"
+		}},
+		{name: "other domain", change: func(a *samlAssertion) {
+			a.email = "user@d2.com"
+		}},
+		{name: "tampered subject", tamper: func(assertion *etree.Element) {
+			assertion.FindElement("./Subject/NameID").SetText("admin@d1.com")
+		}},
+	}
+	for _, test := range tests {
+		requestID, relayState := startSAML(t, s)
+		signer := idp
+		if test.signer != nil {
+			signer = test.signer
+		}
+		assertion := signer.assertion(requestID)
+		if test.change != nil {
+			test.change(&assertion)
+		}
+		response := signer.response(t, assertion, test.tamper)
+		if _, err := samlLogin(s, relayState, response); !errors.Is(err, InvalidCredentials) {
+			t.Errorf("%s: err = %v, want InvalidCredentials", test.name, err)
+		}
+	}
+}
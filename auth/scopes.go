@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+var scopeResources = []string{"domains", "plans", "tariffs", "tenants", "users", "groups", "tokens", "service-accounts", "lockouts", "me", "import", "reconcile", "impersonations", "sessions", "logins"}
+
+func ValidScope(scope string) bool {
+	parts := strings.Split(scope, ":")
+	if len(parts) != 2 || (parts[1] != scopeRead && parts[1] != scopeWrite) {
+		return false
+	}
+	for _, resource := range scopeResources {
+		if parts[0] == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func requiredScope(r *http.Request) string {
+	var resource string
+	for _, segment := range strings.Split(routeTemplate(r), "/") {
+		if segment != "" && !strings.HasPrefix(segment, "{") {
+			resource = segment
+		}
+	}
+	if r.Method == http.MethodGet {
+		return resource + ":" + scopeRead
+	}
+	return resource + ":" + scopeWrite
+}
+
+func scopeAllowed(p *Principal, r *http.Request) bool {
+	return p.HasScope(requiredScope(r))
+}
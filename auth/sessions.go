@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"files-back/dbase/dbloginattempts"
+	"files-back/dbase/dbtokens"
+	"files-back/handlers"
+	"files-back/handlers/params"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	SessionNotFound = errors.New("session not found")
+	BadLoginFilter  = errors.New("bad login filter")
+)
+
+func ListMySessions(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	listSessions(w, r, dbtokens.SessionFilter{
+		Email:  &principalFrom(r).Username,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	})
+}
+
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	listSessions(w, r, dbtokens.SessionFilter{
+		Email:  filterEmail(r, p),
+		Domain: p.DomainName,
+		Tenant: p.TenantName,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	})
+}
+
+func listSessions(w http.ResponseWriter, r *http.Request, f dbtokens.SessionFilter) {
+	sessions, err := dbtokens.QuerySessions(r.Context(), f)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if current := currentFamily(r); current != "" {
+		for _, session := range sessions {
+			session.Current = session.FamilyID == current
+		}
+	}
+	handlers.ResponseJSON(w, sessions)
+}
+
+func RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	principal := principalFrom(r)
+	if denyImpersonated(w, principal) {
+		return
+	}
+	revokeSession(w, r, dbtokens.SessionFilter{Email: &principal.Username})
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	revokeSession(w, r, dbtokens.SessionFilter{
+		Email:  p.Email,
+		Domain: p.DomainName,
+		Tenant: p.TenantName,
+	})
+}
+
+func revokeSession(w http.ResponseWriter, r *http.Request, f dbtokens.SessionFilter) {
+	id, limit, offset := mux.Vars(r)["sessionID"], 1, 0
+	f.FamilyID, f.Limit, f.Offset = &id, &limit, &offset
+	sessions, err := dbtokens.QuerySessions(r.Context(), f)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if len(sessions) == 0 {
+		handlers.StatusNotFound(SessionNotFound, w)
+		return
+	}
+	if err := RefreshTokens.RevokeFamily(r.Context(), id, sessions[0].ExpiresAt); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	revocations.mark(id, sessions[0].ExpiresAt)
+	handlers.StatusDeleted(w)
+}
+
+func ListMyLogins(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	listLogins(w, r, dbloginattempts.Filter{
+		Email:  &principalFrom(r).Username,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	})
+}
+
+func ListLogins(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	listLogins(w, r, dbloginattempts.Filter{
+		Email:  filterEmail(r, p),
+		Domain: p.DomainName,
+		Tenant: p.TenantName,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	})
+}
+
+func listLogins(w http.ResponseWriter, r *http.Request, f dbloginattempts.Filter) {
+	query := r.URL.Query()
+	if success := query.Get("success"); success != "" {
+		value, err := strconv.ParseBool(success)
+		if err != nil {
+			handlers.StatusBadData(BadLoginFilter, w)
+			return
+		}
+		f.Success = &value
+	}
+	for name, target := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				handlers.StatusBadData(BadLoginFilter, w)
+				return
+			}
+			*target = &parsed
+		}
+	}
+	attempts, err := dbloginattempts.Query(r.Context(), f)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, attempts)
+}
+
+func filterEmail(r *http.Request, p params.QueryParams) *string {
+	if p.Email != nil {
+		return p.Email
+	}
+	if email := r.URL.Query().Get("email"); email != "" {
+		return &email
+	}
+	return nil
+}
+
+func currentFamily(r *http.Request) string {
+	if tokenStr, ok := bearerToken(r); ok {
+		if claims, err := parseClaims(tokenStr); err == nil {
+			return claimString(claims, "fam")
+		}
+	}
+	return ""
+}
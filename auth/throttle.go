@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"files-back/dbase/dbloginattempts"
+	"files-back/handlers"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	lockoutUsers = "users"
+	lockoutIPs   = "ips"
+)
+
+var (
+	UserLimiter    = NewLimiter(nil, 5)
+	IPLimiter      = NewLimiter(nil, 50)
+	TrustedProxies int
+	RecordAttempt  = dbloginattempts.Insert
+)
+
+var (
+	TooManyAttempts = errors.New("too many login attempts")
+	UnknownLockout  = errors.New("unknown lockout kind")
+)
+
+type ThrottledError struct {
+	Wait time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry in %v", TooManyAttempts, e.Wait.Round(time.Second))
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return TooManyAttempts
+}
+
+type Throttled struct {
+	Authenticator
+}
+
+func (t Throttled) Authenticate(r *http.Request) (*Identity, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", BadLogin, err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var incomeAuth incomingJSON
+	_ = json.Unmarshal(body, &incomeAuth)
+	username := strings.ToLower(incomeAuth.Username)
+	ip := clientIP(r)
+
+	wait := UserLimiter.Check(username)
+	if ipWait := IPLimiter.Check(ip); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		return nil, &attemptError{Username: username, Err: &ThrottledError{Wait: wait}}
+	}
+
+	identity, err := t.Authenticator.Authenticate(r)
+	switch {
+	case err == nil:
+		UserLimiter.Reset(username)
+	case errors.Is(err, InvalidCredentials):
+		UserLimiter.Fail(username)
+		IPLimiter.Fail(ip)
+	}
+	if err != nil {
+		return nil, &attemptError{Username: username, Err: err}
+	}
+	return identity, nil
+}
+
+type attemptError struct {
+	Username string
+	Err      error
+}
+
+func (e *attemptError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *attemptError) Unwrap() error {
+	return e.Err
+}
+
+func attemptedUsername(err error) string {
+	var attempt *attemptError
+	if errors.As(err, &attempt) {
+		return attempt.Username
+	}
+	return ""
+}
+
+func recordAttempt(r *http.Request, method, username, familyID string, err error) {
+	attempt := dbloginattempts.DBStruct{
+		Username: username,
+		IP:       clientIP(r),
+		Success:  err == nil,
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		attempt.UserAgent = &userAgent
+	}
+	if method != "" {
+		attempt.Method = &method
+	}
+	if familyID != "" {
+		attempt.FamilyID = &familyID
+	}
+	if err != nil {
+		reason := err.Error()
+		attempt.Reason = &reason
+	}
+	if err := RecordAttempt(r.Context(), &attempt); err != nil {
+		log.Println(err)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	if TrustedProxies > 0 {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(strings.Join(forwarded, ","), ",")
+			client := len(hops) - TrustedProxies
+			if client < 0 {
+				client = 0
+			}
+			return strings.TrimSpace(hops[client])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func SweepLimiters(interval time.Duration) {
+	for range time.Tick(interval) {
+		UserLimiter.Sweep()
+		IPLimiter.Sweep()
+		ResetLimiter.Sweep()
+	}
+}
+
+func limiterFor(kind string) *Limiter {
+	switch kind {
+	case lockoutUsers:
+		return UserLimiter
+	case lockoutIPs:
+		return IPLimiter
+	default:
+		return nil
+	}
+}
+
+func ListLockouts(w http.ResponseWriter, r *http.Request) {
+	handlers.ResponseJSON(w, map[string][]Lockout{
+		lockoutUsers: UserLimiter.Lockouts(),
+		lockoutIPs:   IPLimiter.Lockouts(),
+	})
+}
+
+func ClearLockout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	limiter := limiterFor(vars["kind"])
+	if limiter == nil {
+		handlers.StatusBadData(UnknownLockout, w)
+		return
+	}
+	if !limiter.Reset(vars["key"]) {
+		handlers.StatusNotFound(fmt.Errorf("lockout %s not found", vars["key"]), w)
+		return
+	}
+	handlers.StatusDeleted(w)
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type rejectAll struct{}
+
+func (rejectAll) Name() string {
+	return "stub"
+}
+
+func (rejectAll) Authenticate(r *http.Request) (*Identity, error) {
+	return nil, InvalidCredentials
+}
+
+func withTrustedProxies(t *testing.T, n int) {
+	trusted := TrustedProxies
+	TrustedProxies = n
+	t.Cleanup(func() {
+		TrustedProxies = trusted
+	})
+}
+
+func withLimiters(t *testing.T, users, ips int) {
+	user, ip := UserLimiter, IPLimiter
+	UserLimiter, IPLimiter = NewLimiter(newFakeClock(), users), NewLimiter(newFakeClock(), ips)
+	t.Cleanup(func() {
+		UserLimiter, IPLimiter = user, ip
+	})
+}
+
+func advanceLimiters(d time.Duration) {
+	UserLimiter.Clock.(*fakeClock).Advance(d)
+	IPLimiter.Clock.(*fakeClock).Advance(d)
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		trusted   int
+		forwarded []string
+		want      string
+	}{
+		{0, nil, "192.0.2.1"},
+		{0, []string{"203.0.113.9"}, "192.0.2.1"},
+		{1, nil, "192.0.2.1"},
+		{1, []string{"203.0.113.9"}, "203.0.113.9"},
+		{1, []string{"198.51.100.7, 203.0.113.9"}, "203.0.113.9"},
+		{1, []string{"198.51.100.7", "203.0.113.9"}, "203.0.113.9"},
+		{2, []string{"198.51.100.7, 203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{3, []string{"203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+	}
+	for _, test := range tests {
+		withTrustedProxies(t, test.trusted)
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = "192.0.2.1:4242"
+		for _, value := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := clientIP(r); got != test.want {
+			t.Errorf("trusted=%d forwarded=%v: clientIP = %q, want %q", test.trusted, test.forwarded, got, test.want)
+		}
+	}
+}
+
+func login(ip, forwarded, username string) error {
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"`+username+`","password":"x"}`))
+	r.RemoteAddr = ip + ":4242"
+	if forwarded != "" {
+		r.Header.Set("X-Forwarded-For", forwarded)
+	}
+	_, err := Throttled{rejectAll{}}.Authenticate(r)
+	return err
+}
+
+func TestThrottledUsername(t *testing.T) {
+	withLimiters(t, 3, 0)
+	for i := 0; i < 3; i++ {
+		if err := login("192.0.2.1", "", "User@d1.com"); !errors.Is(err, InvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v", i+1, err)
+		}
+		advanceLimiters(time.Minute)
+	}
+	err := login("192.0.2.2", "", "user@d1.com")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.Wait <= 0 {
+		t.Fatalf("locked username: err = %v, want ThrottledError", err)
+	}
+	if name := attemptedUsername(err); name != "user@d1.com" {
+		t.Errorf("attempted username = %q", name)
+	}
+}
+
+func TestThrottledSpoofedForwardedFor(t *testing.T) {
+	withTrustedProxies(t, 1)
+	withLimiters(t, 0, 3)
+	for i := 0; i < 3; i++ {
+		spoofed := "198.51.100." + strconv.Itoa(i) + ", 203.0.113.9"
+		if err := login("10.0.0.2", spoofed, "user"+strconv.Itoa(i)); !errors.Is(err, InvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v", i+1, err)
+		}
+		advanceLimiters(time.Minute)
+	}
+	if err := login("10.0.0.2", "198.51.100.99, 203.0.113.9", "fresh"); !errors.Is(err, TooManyAttempts) {
+		t.Errorf("rotating the spoofed hop bypassed the ip lockout: err = %v", err)
+	}
+	if err := login("10.0.0.2", "203.0.113.10", "fresh"); !errors.Is(err, InvalidCredentials) {
+		t.Errorf("other client should not be locked: err = %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"files-back/auth/directory"
+	"files-back/dbase/dbtokens"
+	"files-back/handlers"
+	"net/http"
+	"time"
+)
+
+var RefreshTokens dbtokens.Repository = dbtokens.SQLRepository{}
+
+var TokenReused = errors.New("refresh token reused")
+
+type refreshJSON struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	var incomeRefresh refreshJSON
+	err := json.NewDecoder(r.Body).Decode(&incomeRefresh)
+	if err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	used, err := useRefreshToken(r.Context(), hashToken(incomeRefresh.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows), errors.Is(err, TokenReused):
+			handlers.StatusUnauthorized(err, w)
+		default:
+			handlers.ReturnError(w, err)
+		}
+		return
+	}
+	identity, err := refreshIdentity(r.Context(), used.Username)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows), errors.Is(err, Inactive):
+			handlers.StatusUnauthorized(err, w)
+		default:
+			handlers.ReturnError(w, err)
+		}
+		return
+	}
+	token, err := issueToken(r.Context(), identity, used.FamilyID)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, token)
+}
+
+func useRefreshToken(ctx context.Context, tokenHash string) (*dbtokens.DBStruct, error) {
+	used, err := RefreshTokens.Use(ctx, tokenHash)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return used, err
+	}
+	token, qErr := RefreshTokens.QueryByHash(ctx, tokenHash)
+	if qErr != nil {
+		return nil, qErr
+	}
+	if token.Used && !token.Revoked {
+		if rErr := RefreshTokens.RevokeFamily(ctx, token.FamilyID, token.ExpiresAt); rErr != nil {
+			return nil, rErr
+		}
+		revocations.mark(token.FamilyID, token.ExpiresAt)
+		return nil, TokenReused
+	}
+	return nil, err
+}
+
+func refreshIdentity(ctx context.Context, username string) (*Identity, error) {
+	principal, err := LookupPrincipal(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if !principal.active() {
+		return nil, Inactive
+	}
+	return &Identity{
+		Username: principal.Username,
+		Role:     &directory.Role{Type: principal.Type, Domain: principal.Domain, Tenant: principal.Tenant},
+	}, nil
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var incomeRefresh refreshJSON
+	err := json.NewDecoder(r.Body).Decode(&incomeRefresh)
+	if err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	refresh, err := RefreshTokens.QueryByHash(r.Context(), hashToken(incomeRefresh.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			handlers.StatusUnauthorized(err, w)
+		default:
+			handlers.ReturnError(w, err)
+		}
+		return
+	}
+	if err := RefreshTokens.RevokeFamily(r.Context(), refresh.FamilyID, refresh.ExpiresAt); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	revocations.mark(refresh.FamilyID, refresh.ExpiresAt)
+	if tokenStr, ok := bearerToken(r); ok {
+		if claims, err := parseClaims(tokenStr); err == nil && claimString(claims, "jti") != "" {
+			revoked := dbtokens.RevokedStruct{
+				ID:        claimString(claims, "jti"),
+				ExpiresAt: claimTime(claims, "exp"),
+			}
+			if err := RefreshTokens.Revoke(r.Context(), &revoked); err != nil {
+				handlers.ReturnError(w, err)
+				return
+			}
+			revocations.mark(revoked.ID, revoked.ExpiresAt)
+		}
+	}
+	handlers.StatusLoggedOut(w)
+}
+
+func issueToken(ctx context.Context, identity *Identity, familyID string) (*Token, error) {
+	if familyID == "" {
+		familyID = randomID()
+	}
+	accessToken, expires, err := GenerateToken(identity.Username, familyID, identity.Role)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := randomToken()
+	refresh := dbtokens.DBStruct{
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		Username:  identity.Username,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if identity.Role != nil {
+		refresh.Role, refresh.RoleDomain, refresh.RoleTenant = &identity.Role.Type, &identity.Role.Domain, &identity.Role.Tenant
+	}
+	err = RefreshTokens.Insert(ctx, &refresh)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{
+		Token:        accessToken,
+		Expires:      expires.Format(time.RFC3339),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func randomID() string {
+	return hex.EncodeToString(randomBytes(16))
+}
+
+func randomToken() string {
+	return base64.RawURLEncoding.EncodeToString(randomBytes(32))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
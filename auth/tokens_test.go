@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"files-back/dbase/dbtokens"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRefreshTokens struct {
+	mu      sync.Mutex
+	tokens  map[string]*dbtokens.DBStruct
+	revoked map[string]bool
+	checks  int
+}
+
+func (f *fakeRefreshTokens) Insert(ctx context.Context, token *dbtokens.DBStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *token
+	f.tokens[token.TokenHash] = &copied
+	return nil
+}
+
+func (f *fakeRefreshTokens) QueryByHash(ctx context.Context, tokenHash string) (*dbtokens.DBStruct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (f *fakeRefreshTokens) Use(ctx context.Context, tokenHash string) (*dbtokens.DBStruct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[tokenHash]
+	if !ok || token.Used || token.Revoked || !token.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	token.Used = true
+	copied := *token
+	return &copied, nil
+}
+
+func (f *fakeRefreshTokens) RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	f.mu.Lock()
+	for _, token := range f.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+		}
+	}
+	f.mu.Unlock()
+	return f.Revoke(ctx, &dbtokens.RevokedStruct{ID: familyID, ExpiresAt: expiresAt})
+}
+
+func (f *fakeRefreshTokens) Revoke(ctx context.Context, revoked *dbtokens.RevokedStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked[revoked.ID] = true
+	return nil
+}
+
+func (f *fakeRefreshTokens) IsRevoked(ctx context.Context, id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks++
+	return f.revoked[id], nil
+}
+
+func withRefreshTokens(t *testing.T) *fakeRefreshTokens {
+	withTokens(t, map[string]*Principal{
+		"user@d1.com": {Username: "user@d1.com", Type: RoleRegular, Domain: "d1", Tenant: "t1"},
+	})
+	tokens, isRevoked, entries := RefreshTokens, IsRevoked, revocations.entries
+	fake := &fakeRefreshTokens{tokens: map[string]*dbtokens.DBStruct{}, revoked: map[string]bool{}}
+	RefreshTokens, IsRevoked = fake, fake.IsRevoked
+	revocations.entries = map[string]revocationEntry{}
+	t.Cleanup(func() {
+		RefreshTokens, IsRevoked, revocations.entries = tokens, isRevoked, entries
+	})
+	return fake
+}
+
+func startSession(t *testing.T) *Token {
+	t.Helper()
+	token, err := issueToken(context.Background(), &Identity{Username: "user@d1.com"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func postToken(t *testing.T, handler http.HandlerFunc, refreshToken, bearer string) (int, *Token) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refreshToken":"`+refreshToken+`"}`))
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var res struct {
+		Code int
+		Token
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Token.Token == "" {
+		return res.Code, nil
+	}
+	return http.StatusOK, &res.Token
+}
+
+func accessError(token string) error {
+	_, err := parseAccessToken(context.Background(), token)
+	return err
+}
+
+func TestRefreshRotation(t *testing.T) {
+	withRefreshTokens(t)
+	first := startSession(t)
+	code, second := postToken(t, Refresh, first.RefreshToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("refresh: code = %d", code)
+	}
+	if second.RefreshToken == first.RefreshToken || second.Token == first.Token {
+		t.Error("refresh did not rotate the tokens")
+	}
+	firstFamily, _ := parseClaims(first.Token)
+	secondFamily, _ := parseClaims(second.Token)
+	if claimString(firstFamily, "fam") != claimString(secondFamily, "fam") {
+		t.Error("rotated token left the session family")
+	}
+	code, third := postToken(t, Refresh, second.RefreshToken, "")
+	if code != http.StatusOK {
+		t.Fatalf("refresh with the rotated token: code = %d", code)
+	}
+	if err := accessError(third.Token); err != nil {
+		t.Errorf("access token after rotation: %v", err)
+	}
+	if code, _ := postToken(t, Refresh, "unknown", ""); code != http.StatusUnauthorized {
+		t.Errorf("unknown refresh token: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	fake := withRefreshTokens(t)
+	first := startSession(t)
+	other := startSession(t)
+	_, second := postToken(t, Refresh, first.RefreshToken, "")
+	if second == nil {
+		t.Fatal("refresh failed")
+	}
+	if err := accessError(second.Token); err != nil {
+		t.Fatalf("access token before reuse: %v", err)
+	}
+	if code, _ := postToken(t, Refresh, first.RefreshToken, ""); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := postToken(t, Refresh, second.RefreshToken, ""); code != http.StatusUnauthorized {
+		t.Errorf("newest token of a reused family: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	for _, token := range []string{first.Token, second.Token} {
+		if err := accessError(token); !errors.Is(err, Revoked) {
+			t.Errorf("access token of a reused family: err = %v, want %v", err, Revoked)
+		}
+	}
+	claims, _ := parseClaims(first.Token)
+	if !fake.revoked[claimString(claims, "fam")] {
+		t.Error("family not recorded as revoked")
+	}
+	if code, _ := postToken(t, Refresh, other.RefreshToken, ""); code != http.StatusOK {
+		t.Errorf("unrelated session: code = %d", code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	fake := withRefreshTokens(t)
+	session := startSession(t)
+	other := startSession(t)
+	if code, _ := postToken(t, Logout, session.RefreshToken, session.Token); code != http.StatusOK {
+		t.Fatalf("logout: code = %d", code)
+	}
+	if code, _ := postToken(t, Refresh, session.RefreshToken, ""); code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if err := accessError(session.Token); !errors.Is(err, Revoked) {
+		t.Errorf("access token after logout: err = %v, want %v", err, Revoked)
+	}
+	claims, _ := parseClaims(session.Token)
+	if !fake.revoked[claimString(claims, "jti")] || !fake.revoked[claimString(claims, "fam")] {
+		t.Errorf("logout did not record the revocations: %v", fake.revoked)
+	}
+	if err := accessError(other.Token); err != nil {
+		t.Errorf("other session after logout: %v", err)
+	}
+	if code, _ := postToken(t, Logout, "unknown", ""); code != http.StatusUnauthorized {
+		t.Errorf("logout with unknown token: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestRevocationCache(t *testing.T) {
+	fake := withRefreshTokens(t)
+	ctx := context.Background()
+	before := time.Now()
+	if revoked, err := revocations.revoked(ctx, "jti-1"); err != nil || revoked {
+		t.Fatalf("revoked = %v, %v", revoked, err)
+	}
+	entry := revocations.entries["jti-1"]
+	if entry.revoked || entry.until.Before(before.Add(RevocationCacheTTL)) || entry.until.After(time.Now().Add(RevocationCacheTTL)) {
+		t.Errorf("negative entry = %+v, want a %s window", entry, RevocationCacheTTL)
+	}
+	if RevocationCacheTTL != time.Minute {
+		t.Errorf("RevocationCacheTTL = %s, want 1m", RevocationCacheTTL)
+	}
+
+	fake.revoked["jti-1"] = true
+	if revoked, _ := revocations.revoked(ctx, "jti-1"); revoked || fake.checks != 1 {
+		t.Errorf("negative entry not served from the cache: revoked = %v, checks = %d", revoked, fake.checks)
+	}
+	revocations.entries["jti-1"] = revocationEntry{until: time.Now().Add(-time.Second)}
+	if revoked, _ := revocations.revoked(ctx, "jti-1"); !revoked || fake.checks != 2 {
+		t.Errorf("expired negative entry: revoked = %v, checks = %d", revoked, fake.checks)
+	}
+	if entry := revocations.entries["jti-1"]; !entry.revoked || entry.until.Before(time.Now().Add(TokenTTL-time.Second)) {
+		t.Errorf("positive entry = %+v, want a %s window", entry, TokenTTL)
+	}
+
+	revocations.mark("jti-2", time.Now().Add(time.Hour))
+	if revoked, _ := revocations.revoked(ctx, "jti-2"); !revoked || fake.checks != 2 {
+		t.Errorf("marked entry: revoked = %v, checks = %d", revoked, fake.checks)
+	}
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"files-back/dbase/dbtokens"
+	"files-back/dbase/dbtotp"
+	"files-back/handlers"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits       = 6
+	totpPeriod       = 30
+	totpSkew         = 1
+	recoveryCodes    = 10
+	challengePurpose = "2fa"
+)
+
+var (
+	TOTPIssuer                     = "files-back"
+	ChallengeTTL                   = time.Minute * 5
+	ClockNow                       = time.Now
+	TOTPSecrets  dbtotp.Repository = dbtotp.SQLRepository{}
+)
+
+var (
+	BadCode          = errors.New("invalid two-factor code")
+	AlreadyEnrolled  = errors.New("two-factor authentication already enabled")
+	BadChallenge     = errors.New("invalid two-factor challenge")
+	base32NoPadding  = base32.StdEncoding.WithPadding(base32.NoPadding)
+	recoveryEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+)
+
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+type Challenge struct {
+	Challenge string `json:"challenge"`
+	Expires   string `json:"expires"`
+}
+
+type codeJSON struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+func TOTPCode(secret string, counter int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+func matchTOTP(secret, code string, lastCounter int64) (int64, bool) {
+	current := totpCounter(ClockNow())
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := TOTPCode(secret, counter)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	principal := principalFrom(r)
+	if denyImpersonated(w, principal) {
+		return
+	}
+	secret := base32NoPadding.EncodeToString(randomBytes(20))
+	err := TOTPSecrets.Enroll(r.Context(), &dbtotp.DBStruct{
+		Email:  principal.Username,
+		Secret: secret,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			handlers.StatusDBAlreadyExist(AlreadyEnrolled, w)
+			return
+		}
+		handlers.ReturnError(w, err)
+		return
+	}
+	label := url.PathEscape(TOTPIssuer + ":" + principal.Username)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {TOTPIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	handlers.ResponseJSON(w, Enrollment{
+		Secret: secret,
+		URI:    "otpauth://totp/" + label + "?" + query.Encode(),
+	})
+}
+
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	principal := principalFrom(r)
+	if denyImpersonated(w, principal) {
+		return
+	}
+	var incomeCode codeJSON
+	if err := json.NewDecoder(r.Body).Decode(&incomeCode); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	totp, err := TOTPSecrets.QueryByEmail(r.Context(), principal.Username)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if totp.Confirmed {
+		handlers.StatusDBAlreadyExist(AlreadyEnrolled, w)
+		return
+	}
+	counter, ok := matchTOTP(totp.Secret, incomeCode.Code, totp.LastCounter)
+	if !ok {
+		handlers.StatusInvalidCredentials(BadCode, w)
+		return
+	}
+	totp.LastCounter = counter
+	if err := TOTPSecrets.Use(r.Context(), totp); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	codes, hashes := make([]string, recoveryCodes), make([]string, recoveryCodes)
+	for i := range codes {
+		codes[i] = recoveryEncoding.EncodeToString(randomBytes(8))
+		hashes[i] = hashToken(codes[i])
+	}
+	if err := TOTPSecrets.ReplaceRecoveryCodes(r.Context(), principal.Username, hashes); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, RecoveryCodes{Codes: codes})
+}
+
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	principal := principalFrom(r)
+	if denyImpersonated(w, principal) {
+		return
+	}
+	var incomeCode codeJSON
+	if err := json.NewDecoder(r.Body).Decode(&incomeCode); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	if err := checkSecondFactor(r.Context(), principal.Username, incomeCode.Code); err != nil {
+		handlers.StatusInvalidCredentials(err, w)
+		return
+	}
+	if err := TOTPSecrets.Delete(r.Context(), principal.Username); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.StatusDeleted(w)
+}
+
+func LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var incomeCode codeJSON
+	if err := json.NewDecoder(r.Body).Decode(&incomeCode); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	claims, err := parseClaims(incomeCode.Challenge)
+	if err != nil || claimString(claims, "purpose") != challengePurpose || claimString(claims, "jti") == "" {
+		handlers.StatusUnauthorized(BadChallenge, w)
+		return
+	}
+	challenge := dbtokens.RevokedStruct{
+		ID:        claimString(claims, "jti"),
+		ExpiresAt: claimTime(claims, "exp"),
+	}
+	used, err := revocations.revoked(r.Context(), challenge.ID)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if used {
+		handlers.StatusUnauthorized(BadChallenge, w)
+		return
+	}
+	identity := Identity{
+		Username: claimString(claims, "username"),
+		Role:     claimRole(claims),
+	}
+	username, method := identity.Username, claimString(claims, "method")+"+totp"
+	if wait := UserLimiter.Check(username); wait > 0 {
+		err := &ThrottledError{Wait: wait}
+		recordAttempt(r, method, username, "", err)
+		handlers.StatusTooManyRequests(err, w)
+		return
+	}
+	if err := checkSecondFactor(r.Context(), username, incomeCode.Code); err != nil {
+		UserLimiter.Fail(username)
+		recordAttempt(r, method, username, "", err)
+		handlers.StatusInvalidCredentials(err, w)
+		return
+	}
+	UserLimiter.Reset(username)
+	if err := RefreshTokens.Revoke(r.Context(), &challenge); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	revocations.mark(challenge.ID, challenge.ExpiresAt)
+	familyID := randomID()
+	token, err := issueToken(r.Context(), &identity, familyID)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	recordAttempt(r, method, username, familyID, nil)
+	handlers.ResponseJSON(w, token)
+}
+
+func secondFactorRequired(ctx context.Context, username string) (bool, error) {
+	totp, err := TOTPSecrets.QueryByEmail(ctx, username)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return totp.Confirmed, nil
+}
+
+func checkSecondFactor(ctx context.Context, username, code string) error {
+	totp, err := TOTPSecrets.QueryByEmail(ctx, username)
+	if err != nil || !totp.Confirmed {
+		return BadCode
+	}
+	if counter, ok := matchTOTP(totp.Secret, code, totp.LastCounter); ok {
+		totp.LastCounter = counter
+		if err := TOTPSecrets.Use(ctx, totp); err != nil {
+			return BadCode
+		}
+		return nil
+	}
+	err = TOTPSecrets.UseRecoveryCode(ctx, &dbtotp.RecoveryStruct{
+		Email:    username,
+		CodeHash: hashToken(strings.ToLower(strings.TrimSpace(code))),
+	})
+	if err != nil {
+		return BadCode
+	}
+	return nil
+}
+
+func issueChallenge(identity *Identity, method string) (*Challenge, error) {
+	expires := time.Now().Add(ChallengeTTL)
+	claims := jwt.MapClaims{
+		"username": identity.Username,
+		"purpose":  challengePurpose,
+		"method":   method,
+		"jti":      randomID(),
+		"exp":      expires.Unix(),
+	}
+	setRoleClaims(claims, identity.Role)
+	challenge, err := signClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &Challenge{
+		Challenge: challenge,
+		Expires:   expires.Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"files-back/dbase/dbloginattempts"
+	"files-back/dbase/dbtotp"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+type fakeTOTP struct {
+	mu       sync.Mutex
+	secrets  map[string]*dbtotp.DBStruct
+	recovery map[string]bool
+}
+
+func (f *fakeTOTP) QueryByEmail(ctx context.Context, email string) (*dbtotp.DBStruct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	totp, ok := f.secrets[email]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *totp
+	return &copied, nil
+}
+
+func (f *fakeTOTP) Enroll(ctx context.Context, totp *dbtotp.DBStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.secrets[totp.Email]; ok && existing.Confirmed {
+		return sql.ErrNoRows
+	}
+	f.secrets[totp.Email] = &dbtotp.DBStruct{Email: totp.Email, Secret: totp.Secret}
+	return nil
+}
+
+func (f *fakeTOTP) Use(ctx context.Context, totp *dbtotp.DBStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, ok := f.secrets[totp.Email]
+	if !ok || existing.LastCounter >= totp.LastCounter {
+		return sql.ErrNoRows
+	}
+	existing.LastCounter, existing.Confirmed = totp.LastCounter, true
+	return nil
+}
+
+func (f *fakeTOTP) Delete(ctx context.Context, email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.secrets[email]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.secrets, email)
+	return nil
+}
+
+func (f *fakeTOTP) ReplaceRecoveryCodes(ctx context.Context, email string, codeHashes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recovery = map[string]bool{}
+	for _, codeHash := range codeHashes {
+		f.recovery[email+" "+codeHash] = false
+	}
+	return nil
+}
+
+func (f *fakeTOTP) UseRecoveryCode(ctx context.Context, recovery *dbtotp.RecoveryStruct) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := recovery.Email + " " + recovery.CodeHash
+	if used, ok := f.recovery[key]; !ok || used {
+		return sql.ErrNoRows
+	}
+	f.recovery[key] = true
+	return nil
+}
+
+func withTOTP(t *testing.T, now *time.Time) *fakeTOTP {
+	withRefreshTokens(t)
+	withLimiters(t, 5, 5)
+	secrets, clock, record := TOTPSecrets, ClockNow, RecordAttempt
+	fake := &fakeTOTP{secrets: map[string]*dbtotp.DBStruct{}, recovery: map[string]bool{}}
+	TOTPSecrets = fake
+	ClockNow = func() time.Time {
+		return *now
+	}
+	RecordAttempt = func(ctx context.Context, attempt *dbloginattempts.DBStruct) error {
+		return nil
+	}
+	t.Cleanup(func() {
+		TOTPSecrets, ClockNow, RecordAttempt = secrets, clock, record
+	})
+	return fake
+}
+
+func enrolled(fake *fakeTOTP, lastCounter int64) {
+	fake.secrets["user@d1.com"] = &dbtotp.DBStruct{
+		Email:       "user@d1.com",
+		Secret:      rfcSecret,
+		Confirmed:   true,
+		LastCounter: lastCounter,
+	}
+}
+
+func codeAt(t *testing.T, now time.Time) string {
+	t.Helper()
+	code, err := TOTPCode(rfcSecret, totpCounter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func totpRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Handle("/2fa", Authenticated(http.HandlerFunc(EnrollTOTP))).Methods(http.MethodPost)
+	router.Handle("/2fa/verify", Authenticated(http.HandlerFunc(ConfirmTOTP))).Methods(http.MethodPost)
+	router.HandleFunc("/login/2fa", LoginSecondFactor).Methods(http.MethodPost)
+	return router
+}
+
+func postTOTP(bearer, path, challenge, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(codeJSON{Challenge: challenge, Code: code})
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body)))
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	totpRouter().ServeHTTP(w, r)
+	return w
+}
+
+func loginSecondFactor(t *testing.T, challenge, code string) (int, *Token) {
+	t.Helper()
+	w := postTOTP("", "/login/2fa", challenge, code)
+	var res struct {
+		Code int
+		Token
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Token.Token == "" {
+		return res.Code, nil
+	}
+	return http.StatusOK, &res.Token
+}
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		code, err := TOTPCode(rfcSecret, totpCounter(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.want {
+			t.Errorf("T=%d: code = %s, want %s", test.unix, code, test.want)
+		}
+	}
+	if code, _ := TOTPCode(strings.ToLower(rfcSecret)+"====", 1); code != "287082" {
+		t.Errorf("lower-case padded secret: code = %s", code)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	withTOTP(t, &now)
+	current := totpCounter(now)
+	tests := []struct {
+		offset      time.Duration
+		lastCounter int64
+		ok          bool
+	}{
+		{0, 0, true},
+		{-totpPeriod * time.Second, 0, true},
+		{totpPeriod * time.Second, 0, true},
+		{-2 * totpPeriod * time.Second, 0, false},
+		{2 * totpPeriod * time.Second, 0, false},
+		{0, current, false},
+		{-totpPeriod * time.Second, current, false},
+		{totpPeriod * time.Second, current, true},
+	}
+	for _, test := range tests {
+		at := now.Add(test.offset)
+		counter, ok := matchTOTP(rfcSecret, codeAt(t, at), test.lastCounter)
+		if ok != test.ok || (ok && counter != totpCounter(at)) {
+			t.Errorf("offset %s, last counter %d: counter = %d, ok = %v", test.offset, test.lastCounter, counter, ok)
+		}
+	}
+}
+
+func TestSecondFactorReplay(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	fake := withTOTP(t, &now)
+	enrolled(fake, 0)
+	ctx := context.Background()
+	code := codeAt(t, now)
+	if err := checkSecondFactor(ctx, "user@d1.com", code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := checkSecondFactor(ctx, "user@d1.com", code); !errors.Is(err, BadCode) {
+		t.Errorf("replayed code: err = %v, want %v", err, BadCode)
+	}
+	if err := checkSecondFactor(ctx, "user@d1.com", codeAt(t, now.Add(-totpPeriod*time.Second))); !errors.Is(err, BadCode) {
+		t.Errorf("code older than the last used one: err = %v, want %v", err, BadCode)
+	}
+	if err := checkSecondFactor(ctx, "user@d1.com", codeAt(t, now.Add(totpPeriod*time.Second))); err != nil {
+		t.Errorf("next code: %v", err)
+	}
+	if err := checkSecondFactor(ctx, "nobody@d1.com", code); !errors.Is(err, BadCode) {
+		t.Errorf("user without TOTP: err = %v, want %v", err, BadCode)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	fake := withTOTP(t, &now)
+	session := startSession(t)
+	w := postTOTP(session.Token, "/2fa", "", "")
+	var enrollment Enrollment
+	if err := json.NewDecoder(w.Body).Decode(&enrollment); err != nil || enrollment.Secret == "" {
+		t.Fatalf("enroll: %v, %s", err, w.Body)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Errorf("uri = %s", enrollment.URI)
+	}
+	if code := bodyCode(t, postTOTP(session.Token, "/2fa/verify", "", "000000")); code != http.StatusUnauthorized {
+		t.Errorf("confirm with a wrong code: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	code, err := TOTPCode(enrollment.Secret, totpCounter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recovery RecoveryCodes
+	if err := json.NewDecoder(postTOTP(session.Token, "/2fa/verify", "", code).Body).Decode(&recovery); err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery.Codes) != recoveryCodes || len(fake.recovery) != recoveryCodes {
+		t.Fatalf("recovery codes = %v, stored %d", recovery.Codes, len(fake.recovery))
+	}
+	if !fake.secrets["user@d1.com"].Confirmed {
+		t.Error("enrollment not confirmed")
+	}
+	if code := bodyCode(t, postTOTP(session.Token, "/2fa", "", "")); code != http.StatusBadRequest {
+		t.Errorf("enroll twice: code = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	ctx := context.Background()
+	first := " " + strings.ToUpper(recovery.Codes[0]) + " "
+	if err := checkSecondFactor(ctx, "user@d1.com", first); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if err := checkSecondFactor(ctx, "user@d1.com", recovery.Codes[0]); !errors.Is(err, BadCode) {
+		t.Errorf("reused recovery code: err = %v, want %v", err, BadCode)
+	}
+	if err := checkSecondFactor(ctx, "user@d1.com", recovery.Codes[1]); err != nil {
+		t.Errorf("second recovery code: %v", err)
+	}
+	if err := checkSecondFactor(ctx, "other@d1.com", recovery.Codes[2]); !errors.Is(err, BadCode) {
+		t.Errorf("recovery code of another user: err = %v, want %v", err, BadCode)
+	}
+}
+
+func TestLoginSecondFactor(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	fake := withTOTP(t, &now)
+	enrolled(fake, 0)
+	challenge, err := issueChallenge(&Identity{Username: "user@d1.com"}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := accessError(challenge.Challenge); !errors.Is(err, BadToken) {
+		t.Errorf("challenge used as an access token: err = %v, want %v", err, BadToken)
+	}
+	if code, _ := loginSecondFactor(t, challenge.Challenge, "000000"); code != http.StatusUnauthorized {
+		t.Errorf("wrong code: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	advanceLimiters(time.Second)
+	code, token := loginSecondFactor(t, challenge.Challenge, codeAt(t, now))
+	if code != http.StatusOK {
+		t.Fatalf("login: code = %d", code)
+	}
+	if err := accessError(token.Token); err != nil {
+		t.Errorf("access token: %v", err)
+	}
+
+	claims, _ := parseClaims(challenge.Challenge)
+	if !RefreshTokens.(*fakeRefreshTokens).revoked[claimString(claims, "jti")] {
+		t.Error("challenge not recorded as used")
+	}
+	now = now.Add(totpPeriod * time.Second)
+	if code, _ := loginSecondFactor(t, challenge.Challenge, codeAt(t, now)); code != http.StatusUnauthorized {
+		t.Errorf("reused challenge: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	revocations.entries = map[string]revocationEntry{}
+	if code, _ := loginSecondFactor(t, challenge.Challenge, codeAt(t, now)); code != http.StatusUnauthorized {
+		t.Errorf("reused challenge after a cache flush: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := loginSecondFactor(t, token.Token, codeAt(t, now)); code != http.StatusUnauthorized {
+		t.Errorf("access token as challenge: code = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
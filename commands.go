@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/dbase"
+	"files-back/dbase/migrations"
+	"files-back/handlers/imports"
+	"files-back/handlers/incoming"
+	"files-back/handlers/reconcile"
+	"flag"
+	"log"
+	"os"
+)
+
+func runCommand(name string, args []string) {
+	switch name {
+	case "import":
+		importCommand(args)
+	case "reconcile":
+		reconcileCommand(args)
+	case "migrate":
+		migrateCommand(args)
+	default:
+		log.Fatalf("unknown command %q", name)
+	}
+}
+
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	domain := flags.String("domain", "", "domain to import into")
+	tenant := flags.String("tenant", "", "tenant to import into")
+	var n incoming.Import
+	flags.StringVar(&n.BaseDN, "base", "", "ldap search base, defaults to the directory base dn")
+	flags.StringVar(&n.Filter, "filter", "", "ldap search filter, defaults to all users with mail")
+	flags.StringVar(&n.Tariff, "tariff", "", "tariff assigned to imported users")
+	flags.BoolVar(&n.Apply, "apply", false, "apply the import instead of previewing it")
+	_ = flags.Parse(args)
+	if *domain == "" || *tenant == "" || n.Tariff == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	report, err := imports.Run(context.Background(), *domain, *tenant, n, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printJSON(report)
+}
+
+func reconcileCommand(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	domain := flags.String("domain", "", "domain to reconcile")
+	fix := flags.String("fix", "", "fix drift towards directory or database, report only when empty")
+	confirm := flags.Int("confirm", 0, "number of users the fix is expected to change")
+	_ = flags.Parse(args)
+	if *domain == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	report, err := reconcile.Run(context.Background(), *domain, *fix, *confirm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printJSON(report)
+}
+
+func migrateCommand(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert with down")
+	flags.Usage = func() {
+		log.Print("usage: migrate [-steps n] up|down|status")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	ctx := context.Background()
+	switch flags.Arg(0) {
+	case "up":
+		applied, err := migrations.Up(ctx, dbase.DB)
+		logMigrations("applied", applied)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		reverted, err := migrations.Down(ctx, dbase.DB, *steps)
+		logMigrations("reverted", reverted)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := migrations.StatusOf(ctx, dbase.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printJSON(status)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+func logMigrations(action string, done []migrations.Migration) {
+	if len(done) == 0 {
+		log.Printf("no migrations %s", action)
+	}
+	for _, migration := range done {
+		log.Printf("%s migration %d_%s", action, migration.Version, migration.Name)
+	}
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
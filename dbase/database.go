@@ -1,19 +1,25 @@
 package dbase
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"log"
 	"os"
+	"time"
 )
 
 var (
-	DB *sqlx.DB
+	DB               *sqlx.DB
+	StatementTimeout = time.Second * 30
 )
 
 func InitDB(dbuser, dbpwd, dbname, dbhost, dbport string) {
 	dataSourceName := fmt.Sprintf("postgres://%v:%v@%v:%v/%v", dbuser, dbpwd, dbhost, dbport, dbname)
+	if StatementTimeout > 0 {
+		dataSourceName += fmt.Sprintf("?statement_timeout=%d", StatementTimeout.Milliseconds())
+	}
 
 	db, err := sqlx.Connect("pgx", dataSourceName)
 	if err != nil {
@@ -23,21 +29,12 @@ func InitDB(dbuser, dbpwd, dbname, dbhost, dbport string) {
 	DB = db
 }
 
-func AppendWhere(where string) string {
-	if len(where) == 0 {
-		where = "WHERE "
-	} else {
-		where += "AND "
-	}
-	return where
-}
-
-func ExecWithChekOne(data interface{}, sqlQuery string) error {
-	tx, err := DB.Beginx()
+func ExecWithChekOne(ctx context.Context, data interface{}, sqlQuery string) error {
+	tx, err := DB.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	result, err := tx.NamedExec(sqlQuery, data)
+	result, err := tx.NamedExecContext(ctx, sqlQuery, data)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
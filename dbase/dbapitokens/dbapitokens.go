@@ -0,0 +1,164 @@
+package dbapitokens
+
+import (
+	"context"
+	"files-back/dbase"
+	"log"
+	"strings"
+	"time"
+)
+
+type DBStruct struct {
+	ID             int64      `db:"id"`
+	Name           string     `db:"name"`
+	TokenHash      string     `db:"token_hash"`
+	Owner          *string    `db:"owner_email"`
+	ServiceAccount *string    `db:"service_account"`
+	Scopes         string     `db:"scopes"`
+	CreatedAt      *time.Time `db:"created_at"`
+	ExpiresAt      *time.Time `db:"expires_at"`
+	LastUsedAt     *time.Time `db:"last_used_at"`
+}
+
+func (dbToken *DBStruct) toJSON() *JSONStruct {
+	return &JSONStruct{
+		ID:             dbToken.ID,
+		Name:           dbToken.Name,
+		Owner:          dbToken.Owner,
+		ServiceAccount: dbToken.ServiceAccount,
+		Scopes:         strings.Fields(dbToken.Scopes),
+		CreatedAt:      dbToken.CreatedAt,
+		ExpiresAt:      dbToken.ExpiresAt,
+		LastUsedAt:     dbToken.LastUsedAt,
+	}
+}
+
+type JSONStruct struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	Token          string     `json:"token,omitempty"`
+	Owner          *string    `json:"owner,omitempty"`
+	ServiceAccount *string    `json:"serviceAccount,omitempty"`
+	Scopes         []string   `json:"scopes"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt     *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type Filter struct {
+	ID             *int64  `db:"id"`
+	Owner          *string `db:"owner_email"`
+	ServiceAccount *string `db:"service_account"`
+}
+
+func selectTokens() *dbase.Query {
+	return dbase.Select(
+		"a.id as id", "a.name as name", "a.token_hash as token_hash", "a.owner_email as owner_email", "s.name as service_account",
+		"a.scopes as scopes", "a.created_at as created_at", "a.expires_at as expires_at", "a.last_used_at as last_used_at").
+		From("api_tokens a").
+		LeftJoin("service_accounts s", "s.id = a.service_account_id")
+}
+
+func Query(ctx context.Context, f Filter) ([]*JSONStruct, error) {
+	var res []*JSONStruct
+	q := selectTokens().Where(dbase.IsNull("a.revoked_at"))
+	if f.Owner != nil {
+		q.Where(dbase.Eq("a.owner_email", *f.Owner))
+	}
+	if f.ServiceAccount != nil {
+		q.Where(dbase.Eq("s.name", *f.ServiceAccount))
+	}
+	if f.ID != nil {
+		q.Where(dbase.Eq("a.id", *f.ID))
+	}
+	rows, err := q.OrderBy("a.id").Rows(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	for rows.Next() {
+		var token DBStruct
+		if err := rows.StructScan(&token); err != nil {
+			return res, err
+		}
+		res = append(res, token.toJSON())
+	}
+	return res, nil
+}
+
+func QueryByHash(ctx context.Context, tokenHash string) (*DBStruct, error) {
+	var res DBStruct
+	err := selectTokens().
+		Where(
+			dbase.Eq("a.token_hash", tokenHash),
+			dbase.IsNull("a.revoked_at"),
+			dbase.Or(dbase.IsNull("a.expires_at"), dbase.Expr("a.expires_at > now()"))).
+		Get(ctx, &res)
+	if err != nil {
+		return nil, err
+	}
+	_, err = dbase.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = now() WHERE id = $1`, res.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func Insert(ctx context.Context, token *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, token, `
+			INSERT INTO api_tokens
+				(name, token_hash, owner_email, service_account_id, scopes, expires_at)
+			SELECT
+			    :name, :token_hash, CAST (:owner_email AS text), s.id, :scopes, CAST (:expires_at AS timestamptz)
+			FROM (SELECT 1) AS one
+			LEFT JOIN service_accounts s ON s.name = CAST (:service_account AS text) AND s.type NOT IN ('disabled', 'deleted')
+			WHERE (CAST (:service_account AS text) IS NULL AND CAST (:owner_email AS text) IS NOT NULL) OR s.id IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	return dbase.DB.GetContext(ctx, token, `SELECT id, created_at FROM api_tokens WHERE token_hash = $1`, token.TokenHash)
+}
+
+func Revoke(ctx context.Context, f Filter) error {
+	err := dbase.ExecWithChekOne(ctx, f, `
+		UPDATE api_tokens SET revoked_at = now()
+		WHERE id = :id AND revoked_at IS NULL
+			AND (CAST (:owner_email AS text) IS NULL OR owner_email = :owner_email)
+			AND (CAST (:service_account AS text) IS NULL OR service_account_id IN
+				(SELECT s.id FROM service_accounts s WHERE s.name = :service_account))
+			RETURNING id`,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type Repository interface {
+	Query(ctx context.Context, f Filter) ([]*JSONStruct, error)
+	QueryByHash(ctx context.Context, tokenHash string) (*DBStruct, error)
+	Insert(ctx context.Context, token *DBStruct) error
+	Revoke(ctx context.Context, f Filter) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, f Filter) ([]*JSONStruct, error) {
+	return Query(ctx, f)
+}
+
+func (SQLRepository) QueryByHash(ctx context.Context, tokenHash string) (*DBStruct, error) {
+	return QueryByHash(ctx, tokenHash)
+}
+
+func (SQLRepository) Insert(ctx context.Context, token *DBStruct) error {
+	return Insert(ctx, token)
+}
+
+func (SQLRepository) Revoke(ctx context.Context, f Filter) error {
+	return Revoke(ctx, f)
+}
@@ -0,0 +1,114 @@
+package dbasetest
+
+import (
+	"bytes"
+	"files-back/dbase"
+	"files-back/handlers/params"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func Combinations(build func(p params.QueryParams) *dbase.Query, filters ...string) string {
+	var b strings.Builder
+	for mask := 0; mask < 1<<len(filters); mask++ {
+		var p params.QueryParams
+		var names []string
+		for i, filter := range filters {
+			if mask&(1<<i) != 0 {
+				apply(&p, filter)
+				names = append(names, filter)
+			}
+		}
+		if len(names) == 0 {
+			names = []string{"none"}
+		}
+		b.WriteString("-- " + strings.Join(names, ", ") + "\n")
+		b.WriteString(Format(build(p)) + "\n")
+	}
+	return b.String()
+}
+
+func apply(p *params.QueryParams, filter string) {
+	value := filter + "-value"
+	switch filter {
+	case "search":
+		p.Search = &value
+	case "email":
+		p.Email = &value
+	case "domain":
+		p.DomainName = &value
+	case "tenant":
+		p.TenantName = &value
+	case "plan":
+		p.PlanName = &value
+	case "tariff":
+		p.TariffName = &value
+	case "group":
+		p.GroupName = &value
+	case "disabled":
+		p.ShowDisabled = true
+	case "deleted":
+		p.ShowDeleted = true
+	default:
+		panic("dbasetest: unknown filter " + filter)
+	}
+}
+
+func Format(q *dbase.Query) string {
+	args := q.Args()
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) < len(names[j]) || (len(names[i]) == len(names[j]) && names[i] < names[j])
+	})
+	var b strings.Builder
+	b.WriteString(q.SQL() + "\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  :%s = %#v\n", name, args[name])
+	}
+	return b.String()
+}
+
+func Golden(t *testing.T, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", t.Name()+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if bytes.Equal(want, []byte(got)) {
+		return
+	}
+	wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			t.Fatalf("%s:%d differs\n got: %s\nwant: %s", path, i+1, g, w)
+		}
+	}
+}
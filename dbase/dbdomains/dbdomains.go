@@ -1,13 +1,13 @@
 package dbdomains
 
 import (
+	"context"
 	"files-back/dbase"
 	"files-back/handlers/params"
-	"github.com/jmoiron/sqlx"
-	"log"
 )
 
 type DBStruct struct {
+	ID           int64   `db:"id"`
 	Name         string  `db:"name"`
 	OldName      *string `db:"old_name"`
 	Organisation *string `db:"organisation"`
@@ -19,9 +19,27 @@ type DBStruct struct {
 	Version      *string `db:"version"`
 	Type         *string `db:"type"`
 	Description  *string `db:"description"`
+	DirectoryStruct
+	SAMLStruct
 }
 
-func (dbDomain *DBStruct) toJSON() *JSONStruct {
+type DirectoryStruct struct {
+	Server       *string `db:"ldap_server"`
+	BaseDN       *string `db:"ldap_base_dn"`
+	BindUsername *string `db:"ldap_bind_username"`
+	BindPassword *string `db:"ldap_bind_password"`
+	UserFilter   *string `db:"ldap_user_filter"`
+	MailDomain   *string `db:"ldap_mail_domain"`
+}
+
+type SAMLStruct struct {
+	EntityID       *string `db:"saml_entity_id"`
+	SSOURL         *string `db:"saml_sso_url"`
+	Certificate    *string `db:"saml_certificate"`
+	EmailAttribute *string `db:"saml_email_attribute"`
+}
+
+func (dbDomain *DBStruct) ToJSON() *JSONStruct {
 	unknown := "unknown"
 	domainResponse := JSONStruct{
 		Name:         &dbDomain.Name,
@@ -43,80 +61,113 @@ func (dbDomain *DBStruct) toJSON() *JSONStruct {
 	} else {
 		domainResponse.Description = &unknown
 	}
+	if dbDomain.DirectoryStruct.Server != nil {
+		domainResponse.Directory = &DirectoryJSON{
+			Server:       dbDomain.DirectoryStruct.Server,
+			BaseDN:       dbDomain.DirectoryStruct.BaseDN,
+			BindUsername: dbDomain.DirectoryStruct.BindUsername,
+			UserFilter:   dbDomain.DirectoryStruct.UserFilter,
+			MailDomain:   dbDomain.DirectoryStruct.MailDomain,
+		}
+	}
+	if dbDomain.SAMLStruct.EntityID != nil {
+		domainResponse.SAML = &SAMLJSON{
+			EntityID:       dbDomain.SAMLStruct.EntityID,
+			SSOURL:         dbDomain.SAMLStruct.SSOURL,
+			Certificate:    dbDomain.SAMLStruct.Certificate,
+			EmailAttribute: dbDomain.SAMLStruct.EmailAttribute,
+		}
+	}
 	return &domainResponse
 }
 
 type JSONStruct struct {
-	Name         *string `json:"name,omitempty"`
-	Organisation *string `json:"organisation,omitempty"`
-	PrimaryURL   *string `json:"primaryUrl,omitempty"`
-	AdminURL     *string `json:"adminUrl,omitempty"`
-	Version      *string `json:"version,omitempty"`
-	Type         *string `json:"type,omitempty"`
-	DataPath     *string `json:"data_path,omitempty"`
-	UserName     *string `json:"user_name,omitempty"`
-	Description  *string `json:"description,omitempty"`
-}
-
-func Query(p params.QueryParams) ([]*JSONStruct, error) {
-	var res []*JSONStruct
-	var rows *sqlx.Rows
-	var err error
-	var sqlWhere string
-	if p.Search != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(name LIKE :search OR organisation LIKE :search) "
-	}
-	if p.DomainName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(name = :domain_name) "
-	}
-	if !p.ShowDeleted && !p.ShowDisabled {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(type NOT IN ('disabled', 'deleted')) "
+	Name         *string        `json:"name,omitempty"`
+	Organisation *string        `json:"organisation,omitempty"`
+	PrimaryURL   *string        `json:"primaryUrl,omitempty"`
+	AdminURL     *string        `json:"adminUrl,omitempty"`
+	Version      *string        `json:"version,omitempty"`
+	Type         *string        `json:"type,omitempty"`
+	DataPath     *string        `json:"data_path,omitempty"`
+	UserName     *string        `json:"user_name,omitempty"`
+	Description  *string        `json:"description,omitempty"`
+	Directory    *DirectoryJSON `json:"directory,omitempty"`
+	SAML         *SAMLJSON      `json:"saml,omitempty"`
+}
+
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Name, ID: row.ID}
+}
+
+type DirectoryJSON struct {
+	Server       *string `json:"server"`
+	BaseDN       *string `json:"baseDn,omitempty"`
+	BindUsername *string `json:"bindUsername,omitempty"`
+	UserFilter   *string `json:"userFilter,omitempty"`
+	MailDomain   *string `json:"mailDomain,omitempty"`
+}
+
+type SAMLJSON struct {
+	EntityID       *string `json:"entityId"`
+	SSOURL         *string `json:"ssoUrl,omitempty"`
+	Certificate    *string `json:"certificate,omitempty"`
+	EmailAttribute *string `json:"emailAttribute,omitempty"`
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectDomains(p)
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "name", "id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
 	}
-	if p.ShowDisabled && !p.ShowDeleted {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(type NOT IN ('deleted')) "
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.ToJSON())
 	}
-	sqlQuery := `
-		SELECT
-		       name as name,  primary_url, admin_url, organisation, version, type, data_path, user_name
-		FROM domains ` + sqlWhere + `
-		LIMIT :limit
-		    OFFSET :offset`
-	rows, err = dbase.DB.NamedQuery(sqlQuery, p)
-	if err != nil {
-		return res, err
+	return &res, nil
+}
+
+func selectDomains(p params.QueryParams) *dbase.Query {
+	q := dbase.Select(
+		"id as id", "name", "primary_url", "admin_url", "organisation", "version", "type", "data_path", "user_name",
+		"ldap_server", "ldap_base_dn", "ldap_bind_username", "ldap_user_filter", "ldap_mail_domain",
+		"saml_entity_id", "saml_sso_url", "saml_certificate", "saml_email_attribute").
+		From("domains")
+	if p.Search != nil {
+		q.Where(dbase.Or(dbase.Like("name", *p.Search), dbase.Like("organisation", *p.Search)))
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-	for rows.Next() {
-		var resultDomain DBStruct
-		err := rows.StructScan(&resultDomain)
-		if err != nil {
-			return res, err
-		}
-		domainResponse := resultDomain.toJSON()
-		res = append(res, domainResponse)
+	if p.DomainName != nil {
+		q.Where(dbase.Eq("name", *p.DomainName))
 	}
-	return res, nil
+	q.Where(dbase.Visible("type", p.ShowDisabled, p.ShowDeleted))
+	return q
 }
 
-func Delete(p params.QueryParams) error {
-	err := dbase.ExecWithChekOne(p, "UPDATE domains SET type=:delete WHERE name=:name RETURNING id")
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, "UPDATE domains SET type=:delete WHERE name=:domain_name RETURNING id")
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func Insert(domain *DBStruct) error {
-	err := dbase.ExecWithChekOne(domain,
+func Insert(ctx context.Context, domain *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, domain,
 		`
 			INSERT INTO domains
-				(name, organisation, admin_url, primary_url, data_path, password, user_name, type, description)
+				(name, organisation, admin_url, primary_url, data_path, password, user_name, type, description,
+				 ldap_server, ldap_base_dn, ldap_bind_username, ldap_bind_password, ldap_user_filter, ldap_mail_domain,
+				 saml_entity_id, saml_sso_url, saml_certificate, saml_email_attribute)
 			VALUES
-			    (:name, :organisation, :admin_url, :primary_url, :data_path, :password, :user_name, CAST (:type AS domain_type), :description)
+			    (:name, :organisation, :admin_url, :primary_url, :data_path, :password, :user_name, CAST (:type AS domain_type), :description,
+			     :ldap_server, :ldap_base_dn, :ldap_bind_username, :ldap_bind_password, :ldap_user_filter, :ldap_mail_domain,
+			     :saml_entity_id, :saml_sso_url, :saml_certificate, :saml_email_attribute)
 			RETURNING id`)
 	if err != nil {
 		return err
@@ -124,8 +175,8 @@ func Insert(domain *DBStruct) error {
 	return nil
 }
 
-func Update(domain *DBStruct) error {
-	err := dbase.ExecWithChekOne(domain, `
+func Update(ctx context.Context, domain *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, domain, `
 			UPDATE domains
 			SET 
 			    name = :name,
@@ -136,7 +187,17 @@ func Update(domain *DBStruct) error {
 			    password = :password,
 			    user_name = :user_name,
 			    type = CAST (:type AS domain_type),
-			    description = :description
+			    description = :description,
+			    ldap_server = :ldap_server,
+			    ldap_base_dn = :ldap_base_dn,
+			    ldap_bind_username = :ldap_bind_username,
+			    ldap_bind_password = COALESCE(:ldap_bind_password, CASE WHEN CAST (:ldap_server AS text) IS NULL THEN NULL ELSE ldap_bind_password END),
+			    ldap_user_filter = :ldap_user_filter,
+			    ldap_mail_domain = :ldap_mail_domain,
+			    saml_entity_id = :saml_entity_id,
+			    saml_sso_url = :saml_sso_url,
+			    saml_certificate = :saml_certificate,
+			    saml_email_attribute = :saml_email_attribute
 			WHERE
 				name = :old_name
 			RETURNING id`,
@@ -146,3 +207,56 @@ func Update(domain *DBStruct) error {
 	}
 	return nil
 }
+
+func QueryDirectory(ctx context.Context, domainName, mailDomain string) (*DBStruct, error) {
+	var res DBStruct
+	err := dbase.DB.GetContext(ctx, &res, `
+		SELECT
+		       name, ldap_server, ldap_base_dn, ldap_bind_username, ldap_bind_password, ldap_user_filter, ldap_mail_domain
+		FROM domains
+		WHERE ldap_server IS NOT NULL AND type NOT IN ('disabled', 'deleted')
+			AND (name = $1 OR ($1 = '' AND ldap_mail_domain = $2))
+		LIMIT 1`, domainName, mailDomain)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func QuerySAML(ctx context.Context, domainName string) (*DBStruct, error) {
+	var res DBStruct
+	err := dbase.DB.GetContext(ctx, &res, `
+		SELECT
+		       name, saml_entity_id, saml_sso_url, saml_certificate, saml_email_attribute
+		FROM domains
+		WHERE saml_entity_id IS NOT NULL AND type NOT IN ('disabled', 'deleted') AND name = $1`, domainName)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type Repository interface {
+	Query(ctx context.Context, p params.QueryParams) (*List, error)
+	Insert(ctx context.Context, domain *DBStruct) error
+	Update(ctx context.Context, domain *DBStruct) error
+	Delete(ctx context.Context, p params.QueryParams) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	return Query(ctx, p)
+}
+
+func (SQLRepository) Insert(ctx context.Context, domain *DBStruct) error {
+	return Insert(ctx, domain)
+}
+
+func (SQLRepository) Update(ctx context.Context, domain *DBStruct) error {
+	return Update(ctx, domain)
+}
+
+func (SQLRepository) Delete(ctx context.Context, p params.QueryParams) error {
+	return Delete(ctx, p)
+}
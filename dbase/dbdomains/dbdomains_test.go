@@ -0,0 +1,10 @@
+package dbdomains
+
+import (
+	"files-back/dbase/dbasetest"
+	"testing"
+)
+
+func TestSelectDomainsSQL(t *testing.T) {
+	dbasetest.Golden(t, dbasetest.Combinations(selectDomains, "search", "domain", "disabled", "deleted"))
+}
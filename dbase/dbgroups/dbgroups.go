@@ -1,15 +1,15 @@
 package dbgroups
 
 import (
+	"context"
 	"files-back/dbase"
 	"files-back/dbase/dbdomains"
 	"files-back/dbase/dbtenants"
 	"files-back/handlers/params"
-	"github.com/jmoiron/sqlx"
-	"log"
 )
 
 type DBStruct struct {
+	ID      int64               `db:"id"`
 	Name    string              `db:"name"`
 	OldName *string             `db:"old_name"`
 	Type    *string             `db:"type"`
@@ -17,7 +17,7 @@ type DBStruct struct {
 	Domain  *dbdomains.DBStruct `db:"domain"`
 }
 
-func (dbGroups *DBStruct) toJSON() *JSONStruct {
+func (dbGroups *DBStruct) ToJSON() *JSONStruct {
 	return &JSONStruct{
 		Name:   &dbGroups.Name,
 		Tenant: &dbGroups.Tenant.Name,
@@ -31,51 +31,53 @@ type JSONStruct struct {
 	Tenant *string `json:"tenant,omitempty"`
 }
 
-func Query(p params.QueryParams) ([]*JSONStruct, error) {
-	var res []*JSONStruct
-	var rows *sqlx.Rows
-	var err error
-	var sqlWhere string
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Name, ID: row.ID}
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectGroups(p)
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "g.name", "g.id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
+	}
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func selectGroups(p params.QueryParams) *dbase.Query {
+	q := dbase.Select(
+		"g.id as id", "g.name as name", "g.type as type", `t.name as "tenant.name"`, `d.name as "domain.name"`).
+		From("groups g").
+		Join("tenants t", "t.id = g.tenant_id").
+		Join("domains d", "d.id = t.domain_id")
 	if p.Search != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(g.name LIKE :search) "
+		q.Where(dbase.Like("g.name", *p.Search))
+	}
+	if p.DomainName != nil {
+		q.Where(dbase.Eq("d.name", *p.DomainName))
 	}
 	if p.TenantName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.name = :tenant_name AND d.name = :domain_name) "
+		q.Where(dbase.Eq("t.name", *p.TenantName))
 	}
 	if p.GroupName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(g.name = :group_name) "
+		q.Where(dbase.Eq("g.name", *p.GroupName))
 	}
-	sqlQuery := `
-		SELECT
-				g.name as name, g.type as type, t.name as "tenant.name", d.name as "domain.name"
-		FROM groups g
-		JOIN tenants t ON t.id = g.tenant_id
-		JOIN domains d ON d.id = t.domain_id ` + sqlWhere + `
-		LIMIT :limit
-		    OFFSET :offset`
-	rows, err = dbase.DB.NamedQuery(sqlQuery, p)
-	if err != nil {
-		return res, err
-	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-	for rows.Next() {
-		var resultDomain DBStruct
-		err := rows.StructScan(&resultDomain)
-		if err != nil {
-			return res, err
-		}
-		domainResponse := resultDomain.toJSON()
-		res = append(res, domainResponse)
-	}
-	return res, nil
+	q.Where(dbase.Visible("g.type", p.ShowDisabled, p.ShowDeleted))
+	return q
 }
 
-func Delete(p params.QueryParams) error {
-	err := dbase.ExecWithChekOne(p, `
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, `
 		UPDATE groups SET type = :delete WHERE id IN 
 			(SELECT
 		       g.id
@@ -92,8 +94,8 @@ func Delete(p params.QueryParams) error {
 	return nil
 }
 
-func Insert(group *DBStruct) error {
-	err := dbase.ExecWithChekOne(group, `INSERT INTO groups
+func Insert(ctx context.Context, group *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, group, `INSERT INTO groups
 							(name, type, tenant_id)
 						SELECT
 							:name, CAST (:type AS group_type), t.id
@@ -107,8 +109,8 @@ func Insert(group *DBStruct) error {
 	return nil
 }
 
-func Update(group *DBStruct) error {
-	err := dbase.ExecWithChekOne(group,
+func Update(ctx context.Context, group *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, group,
 		`UPDATE groups
 			SET 
 			    name = :name,
@@ -128,3 +130,50 @@ func Update(group *DBStruct) error {
 	}
 	return nil
 }
+
+func Purge(ctx context.Context, group *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, group, `
+		DELETE FROM groups WHERE id IN
+			(SELECT
+		       g.id
+		    FROM groups g
+		    JOIN tenants t ON t.id = g.tenant_id
+			JOIN domains d ON d.id = t.domain_id
+			WHERE
+				t.name=:tenant.name AND g.name=:name AND d.name=:domain.name)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type Repository interface {
+	Query(ctx context.Context, p params.QueryParams) (*List, error)
+	Insert(ctx context.Context, group *DBStruct) error
+	Update(ctx context.Context, group *DBStruct) error
+	Delete(ctx context.Context, p params.QueryParams) error
+	Purge(ctx context.Context, group *DBStruct) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	return Query(ctx, p)
+}
+
+func (SQLRepository) Insert(ctx context.Context, group *DBStruct) error {
+	return Insert(ctx, group)
+}
+
+func (SQLRepository) Update(ctx context.Context, group *DBStruct) error {
+	return Update(ctx, group)
+}
+
+func (SQLRepository) Delete(ctx context.Context, p params.QueryParams) error {
+	return Delete(ctx, p)
+}
+
+func (SQLRepository) Purge(ctx context.Context, group *DBStruct) error {
+	return Purge(ctx, group)
+}
@@ -0,0 +1,10 @@
+package dbgroups
+
+import (
+	"files-back/dbase/dbasetest"
+	"testing"
+)
+
+func TestSelectGroupsSQL(t *testing.T) {
+	dbasetest.Golden(t, dbasetest.Combinations(selectGroups, "search", "domain", "tenant", "group", "disabled", "deleted"))
+}
@@ -0,0 +1,119 @@
+package dbimpersonations
+
+import (
+	"context"
+	"files-back/dbase"
+	"log"
+	"time"
+)
+
+type DBStruct struct {
+	ID           string     `db:"id" json:"id"`
+	Impersonator string     `db:"impersonator" json:"impersonator"`
+	Subject      string     `db:"subject" json:"subject"`
+	Domain       string     `db:"domain_name" json:"domain"`
+	Tenant       string     `db:"tenant_name" json:"tenant"`
+	Reason       string     `db:"reason" json:"reason"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	ExpiresAt    time.Time  `db:"expires_at" json:"expiresAt"`
+	EndedAt      *time.Time `db:"ended_at" json:"endedAt,omitempty"`
+	Requests     int        `db:"requests" json:"requests"`
+}
+
+type RequestStruct struct {
+	ID        int64     `db:"id" json:"-"`
+	SessionID string    `db:"session_id" json:"-"`
+	Method    string    `db:"method" json:"method"`
+	Path      string    `db:"path" json:"path"`
+	Status    *int      `db:"status" json:"status,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+type Filter struct {
+	ID     *string `db:"id"`
+	Domain *string `db:"domain_name"`
+	Tenant *string `db:"tenant_name"`
+}
+
+func Insert(ctx context.Context, session *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, session, `
+			INSERT INTO impersonation_sessions
+				(id, impersonator, subject, domain_name, tenant_name, reason, expires_at)
+			VALUES
+			    (:id, :impersonator, :subject, :domain_name, :tenant_name, :reason, :expires_at)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func End(ctx context.Context, id string) (*DBStruct, error) {
+	var res DBStruct
+	err := dbase.DB.GetContext(ctx, &res, `
+		UPDATE impersonation_sessions SET ended_at = now()
+		WHERE id = $1 AND ended_at IS NULL
+		RETURNING id, impersonator, subject, domain_name, tenant_name, reason, created_at, expires_at, ended_at`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func Query(ctx context.Context, f Filter) ([]*DBStruct, error) {
+	res := []*DBStruct{}
+	rows, err := dbase.DB.NamedQueryContext(ctx, `
+		SELECT
+				s.id, s.impersonator, s.subject, s.domain_name, s.tenant_name, s.reason, s.created_at, s.expires_at, s.ended_at,
+				(SELECT COUNT(*) FROM impersonation_requests r WHERE r.session_id = s.id) as requests
+		FROM impersonation_sessions s
+		WHERE (CAST (:id AS text) IS NULL OR s.id = :id)
+			AND (CAST (:domain_name AS text) IS NULL OR (s.domain_name = :domain_name AND (s.tenant_name = :tenant_name
+				OR EXISTS (SELECT 1 FROM impersonation_requests r WHERE r.session_id = s.id
+					AND (r.path = '/domains/' || CAST (:domain_name AS text) || '/tenants/' || CAST (:tenant_name AS text)
+						OR r.path LIKE '/domains/' || CAST (:domain_name AS text) || '/tenants/' || CAST (:tenant_name AS text) || '/%')))))
+		ORDER BY s.created_at DESC`, f)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	for rows.Next() {
+		var session DBStruct
+		if err := rows.StructScan(&session); err != nil {
+			return nil, err
+		}
+		res = append(res, &session)
+	}
+	return res, rows.Err()
+}
+
+func RecordRequest(ctx context.Context, request *RequestStruct) error {
+	return dbase.DB.GetContext(ctx, &request.ID, `
+		INSERT INTO impersonation_requests
+			(session_id, method, path)
+		VALUES
+			($1, $2, $3)
+		RETURNING id`, request.SessionID, request.Method, request.Path)
+}
+
+func RecordStatus(ctx context.Context, request *RequestStruct) error {
+	_, err := dbase.DB.ExecContext(ctx, `UPDATE impersonation_requests SET status = $1 WHERE id = $2`, request.Status, request.ID)
+	return err
+}
+
+func QueryRequests(ctx context.Context, sessionID string) ([]*RequestStruct, error) {
+	res := []*RequestStruct{}
+	err := dbase.DB.SelectContext(ctx, &res, `
+		SELECT id, session_id, method, path, status, created_at
+		FROM impersonation_requests
+		WHERE session_id = $1
+		ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,115 @@
+package dbimport
+
+import (
+	"context"
+	"files-back/dbase"
+	"github.com/jmoiron/sqlx"
+)
+
+type UserStruct struct {
+	Email       string `db:"email"`
+	DisplayName string `db:"display_name"`
+	TenantID    int64  `db:"tenant_id"`
+	TariffID    int64  `db:"tariff_id"`
+}
+
+type GroupStruct struct {
+	Name     string `db:"name"`
+	TenantID int64  `db:"tenant_id"`
+}
+
+type DBStruct struct {
+	DomainName string `db:"domain_name"`
+	TenantName string `db:"tenant_name"`
+	TariffName string `db:"tariff_name"`
+	Users      []UserStruct
+	Groups     []string
+}
+
+func ExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+	res := []string{}
+	if len(emails) == 0 {
+		return res, nil
+	}
+	query, args, err := sqlx.In(`SELECT email FROM users WHERE email IN (?)`, emails)
+	if err != nil {
+		return nil, err
+	}
+	err = dbase.DB.SelectContext(ctx, &res, dbase.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func ExistingGroups(ctx context.Context, domainName, tenantName string) ([]string, error) {
+	res := []string{}
+	err := dbase.DB.SelectContext(ctx, &res, `
+		SELECT g.name
+		FROM groups g
+		JOIN tenants t ON t.id = g.tenant_id
+		JOIN domains d ON d.id = t.domain_id
+		WHERE d.name = $1 AND t.name = $2`, domainName, tenantName)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func CheckTariff(ctx context.Context, domainName, tariffName string) error {
+	var id int64
+	return dbase.DB.GetContext(ctx, &id, `
+		SELECT tf.id
+		FROM tariffs tf
+		JOIN plans p ON p.id = tf.plan_id
+		JOIN domains d ON d.id = p.domain_id
+		WHERE d.name = $1 AND tf.name = $2
+		LIMIT 1`, domainName, tariffName)
+}
+
+func Apply(ctx context.Context, data *DBStruct) error {
+	tx, err := dbase.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var tenantID, tariffID int64
+	err = tx.GetContext(ctx, &tenantID, `
+		SELECT t.id
+		FROM tenants t
+		JOIN domains d ON d.id = t.domain_id
+		WHERE d.name = $1 AND t.name = $2`, data.DomainName, data.TenantName)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = tx.GetContext(ctx, &tariffID, `
+		SELECT tf.id
+		FROM tariffs tf
+		JOIN plans p ON p.id = tf.plan_id
+		JOIN domains d ON d.id = p.domain_id
+		WHERE d.name = $1 AND tf.name = $2
+		LIMIT 1`, data.DomainName, data.TariffName)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, name := range data.Groups {
+		_, err = tx.NamedExecContext(ctx, `INSERT INTO groups (name, type, tenant_id)
+			VALUES (:name, CAST ('regular' AS group_type), :tenant_id)`,
+			GroupStruct{Name: name, TenantID: tenantID})
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	for _, user := range data.Users {
+		user.TenantID, user.TariffID = tenantID, tariffID
+		_, err = tx.NamedExecContext(ctx, `INSERT INTO users (email, display_name, type, tariff_id, tenant_id)
+			VALUES (:email, :display_name, CAST ('regular' AS user_type), :tariff_id, :tenant_id)`, user)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,101 @@
+package dbloginattempts
+
+import (
+	"context"
+	"files-back/dbase"
+	"log"
+	"time"
+)
+
+type DBStruct struct {
+	Username  string    `db:"username"`
+	IP        string    `db:"ip"`
+	UserAgent *string   `db:"user_agent"`
+	Method    *string   `db:"method"`
+	FamilyID  *string   `db:"family_id"`
+	Success   bool      `db:"success"`
+	Reason    *string   `db:"reason"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (dbAttempt *DBStruct) toJSON() *JSONStruct {
+	return &JSONStruct{
+		Username:  dbAttempt.Username,
+		IP:        dbAttempt.IP,
+		UserAgent: dbAttempt.UserAgent,
+		Method:    dbAttempt.Method,
+		Success:   dbAttempt.Success,
+		Reason:    dbAttempt.Reason,
+		CreatedAt: dbAttempt.CreatedAt,
+	}
+}
+
+type JSONStruct struct {
+	Username  string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent *string   `json:"userAgent,omitempty"`
+	Method    *string   `json:"method,omitempty"`
+	Success   bool      `json:"success"`
+	Reason    *string   `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Filter struct {
+	Email   *string    `db:"email"`
+	Domain  *string    `db:"domain_name"`
+	Tenant  *string    `db:"tenant_name"`
+	Success *bool      `db:"success"`
+	Since   *time.Time `db:"since"`
+	Until   *time.Time `db:"until"`
+	Limit   *int       `db:"limit"`
+	Offset  *int       `db:"offset"`
+}
+
+func Insert(ctx context.Context, attempt *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, attempt, `
+			INSERT INTO login_attempts
+				(username, ip, user_agent, method, family_id, success, reason)
+			VALUES
+			    (:username, :ip, :user_agent, :method, :family_id, :success, :reason)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func Query(ctx context.Context, f Filter) ([]*JSONStruct, error) {
+	res := []*JSONStruct{}
+	rows, err := dbase.DB.NamedQueryContext(ctx, `
+		SELECT
+				a.username, a.ip, a.user_agent, a.method, a.success, a.reason, a.created_at
+		FROM login_attempts a
+		LEFT JOIN users u ON u.email = a.username
+		LEFT JOIN tenants t ON t.id = u.tenant_id
+		LEFT JOIN domains d ON d.id = t.domain_id
+		WHERE (CAST (:email AS text) IS NULL OR a.username = :email)
+			AND (CAST (:domain_name AS text) IS NULL OR d.name = :domain_name)
+			AND (CAST (:tenant_name AS text) IS NULL OR t.name = :tenant_name)
+			AND (CAST (:success AS boolean) IS NULL OR a.success = :success)
+			AND (CAST (:since AS timestamptz) IS NULL OR a.created_at >= :since)
+			AND (CAST (:until AS timestamptz) IS NULL OR a.created_at < :until)
+		ORDER BY a.created_at DESC
+		LIMIT :limit
+		    OFFSET :offset`, f)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	for rows.Next() {
+		var attempt DBStruct
+		if err := rows.StructScan(&attempt); err != nil {
+			return nil, err
+		}
+		res = append(res, attempt.toJSON())
+	}
+	return res, nil
+}
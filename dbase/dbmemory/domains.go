@@ -0,0 +1,125 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbdomains"
+	"files-back/handlers/params"
+)
+
+type domainRow struct {
+	id int64
+	dbdomains.DBStruct
+}
+
+type domains struct {
+	*Store
+}
+
+func (s *Store) Domains() dbdomains.Repository {
+	return domains{s}
+}
+
+func (r domains) Query(ctx context.Context, p params.QueryParams) (*dbdomains.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []*dbdomains.DBStruct
+	for _, row := range r.domains {
+		if !like(p.Search, &row.Name, row.Organisation) || !matches(p.DomainName, row.Name) || !visible(row.Type, p) {
+			continue
+		}
+		domain := cloneDomain(&row.DBStruct)
+		domain.ID = row.id
+		rows = append(rows, domain)
+	}
+	start, end, page, err := paginate(rows, p)
+	if err != nil {
+		return nil, err
+	}
+	res := dbdomains.List{Items: []*dbdomains.JSONStruct{}, Page: *page}
+	for _, row := range rows[start:end] {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func (r domains) Insert(ctx context.Context, domain *dbdomains.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.domainByName(domain.Name) != nil {
+		return uniqueViolation("domains_name_key")
+	}
+	r.domains = append(r.domains, &domainRow{id: r.id(), DBStruct: *cloneDomain(domain)})
+	return nil
+}
+
+func (r domains) Update(ctx context.Context, domain *dbdomains.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row := r.domainByName(value(domain.OldName))
+	if domain.OldName == nil || row == nil {
+		return sql.ErrNoRows
+	}
+	if other := r.domainByName(domain.Name); other != nil && other != row {
+		return uniqueViolation("domains_name_key")
+	}
+	updated := cloneDomain(domain)
+	if updated.BindPassword == nil && updated.Server != nil {
+		updated.BindPassword = row.BindPassword
+	}
+	updated.Version = row.Version
+	row.DBStruct = *updated
+	return nil
+}
+
+func (r domains) Delete(ctx context.Context, p params.QueryParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row := r.domainByName(value(p.DomainName))
+	if p.DomainName == nil || row == nil {
+		return sql.ErrNoRows
+	}
+	row.Type = clone(p.DeleteType)
+	return nil
+}
+
+func cloneDomain(domain *dbdomains.DBStruct) *dbdomains.DBStruct {
+	return &dbdomains.DBStruct{
+		Name:         domain.Name,
+		Organisation: clone(domain.Organisation),
+		PrimaryURL:   clone(domain.PrimaryURL),
+		AdminURL:     clone(domain.AdminURL),
+		DataPath:     clone(domain.DataPath),
+		Password:     clone(domain.Password),
+		UserName:     clone(domain.UserName),
+		Version:      clone(domain.Version),
+		Type:         clone(domain.Type),
+		Description:  clone(domain.Description),
+		DirectoryStruct: dbdomains.DirectoryStruct{
+			Server:       clone(domain.Server),
+			BaseDN:       clone(domain.BaseDN),
+			BindUsername: clone(domain.BindUsername),
+			BindPassword: clone(domain.BindPassword),
+			UserFilter:   clone(domain.UserFilter),
+			MailDomain:   clone(domain.MailDomain),
+		},
+		SAMLStruct: dbdomains.SAMLStruct{
+			EntityID:       clone(domain.EntityID),
+			SSOURL:         clone(domain.SSOURL),
+			Certificate:    clone(domain.Certificate),
+			EmailAttribute: clone(domain.EmailAttribute),
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbgroups"
+	"files-back/dbase/dbtenants"
+	"files-back/handlers/params"
+)
+
+type groupRow struct {
+	id       int64
+	tenantID int64
+	dbgroups.DBStruct
+}
+
+type groups struct {
+	*Store
+}
+
+func (s *Store) Groups() dbgroups.Repository {
+	return groups{s}
+}
+
+func (r groups) Query(ctx context.Context, p params.QueryParams) (*dbgroups.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []*dbgroups.DBStruct
+	for _, row := range r.groups {
+		tenant := r.tenantByID(row.tenantID)
+		domain := r.domainByID(tenant.domainID)
+		if !like(p.Search, &row.Name) || !matches(p.DomainName, domain.Name) ||
+			!matches(p.TenantName, tenant.Name) || !matches(p.GroupName, row.Name) || !visible(row.Type, p) {
+			continue
+		}
+		group := cloneGroup(&row.DBStruct)
+		group.Tenant = &dbtenants.DBStruct{Name: tenant.Name}
+		group.Domain = &dbdomains.DBStruct{Name: domain.Name}
+		group.ID = row.id
+		rows = append(rows, group)
+	}
+	start, end, page, err := paginate(rows, p)
+	if err != nil {
+		return nil, err
+	}
+	res := dbgroups.List{Items: []*dbgroups.JSONStruct{}, Page: *page}
+	for _, row := range rows[start:end] {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func (r groups) Insert(ctx context.Context, group *dbgroups.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, err := r.groupTenant(group)
+	if err != nil {
+		return err
+	}
+	if r.groupByName(tenant.id, group.Name) != nil {
+		return uniqueViolation("groups_tenant_id_name_key")
+	}
+	r.groups = append(r.groups, &groupRow{id: r.id(), tenantID: tenant.id, DBStruct: *cloneGroup(group)})
+	return nil
+}
+
+func (r groups) Update(ctx context.Context, group *dbgroups.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, err := r.groupTenant(group)
+	if err != nil {
+		return err
+	}
+	row := r.groupByName(tenant.id, value(group.OldName))
+	if group.OldName == nil || row == nil {
+		return sql.ErrNoRows
+	}
+	if other := r.groupByName(tenant.id, group.Name); other != nil && other != row {
+		return uniqueViolation("groups_tenant_id_name_key")
+	}
+	row.DBStruct = *cloneGroup(group)
+	return nil
+}
+
+func (r groups) Delete(ctx context.Context, p params.QueryParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, tenant, err := r.tenantIn(p.DomainName, p.TenantName)
+	if err != nil {
+		return err
+	}
+	row := r.groupByName(tenant.id, value(p.GroupName))
+	if p.GroupName == nil || row == nil {
+		return sql.ErrNoRows
+	}
+	row.Type = clone(p.DeleteType)
+	return nil
+}
+
+func (r groups) Purge(ctx context.Context, group *dbgroups.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, err := r.groupTenant(group)
+	if err != nil {
+		return err
+	}
+	for i, row := range r.groups {
+		if row.tenantID == tenant.id && row.Name == group.Name {
+			r.groups = append(r.groups[:i], r.groups[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (r groups) groupByName(tenantID int64, name string) *groupRow {
+	for _, row := range r.groups {
+		if row.tenantID == tenantID && row.Name == name {
+			return row
+		}
+	}
+	return nil
+}
+
+func (r groups) groupTenant(group *dbgroups.DBStruct) (*tenantRow, error) {
+	if group.Domain == nil || group.Tenant == nil {
+		return nil, sql.ErrNoRows
+	}
+	_, tenant, err := r.tenantIn(&group.Domain.Name, &group.Tenant.Name)
+	return tenant, err
+}
+
+func cloneGroup(group *dbgroups.DBStruct) *dbgroups.DBStruct {
+	return &dbgroups.DBStruct{
+		Name: group.Name,
+		Type: clone(group.Type),
+	}
+}
@@ -0,0 +1,77 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbpasswordresets"
+	"time"
+)
+
+type resetRow struct {
+	used bool
+	dbpasswordresets.DBStruct
+}
+
+type passwordResets struct {
+	*Store
+}
+
+func (s *Store) PasswordResets() dbpasswordresets.Repository {
+	return passwordResets{s}
+}
+
+func (r passwordResets) Insert(ctx context.Context, reset *dbpasswordresets.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, row := range r.resets {
+		if row.TokenHash == reset.TokenHash {
+			return uniqueViolation("password_resets_token_hash_key")
+		}
+	}
+	r.resets = append(r.resets, &resetRow{DBStruct: *reset})
+	return nil
+}
+
+func (r passwordResets) Use(ctx context.Context, tokenHash string, apply func(email string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	var reset *resetRow
+	for _, row := range r.resets {
+		if row.TokenHash == tokenHash && !row.used && row.ExpiresAt.After(time.Now()) {
+			reset = row
+			break
+		}
+	}
+	if reset == nil {
+		r.mu.Unlock()
+		return sql.ErrNoRows
+	}
+	reset.used = true
+	r.mu.Unlock()
+	if err := apply(reset.Email); err != nil {
+		r.mu.Lock()
+		reset.used = false
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r passwordResets) Invalidate(ctx context.Context, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, row := range r.resets {
+		if row.Email == email {
+			row.used = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbplans"
+	"files-back/handlers/params"
+	"time"
+)
+
+type planRow struct {
+	id       int64
+	domainID int64
+	dbplans.DBStruct
+}
+
+type plans struct {
+	*Store
+}
+
+func (s *Store) Plans() dbplans.Repository {
+	return plans{s}
+}
+
+func (r plans) Query(ctx context.Context, p params.QueryParams) (*dbplans.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []*dbplans.DBStruct
+	for _, row := range r.plans {
+		domain := r.domainByID(row.domainID)
+		if !like(p.Search, &row.Name, &domain.Name, domain.Organisation) ||
+			!matches(p.DomainName, domain.Name) || !matches(p.PlanName, row.Name) || !visible(row.Type, p) {
+			continue
+		}
+		plan := clonePlan(&row.DBStruct)
+		plan.DomainName = clone(&domain.Name)
+		plan.ID = row.id
+		rows = append(rows, plan)
+	}
+	start, end, page, err := paginate(rows, p)
+	if err != nil {
+		return nil, err
+	}
+	res := dbplans.List{Items: []*dbplans.JSONStruct{}, Page: *page}
+	for _, row := range rows[start:end] {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func (r plans) Insert(ctx context.Context, plan *dbplans.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain := r.domainByName(value(plan.DomainName))
+	if domain == nil {
+		return sql.ErrNoRows
+	}
+	if r.planByName(domain.id, plan.Name) != nil {
+		return uniqueViolation("plans_domain_id_name_key")
+	}
+	r.plans = append(r.plans, &planRow{id: r.id(), domainID: domain.id, DBStruct: *clonePlan(plan)})
+	return nil
+}
+
+func (r plans) Update(ctx context.Context, plan *dbplans.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain := r.domainByName(value(plan.DomainName))
+	if domain == nil || plan.OldName == nil {
+		return sql.ErrNoRows
+	}
+	row := r.planByName(domain.id, *plan.OldName)
+	if row == nil {
+		return sql.ErrNoRows
+	}
+	if other := r.planByName(domain.id, plan.Name); other != nil && other != row {
+		return uniqueViolation("plans_domain_id_name_key")
+	}
+	row.DBStruct = *clonePlan(plan)
+	return nil
+}
+
+func (r plans) Delete(ctx context.Context, p params.QueryParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain := r.domainByName(value(p.DomainName))
+	if domain == nil || p.PlanName == nil {
+		return sql.ErrNoRows
+	}
+	row := r.planByName(domain.id, *p.PlanName)
+	if row == nil {
+		return sql.ErrNoRows
+	}
+	row.Type = clone(p.DeleteType)
+	return nil
+}
+
+func clonePlan(plan *dbplans.DBStruct) *dbplans.DBStruct {
+	return &dbplans.DBStruct{
+		Name:        plan.Name,
+		FromDate:    cloneTime(plan.FromDate),
+		DueDate:     cloneTime(plan.DueDate),
+		Type:        clone(plan.Type),
+		Description: clone(plan.Description),
+	}
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
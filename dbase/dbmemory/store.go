@@ -0,0 +1,195 @@
+package dbmemory
+
+import (
+	"database/sql"
+	"files-back/dbase"
+	"files-back/handlers/params"
+	"github.com/jackc/pgx"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	typeDisabled = "disabled"
+	typeDeleted  = "deleted"
+)
+
+type Store struct {
+	mu      sync.Mutex
+	nextID  int64
+	domains []*domainRow
+	plans   []*planRow
+	tariffs []*tariffRow
+	tenants []*tenantRow
+	users   []*userRow
+	groups  []*groupRow
+	resets  []*resetRow
+}
+
+func New() *Store {
+	return &Store{}
+}
+
+func (s *Store) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Store) domainByName(name string) *domainRow {
+	for _, row := range s.domains {
+		if row.Name == name {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) domainByID(id int64) *domainRow {
+	for _, row := range s.domains {
+		if row.id == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) planByName(domainID int64, name string) *planRow {
+	for _, row := range s.plans {
+		if row.domainID == domainID && row.Name == name {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) planByID(id int64) *planRow {
+	for _, row := range s.plans {
+		if row.id == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) tariffByName(domainID int64, name string) *tariffRow {
+	for _, row := range s.tariffs {
+		if row.Name == name && s.planByID(row.planID).domainID == domainID {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) tenantByName(domainID int64, name string) *tenantRow {
+	for _, row := range s.tenants {
+		if row.domainID == domainID && row.Name == name {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) tenantByID(id int64) *tenantRow {
+	for _, row := range s.tenants {
+		if row.id == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Store) tenantIn(domainName, tenantName *string) (*domainRow, *tenantRow, error) {
+	domain := s.domainByName(value(domainName))
+	if domain == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	tenant := s.tenantByName(domain.id, value(tenantName))
+	if tenant == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	return domain, tenant, nil
+}
+
+func uniqueViolation(constraint string) error {
+	return &pgx.PgError{
+		Severity:       "ERROR",
+		Code:           "23505",
+		Message:        "duplicate key value violates unique constraint \"" + constraint + "\"",
+		ConstraintName: constraint,
+	}
+}
+
+func visible(typ *string, p params.QueryParams) bool {
+	switch value(typ) {
+	case typeDeleted:
+		return p.ShowDeleted
+	case typeDisabled:
+		return p.ShowDisabled || p.ShowDeleted
+	default:
+		return true
+	}
+}
+
+func matches(filter *string, v string) bool {
+	return filter == nil || *filter == v
+}
+
+func like(pattern *string, values ...*string) bool {
+	if pattern == nil {
+		return true
+	}
+	expr := regexp.QuoteMeta(*pattern)
+	expr = strings.NewReplacer("%", ".*", "_", ".").Replace(expr)
+	re := regexp.MustCompile("^(?s:" + expr + ")$")
+	for _, v := range values {
+		if v != nil && re.MatchString(*v) {
+			return true
+		}
+	}
+	return false
+}
+
+func paginate(rows interface{}, p params.QueryParams) (int, int, *dbase.Page, error) {
+	v := reflect.ValueOf(rows)
+	cursorAt := func(i int) dbase.Cursor {
+		return v.Index(i).Interface().(dbase.Keyed).Cursor()
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return cursorAt(i).Less(cursorAt(j))
+	})
+	return dbase.Window(v.Len(), cursorAt, dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func clone(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+func cloneInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func cloneBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	v := *b
+	return &v
+}
@@ -0,0 +1,152 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbplans"
+	"files-back/dbase/dbtariffs"
+	"files-back/handlers/params"
+)
+
+type tariffRow struct {
+	id     int64
+	planID int64
+	dbtariffs.DBStruct
+}
+
+type tariffs struct {
+	*Store
+}
+
+func (s *Store) Tariffs() dbtariffs.Repository {
+	return tariffs{s}
+}
+
+func (r tariffs) Query(ctx context.Context, p params.QueryParams) (*dbtariffs.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []*dbtariffs.DBStruct
+	for _, row := range r.tariffs {
+		plan := r.planByID(row.planID)
+		domain := r.domainByID(plan.domainID)
+		if !like(p.Search, &row.Name, &plan.Name, row.Description) || !matches(p.TariffName, row.Name) ||
+			!matches(p.DomainName, domain.Name) || !matches(p.PlanName, plan.Name) || !visible(row.Type, p) {
+			continue
+		}
+		tariff := cloneTariff(&row.DBStruct)
+		tariff.Domain = &dbdomains.DBStruct{Name: domain.Name}
+		tariff.Plan = &dbplans.DBStruct{Name: plan.Name}
+		tariff.ID = row.id
+		rows = append(rows, tariff)
+	}
+	start, end, page, err := paginate(rows, p)
+	if err != nil {
+		return nil, err
+	}
+	res := dbtariffs.List{Items: []*dbtariffs.JSONStruct{}, Page: *page}
+	for _, row := range rows[start:end] {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func (r tariffs) Insert(ctx context.Context, tariff *dbtariffs.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plan, err := r.tariffPlan(tariff)
+	if err != nil {
+		return err
+	}
+	for _, row := range r.tariffs {
+		if row.planID == plan.id && row.Name == tariff.Name {
+			return uniqueViolation("tariffs_plan_id_name_key")
+		}
+	}
+	r.tariffs = append(r.tariffs, &tariffRow{id: r.id(), planID: plan.id, DBStruct: *cloneTariff(tariff)})
+	return nil
+}
+
+func (r tariffs) Update(ctx context.Context, tariff *dbtariffs.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plan, err := r.tariffPlan(tariff)
+	if err != nil {
+		return err
+	}
+	var row *tariffRow
+	for _, candidate := range r.tariffs {
+		if candidate.planID != plan.id {
+			continue
+		}
+		if tariff.OldName != nil && candidate.Name == *tariff.OldName {
+			row = candidate
+		} else if candidate.Name == tariff.Name {
+			return uniqueViolation("tariffs_plan_id_name_key")
+		}
+	}
+	if row == nil {
+		return sql.ErrNoRows
+	}
+	row.DBStruct = *cloneTariff(tariff)
+	return nil
+}
+
+func (r tariffs) Delete(ctx context.Context, p params.QueryParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain := r.domainByName(value(p.DomainName))
+	if domain == nil {
+		return sql.ErrNoRows
+	}
+	plan := r.planByName(domain.id, value(p.PlanName))
+	if plan == nil {
+		return sql.ErrNoRows
+	}
+	for _, row := range r.tariffs {
+		if row.planID == plan.id && row.Name == value(p.TariffName) {
+			row.Type = clone(p.DeleteType)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (r tariffs) tariffPlan(tariff *dbtariffs.DBStruct) (*planRow, error) {
+	if tariff.Domain == nil || tariff.Plan == nil {
+		return nil, sql.ErrNoRows
+	}
+	domain := r.domainByName(tariff.Domain.Name)
+	if domain == nil {
+		return nil, sql.ErrNoRows
+	}
+	plan := r.planByName(domain.id, tariff.Plan.Name)
+	if plan == nil {
+		return nil, sql.ErrNoRows
+	}
+	return plan, nil
+}
+
+func cloneTariff(tariff *dbtariffs.DBStruct) *dbtariffs.DBStruct {
+	return &dbtariffs.DBStruct{
+		Name:        tariff.Name,
+		Type:        clone(tariff.Type),
+		Description: clone(tariff.Description),
+		DiskQuota:   cloneInt(tariff.DiskQuota),
+		Office:      cloneBool(tariff.Office),
+		Price:       cloneInt(tariff.Price),
+		Regularity:  clone(tariff.Regularity),
+	}
+}
@@ -0,0 +1,139 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbplans"
+	"files-back/dbase/dbtenants"
+	"files-back/handlers/params"
+)
+
+type tenantRow struct {
+	id       int64
+	domainID int64
+	planID   int64
+	dbtenants.DBStruct
+}
+
+type tenants struct {
+	*Store
+}
+
+func (s *Store) Tenants() dbtenants.Repository {
+	return tenants{s}
+}
+
+func (r tenants) Query(ctx context.Context, p params.QueryParams) (*dbtenants.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []*dbtenants.DBStruct
+	for _, row := range r.tenants {
+		domain, plan := r.domainByID(row.domainID), r.planByID(row.planID)
+		if !like(p.Search, &row.Name, row.Organisation) || !matches(p.DomainName, domain.Name) ||
+			!matches(p.TenantName, row.Name) || !matches(p.PlanName, plan.Name) || !visible(row.Type, p) {
+			continue
+		}
+		tenant := cloneTenant(&row.DBStruct)
+		tenant.Domain = &dbdomains.DBStruct{Name: domain.Name}
+		tenant.Plan = &dbplans.DBStruct{Name: plan.Name}
+		tenant.ID = row.id
+		rows = append(rows, tenant)
+	}
+	start, end, page, err := paginate(rows, p)
+	if err != nil {
+		return nil, err
+	}
+	res := dbtenants.List{Items: []*dbtenants.JSONStruct{}, Page: *page}
+	for _, row := range rows[start:end] {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func (r tenants) Insert(ctx context.Context, tenant *dbtenants.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain, plan, err := r.tenantParents(tenant)
+	if err != nil {
+		return err
+	}
+	if r.tenantByName(domain.id, tenant.Name) != nil {
+		return uniqueViolation("tenants_domain_id_name_key")
+	}
+	r.tenants = append(r.tenants, &tenantRow{
+		id:       r.id(),
+		domainID: domain.id,
+		planID:   plan.id,
+		DBStruct: *cloneTenant(tenant),
+	})
+	return nil
+}
+
+func (r tenants) Update(ctx context.Context, tenant *dbtenants.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	domain, plan, err := r.tenantParents(tenant)
+	if err != nil {
+		return err
+	}
+	row := r.tenantByName(domain.id, value(tenant.OldName))
+	if tenant.OldName == nil || row == nil {
+		return sql.ErrNoRows
+	}
+	if other := r.tenantByName(domain.id, tenant.Name); other != nil && other != row {
+		return uniqueViolation("tenants_domain_id_name_key")
+	}
+	row.planID = plan.id
+	row.DBStruct = *cloneTenant(tenant)
+	return nil
+}
+
+func (r tenants) Delete(ctx context.Context, p params.QueryParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, row, err := r.tenantIn(p.DomainName, p.TenantName)
+	if err != nil {
+		return err
+	}
+	row.Type = clone(p.DeleteType)
+	return nil
+}
+
+func (r tenants) tenantParents(tenant *dbtenants.DBStruct) (*domainRow, *planRow, error) {
+	if tenant.Domain == nil || tenant.Plan == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	domain := r.domainByName(tenant.Domain.Name)
+	if domain == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	plan := r.planByName(domain.id, tenant.Plan.Name)
+	if plan == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	return domain, plan, nil
+}
+
+func cloneTenant(tenant *dbtenants.DBStruct) *dbtenants.DBStruct {
+	return &dbtenants.DBStruct{
+		Name:         tenant.Name,
+		Organisation: clone(tenant.Organisation),
+		OrderForm:    clone(tenant.OrderForm),
+		OrderLink:    clone(tenant.OrderLink),
+		Type:         clone(tenant.Type),
+		Description:  clone(tenant.Description),
+	}
+}
@@ -0,0 +1,168 @@
+package dbmemory
+
+import (
+	"context"
+	"database/sql"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbtenants"
+	"files-back/dbase/dbusers"
+	"files-back/handlers/params"
+)
+
+type userRow struct {
+	id       int64
+	tenantID int64
+	tariffID int64
+	dbusers.DBStruct
+}
+
+type users struct {
+	*Store
+}
+
+func (s *Store) Users() dbusers.Repository {
+	return users{s}
+}
+
+func (r users) Query(ctx context.Context, p params.QueryParams) (*dbusers.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []*dbusers.DBStruct
+	for _, row := range r.users {
+		tenant := r.tenantByID(row.tenantID)
+		domain := r.domainByID(tenant.domainID)
+		if !like(p.Search, &row.Email, row.DisplayName) || !matches(p.DomainName, domain.Name) ||
+			!matches(p.TenantName, tenant.Name) || !matches(p.Email, row.Email) || !visible(row.Type, p) {
+			continue
+		}
+		user := cloneUser(&row.DBStruct)
+		user.Tenant = &dbtenants.DBStruct{Name: tenant.Name}
+		user.Domain = &dbdomains.DBStruct{Name: domain.Name}
+		user.ID = row.id
+		rows = append(rows, user)
+	}
+	start, end, page, err := paginate(rows, p)
+	if err != nil {
+		return nil, err
+	}
+	res := dbusers.List{Items: []*dbusers.JSONStruct{}, Page: *page}
+	for _, row := range rows[start:end] {
+		res.Items = append(res.Items, row.ToJSON())
+	}
+	return &res, nil
+}
+
+func (r users) Insert(ctx context.Context, user *dbusers.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, tariff, err := r.userParents(user)
+	if err != nil {
+		return err
+	}
+	if r.userByEmail(user.Email) != nil {
+		return uniqueViolation("users_email_key")
+	}
+	r.users = append(r.users, &userRow{
+		id:       r.id(),
+		tenantID: tenant.id,
+		tariffID: tariff.id,
+		DBStruct: *cloneUser(user),
+	})
+	return nil
+}
+
+func (r users) Update(ctx context.Context, user *dbusers.DBStruct) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, tariff, err := r.userParents(user)
+	if err != nil {
+		return err
+	}
+	row := r.userByEmail(value(user.OldEmail))
+	if user.OldEmail == nil || row == nil || row.tenantID != tenant.id {
+		return sql.ErrNoRows
+	}
+	if other := r.userByEmail(user.Email); other != nil && other != row {
+		return uniqueViolation("users_email_key")
+	}
+	row.tariffID = tariff.id
+	free := row.Free
+	row.DBStruct = *cloneUser(user)
+	row.Free = free
+	return nil
+}
+
+func (r users) Delete(ctx context.Context, p params.QueryParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, tenant, err := r.tenantIn(p.DomainName, p.TenantName)
+	if err != nil {
+		return err
+	}
+	row := r.userByEmail(value(p.Email))
+	if p.Email == nil || row == nil || row.tenantID != tenant.id {
+		return sql.ErrNoRows
+	}
+	row.Type = clone(p.DeleteType)
+	return nil
+}
+
+func (r users) Purge(ctx context.Context, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, row := range r.users {
+		if row.Email == email {
+			r.users = append(r.users[:i], r.users[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (r users) userByEmail(email string) *userRow {
+	for _, row := range r.users {
+		if row.Email == email {
+			return row
+		}
+	}
+	return nil
+}
+
+func (r users) userParents(user *dbusers.DBStruct) (*tenantRow, *tariffRow, error) {
+	if user.Domain == nil || user.Tenant == nil || user.Tariff == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	domain, tenant, err := r.tenantIn(&user.Domain.Name, &user.Tenant.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	tariff := r.tariffByName(domain.id, user.Tariff.Name)
+	if tariff == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	return tenant, tariff, nil
+}
+
+func cloneUser(user *dbusers.DBStruct) *dbusers.DBStruct {
+	return &dbusers.DBStruct{
+		Email:       user.Email,
+		DisplayName: clone(user.DisplayName),
+		Type:        clone(user.Type),
+		Free:        cloneInt(user.Free),
+	}
+}
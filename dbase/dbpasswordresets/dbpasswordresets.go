@@ -0,0 +1,72 @@
+package dbpasswordresets
+
+import (
+	"context"
+	"files-back/dbase"
+	"time"
+)
+
+type DBStruct struct {
+	TokenHash string    `db:"token_hash"`
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func Insert(ctx context.Context, reset *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, reset, `
+			INSERT INTO password_resets
+				(token_hash, email, expires_at)
+			VALUES
+			    (:token_hash, :email, :expires_at)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func Use(ctx context.Context, tokenHash string, apply func(email string) error) error {
+	tx, err := dbase.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var email string
+	err = tx.GetContext(ctx, &email, `
+		UPDATE password_resets SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING email`, tokenHash)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := apply(email); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func Invalidate(ctx context.Context, email string) error {
+	_, err := dbase.DB.ExecContext(ctx, `UPDATE password_resets SET used_at = now() WHERE email = $1 AND used_at IS NULL`, email)
+	return err
+}
+
+type Repository interface {
+	Insert(ctx context.Context, reset *DBStruct) error
+	Use(ctx context.Context, tokenHash string, apply func(email string) error) error
+	Invalidate(ctx context.Context, email string) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Insert(ctx context.Context, reset *DBStruct) error {
+	return Insert(ctx, reset)
+}
+
+func (SQLRepository) Use(ctx context.Context, tokenHash string, apply func(email string) error) error {
+	return Use(ctx, tokenHash, apply)
+}
+
+func (SQLRepository) Invalidate(ctx context.Context, email string) error {
+	return Invalidate(ctx, email)
+}
@@ -1,14 +1,14 @@
 package dbplans
 
 import (
+	"context"
 	"files-back/dbase"
 	"files-back/handlers/params"
-	"github.com/jmoiron/sqlx"
-	"log"
 	"time"
 )
 
 type DBStruct struct {
+	ID          int64      `db:"id"`
 	Name        string     `db:"name"`
 	OldName     *string    `db:"old_name"`
 	DomainName  *string    `db:"domain_name"`
@@ -18,7 +18,7 @@ type DBStruct struct {
 	Description *string    `db:"description"`
 }
 
-func (dbDomain *DBStruct) toJSON() *JSONStruct {
+func (dbDomain *DBStruct) ToJSON() *JSONStruct {
 	unknown := "unknown"
 	domainResponse := JSONStruct{
 		Name:       &dbDomain.Name,
@@ -45,56 +45,50 @@ type JSONStruct struct {
 	Description *string    `json:"description,omitempty"`
 }
 
-func Query(p params.QueryParams) ([]*JSONStruct, error) {
-	var res []*JSONStruct
-	var rows *sqlx.Rows
-	var err error
-	var sqlWhere string
-	if p.Search != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(p.name LIKE :search OR d.name LIKE :search OR d.organisation LIKE :search) "
-	}
-	if p.DomainName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(d.name = :domain_name) "
-	}
-	if p.DomainName != nil && p.PlanName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(d.name = :domain_name AND p.name = :plan_name) "
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Name, ID: row.ID}
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectPlans(p)
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "p.name", "p.id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
 	}
-	if !p.ShowDeleted && !p.ShowDisabled {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(p.type NOT IN ('disabled', 'deleted')) "
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.ToJSON())
 	}
-	if p.ShowDisabled && !p.ShowDeleted {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(p.type NOT IN ('deleted')) "
+	return &res, nil
+}
+
+func selectPlans(p params.QueryParams) *dbase.Query {
+	q := dbase.Select(
+		"p.id as id", "p.name as name", "d.name as domain_name", "p.from_date as from_date", "p.due_date as due_date",
+		"p.type as type", "p.description as description").
+		From("plans p").
+		Join("domains d", "d.id = p.domain_id")
+	if p.Search != nil {
+		q.Where(dbase.Or(dbase.Like("p.name", *p.Search), dbase.Like("d.name", *p.Search), dbase.Like("d.organisation", *p.Search)))
 	}
-	sqlQuery := `
-		SELECT
-		       p.name as name, d.name as domain_name, p.from_date as from_date, p.due_date as due_date, p.type as type, p.description as description
-		FROM plans p
-		JOIN domains d ON d.id = p.domain_id ` + sqlWhere + `
-		LIMIT :limit
-		    OFFSET :offset`
-	rows, err = dbase.DB.NamedQuery(sqlQuery, p)
-	if err != nil {
-		return res, err
+	if p.DomainName != nil {
+		q.Where(dbase.Eq("d.name", *p.DomainName))
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-	for rows.Next() {
-		var resultDomain DBStruct
-		err := rows.StructScan(&resultDomain)
-		if err != nil {
-			return res, err
-		}
-		domainResponse := resultDomain.toJSON()
-		res = append(res, domainResponse)
+	if p.PlanName != nil {
+		q.Where(dbase.Eq("p.name", *p.PlanName))
 	}
-	return res, nil
+	q.Where(dbase.Visible("p.type", p.ShowDisabled, p.ShowDeleted))
+	return q
 }
 
-func Delete(p params.QueryParams) error {
-	err := dbase.ExecWithChekOne(p, `
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, `
 		UPDATE plans SET type = :delete WHERE id IN 
 			(SELECT
 		       p.id
@@ -110,8 +104,8 @@ func Delete(p params.QueryParams) error {
 	return nil
 }
 
-func Insert(plan *DBStruct) error {
-	err := dbase.ExecWithChekOne(plan,
+func Insert(ctx context.Context, plan *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, plan,
 		`INSERT INTO plans
 				(name, from_date, description, due_date, type, domain_id)
 			SELECT
@@ -125,8 +119,8 @@ func Insert(plan *DBStruct) error {
 	return nil
 }
 
-func Update(plan *DBStruct) error {
-	err := dbase.ExecWithChekOne(plan,
+func Update(ctx context.Context, plan *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, plan,
 		`UPDATE plans
 			SET 
 			    name = :name,
@@ -148,3 +142,28 @@ func Update(plan *DBStruct) error {
 	}
 	return nil
 }
+
+type Repository interface {
+	Query(ctx context.Context, p params.QueryParams) (*List, error)
+	Insert(ctx context.Context, plan *DBStruct) error
+	Update(ctx context.Context, plan *DBStruct) error
+	Delete(ctx context.Context, p params.QueryParams) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	return Query(ctx, p)
+}
+
+func (SQLRepository) Insert(ctx context.Context, plan *DBStruct) error {
+	return Insert(ctx, plan)
+}
+
+func (SQLRepository) Update(ctx context.Context, plan *DBStruct) error {
+	return Update(ctx, plan)
+}
+
+func (SQLRepository) Delete(ctx context.Context, p params.QueryParams) error {
+	return Delete(ctx, p)
+}
@@ -0,0 +1,10 @@
+package dbplans
+
+import (
+	"files-back/dbase/dbasetest"
+	"testing"
+)
+
+func TestSelectPlansSQL(t *testing.T) {
+	dbasetest.Golden(t, dbasetest.Combinations(selectPlans, "search", "domain", "plan", "disabled", "deleted"))
+}
@@ -0,0 +1,132 @@
+package dbserviceaccounts
+
+import (
+	"context"
+	"files-back/dbase"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbtenants"
+	"files-back/handlers/params"
+)
+
+type DBStruct struct {
+	ID          int64               `db:"id"`
+	Name        string              `db:"name"`
+	Type        *string             `db:"type"`
+	Description *string             `db:"description"`
+	Certificate *string             `db:"certificate_subject"`
+	Domain      *dbdomains.DBStruct `db:"domain"`
+	Tenant      *dbtenants.DBStruct `db:"tenant"`
+}
+
+func (dbAccount *DBStruct) toJSON() *JSONStruct {
+	return &JSONStruct{
+		Name:        &dbAccount.Name,
+		Type:        dbAccount.Type,
+		Description: dbAccount.Description,
+		Certificate: dbAccount.Certificate,
+		Domain:      &dbAccount.Domain.Name,
+		Tenant:      &dbAccount.Tenant.Name,
+	}
+}
+
+type JSONStruct struct {
+	Name        *string `json:"name"`
+	Type        *string `json:"type"`
+	Description *string `json:"description,omitempty"`
+	Certificate *string `json:"certificateSubject,omitempty"`
+	Domain      *string `json:"domain,omitempty"`
+	Tenant      *string `json:"tenant,omitempty"`
+}
+
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Name, ID: row.ID}
+}
+
+func selectAccounts() *dbase.Query {
+	return dbase.Select(
+		"s.id as id", "s.name as name", "s.type as type", "s.description as description", "s.certificate_subject as certificate_subject",
+		`COALESCE(d.name, '') as "domain.name"`, `COALESCE(t.name, '') as "tenant.name"`).
+		From("service_accounts s").
+		LeftJoin("domains d", "d.id = s.domain_id").
+		LeftJoin("tenants t", "t.id = s.tenant_id")
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectAccounts()
+	if p.Search != nil {
+		q.Where(dbase.Or(dbase.Like("s.name", *p.Search), dbase.Like("s.description", *p.Search)))
+	}
+	if p.ServiceAccount != nil {
+		q.Where(dbase.Eq("s.name", *p.ServiceAccount))
+	}
+	q.Where(dbase.Visible("s.type", p.ShowDisabled, p.ShowDeleted))
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "s.name", "s.id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
+	}
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.toJSON())
+	}
+	return &res, nil
+}
+
+func QueryByName(ctx context.Context, name string) (*DBStruct, error) {
+	var res DBStruct
+	err := selectAccounts().
+		Where(dbase.Eq("s.name", name), dbase.Visible("s.type", false, false)).
+		Get(ctx, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func QueryByCertificate(ctx context.Context, identities []string) (*DBStruct, error) {
+	subjects := make([]interface{}, 0, len(identities))
+	for _, identity := range identities {
+		subjects = append(subjects, identity)
+	}
+	var res DBStruct
+	err := selectAccounts().
+		Where(dbase.In("s.certificate_subject", subjects...), dbase.Visible("s.type", false, false)).
+		OrderBy("s.name").
+		Limit(1).
+		Get(ctx, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func Insert(ctx context.Context, account *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, account, `
+			INSERT INTO service_accounts
+				(name, type, description, certificate_subject, domain_id, tenant_id)
+			SELECT
+			    :name, CAST (:type AS user_type), :description, :certificate_subject,
+			    (SELECT d.id FROM domains d WHERE d.name = :domain.name),
+			    (SELECT t.id FROM tenants t JOIN domains d ON d.id = t.domain_id WHERE d.name = :domain.name AND t.name = :tenant.name)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, `
+		UPDATE service_accounts SET type = CAST (:delete AS user_type) WHERE name = :service_account
+			RETURNING id`,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
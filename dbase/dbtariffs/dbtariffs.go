@@ -1,15 +1,15 @@
 package dbtariffs
 
 import (
+	"context"
 	"files-back/dbase"
 	"files-back/dbase/dbdomains"
 	"files-back/dbase/dbplans"
 	"files-back/handlers/params"
-	"github.com/jmoiron/sqlx"
-	"log"
 )
 
 type DBStruct struct {
+	ID          int64               `db:"id"`
 	Name        string              `db:"name"`
 	OldName     *string             `db:"old_name"`
 	Domain      *dbdomains.DBStruct `db:"domain"`
@@ -22,7 +22,7 @@ type DBStruct struct {
 	Regularity  *string             `db:"regularity"`
 }
 
-func (dbTariff *DBStruct) toJSON() *JSONStruct {
+func (dbTariff *DBStruct) ToJSON() *JSONStruct {
 	unknown := "unknown"
 	domainResponse := JSONStruct{
 		Name:       &dbTariff.Name,
@@ -55,57 +55,54 @@ type JSONStruct struct {
 	Regularity  *string `json:"regularity"`
 }
 
-func Query(p params.QueryParams) ([]*JSONStruct, error) {
-	var res []*JSONStruct
-	var rows *sqlx.Rows
-	var err error
-	var sqlWhere string
-	if p.Search != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.name LIKE :search OR p.name LIKE :search OR t.description LIKE :search) "
-	}
-	if p.TariffName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.name = :tariff_name"
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Name, ID: row.ID}
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectTariffs(p)
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "t.name", "t.id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
 	}
-	if p.DomainName != nil && p.PlanName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(d.name = :domain_name AND p.name = :plan_name) "
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.ToJSON())
 	}
-	if !p.ShowDeleted && !p.ShowDisabled {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(p.type NOT IN ('disabled', 'deleted')) "
+	return &res, nil
+}
+
+func selectTariffs(p params.QueryParams) *dbase.Query {
+	q := dbase.Select(
+		"t.id as id", "t.name as name", `d.name as "domain.name"`, `p.name as "plan.name"`, "t.type as type", "t.description as description",
+		"t.disk_quota as disk_quota", "t.office as office", "t.price as price", "t.regularity as regularity").
+		From("tariffs t").
+		Join("plans p", "p.id = t.plan_id").
+		Join("domains d", "d.id = p.domain_id")
+	if p.Search != nil {
+		q.Where(dbase.Or(dbase.Like("t.name", *p.Search), dbase.Like("p.name", *p.Search), dbase.Like("t.description", *p.Search)))
 	}
-	if p.ShowDisabled && !p.ShowDeleted {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(p.type NOT IN ('deleted')) "
+	if p.TariffName != nil {
+		q.Where(dbase.Eq("t.name", *p.TariffName))
 	}
-	sqlQuery := `
-		SELECT
-		       t.name as name, d.name as domain_name, p.name as plan_name, t.type as type, t.description as description, t.disk_quota as disk_quota, t.office as office, t.price as price, t.regularity as regularity 
-		FROM tariffs t
-		JOIN plans p ON p.id = t.plan_id
-		JOIN domains d ON d.id = p.domain_id ` + sqlWhere + `
-		LIMIT :limit
-		    OFFSET :offset`
-	rows, err = dbase.DB.NamedQuery(sqlQuery, p)
-	if err != nil {
-		return res, err
+	if p.DomainName != nil {
+		q.Where(dbase.Eq("d.name", *p.DomainName))
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-	for rows.Next() {
-		var resultDomain DBStruct
-		err := rows.StructScan(&resultDomain)
-		if err != nil {
-			return res, err
-		}
-		domainResponse := resultDomain.toJSON()
-		res = append(res, domainResponse)
+	if p.PlanName != nil {
+		q.Where(dbase.Eq("p.name", *p.PlanName))
 	}
-	return res, nil
+	q.Where(dbase.Visible("t.type", p.ShowDisabled, p.ShowDeleted))
+	return q
 }
 
-func Delete(p params.QueryParams) error {
-	err := dbase.ExecWithChekOne(p, `
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, `
 		UPDATE plans SET type = :delete WHERE id IN 
 			(SELECT
 		          t.id
@@ -122,8 +119,8 @@ func Delete(p params.QueryParams) error {
 	return nil
 }
 
-func Insert(plan *DBStruct) error {
-	err := dbase.ExecWithChekOne(plan,
+func Insert(ctx context.Context, plan *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, plan,
 		`INSERT INTO plans
 				(name,  description, disk_quota, office, price, type, regularity, domain_id, plan_id)
 			SELECT
@@ -138,8 +135,8 @@ func Insert(plan *DBStruct) error {
 	return nil
 }
 
-func Update(plan *DBStruct) error {
-	err := dbase.ExecWithChekOne(plan,
+func Update(ctx context.Context, plan *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, plan,
 		`UPDATE plans
 			SET 
 			    name = :name,
@@ -164,3 +161,28 @@ func Update(plan *DBStruct) error {
 	}
 	return nil
 }
+
+type Repository interface {
+	Query(ctx context.Context, p params.QueryParams) (*List, error)
+	Insert(ctx context.Context, tariff *DBStruct) error
+	Update(ctx context.Context, tariff *DBStruct) error
+	Delete(ctx context.Context, p params.QueryParams) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	return Query(ctx, p)
+}
+
+func (SQLRepository) Insert(ctx context.Context, tariff *DBStruct) error {
+	return Insert(ctx, tariff)
+}
+
+func (SQLRepository) Update(ctx context.Context, tariff *DBStruct) error {
+	return Update(ctx, tariff)
+}
+
+func (SQLRepository) Delete(ctx context.Context, p params.QueryParams) error {
+	return Delete(ctx, p)
+}
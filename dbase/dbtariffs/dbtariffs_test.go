@@ -0,0 +1,10 @@
+package dbtariffs
+
+import (
+	"files-back/dbase/dbasetest"
+	"testing"
+)
+
+func TestSelectTariffsSQL(t *testing.T) {
+	dbasetest.Golden(t, dbasetest.Combinations(selectTariffs, "search", "domain", "plan", "tariff", "disabled", "deleted"))
+}
@@ -1,15 +1,15 @@
 package dbtenants
 
 import (
+	"context"
 	"files-back/dbase"
 	"files-back/dbase/dbdomains"
 	"files-back/dbase/dbplans"
 	"files-back/handlers/params"
-	"github.com/jmoiron/sqlx"
-	"log"
 )
 
 type DBStruct struct {
+	ID           int64               `db:"id"`
 	Name         string              `db:"name"`
 	OldName      *string             `db:"old_name"`
 	Organisation *string             `db:"organisation"`
@@ -21,7 +21,7 @@ type DBStruct struct {
 	Plan         *dbplans.DBStruct   `db:"plan"`
 }
 
-func (dbTenant *DBStruct) toJSON() *JSONStruct {
+func (dbTenant *DBStruct) ToJSON() *JSONStruct {
 	unknown := "unknown"
 	domainResponse := JSONStruct{
 		Name:         &dbTenant.Name,
@@ -52,57 +52,54 @@ type JSONStruct struct {
 	Plan         *string `json:"planName,omitempty"`
 }
 
-func Query(p params.QueryParams) ([]*JSONStruct, error) {
-	var res []*JSONStruct
-	var rows *sqlx.Rows
-	var err error
-	var sqlWhere string
-	if p.DomainName != nil && p.PlanName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(p.name = :plan_name AND d.name = :domain_name) "
-	}
-	if p.Search != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.name LIKE :search OR t.organisation LIKE :search) "
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Name, ID: row.ID}
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectTenants(p)
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "t.name", "t.id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
 	}
-	if p.DomainName != nil && p.TenantName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(d.name = :domain_name AND t.name = :tenant_name) "
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.ToJSON())
 	}
-	if !p.ShowDeleted && !p.ShowDisabled {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.type NOT IN ('disabled', 'deleted')) "
+	return &res, nil
+}
+
+func selectTenants(p params.QueryParams) *dbase.Query {
+	q := dbase.Select(
+		"t.id as id", "t.name as name", "t.organisation as organisation", "t.order_form as order_form", "t.order_link as order_link",
+		"t.description as description", "t.type as type", `d.name as "domain.name"`, `COALESCE(p.name, '') as "plan.name"`).
+		From("tenants t").
+		Join("domains d", "d.id = t.domain_id").
+		LeftJoin("plans p", "p.id = t.plan_id")
+	if p.Search != nil {
+		q.Where(dbase.Or(dbase.Like("t.name", *p.Search), dbase.Like("t.organisation", *p.Search)))
 	}
-	if p.ShowDisabled && !p.ShowDeleted {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.type NOT IN ('deleted')) "
+	if p.DomainName != nil {
+		q.Where(dbase.Eq("d.name", *p.DomainName))
 	}
-	sqlQuery := `
-		SELECT
-				t.name as name, t.organisation as organisation, t.order_form as order_form, t.order_link as order_link, t.description as description, t.type as type, d.name as "domain.name", p.name as "plan.name"
-		FROM tenants t
-		JOIN domains d ON d.id = t.domain_id 
-		JOIN plans p ON d.id = p.domain_id ` + sqlWhere + `
-		LIMIT :limit
-		    OFFSET :offset`
-	rows, err = dbase.DB.NamedQuery(sqlQuery, p)
-	if err != nil {
-		return res, err
+	if p.TenantName != nil {
+		q.Where(dbase.Eq("t.name", *p.TenantName))
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-	for rows.Next() {
-		var resultDomain DBStruct
-		err := rows.StructScan(&resultDomain)
-		if err != nil {
-			return res, err
-		}
-		domainResponse := resultDomain.toJSON()
-		res = append(res, domainResponse)
+	if p.PlanName != nil {
+		q.Where(dbase.Eq("p.name", *p.PlanName))
 	}
-	return res, nil
+	q.Where(dbase.Visible("t.type", p.ShowDisabled, p.ShowDeleted))
+	return q
 }
 
-func Delete(p params.QueryParams) error {
-	err := dbase.ExecWithChekOne(p, `
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, `
 		UPDATE tenants SET type = :delete WHERE id IN 
 			(SELECT
 		       t.id
@@ -118,7 +115,7 @@ func Delete(p params.QueryParams) error {
 	return nil
 }
 
-func Insert(tenant *DBStruct) error {
+func Insert(ctx context.Context, tenant *DBStruct) error {
 	sqlQuery := `INSERT INTO tenants
 							(name, organisation, order_form, order_link, description, type, domain_id, plan_id)
 						SELECT
@@ -127,15 +124,15 @@ func Insert(tenant *DBStruct) error {
 						JOIN plans p on d.id = p.domain_id
 						WHERE d.name = :domain.name AND p.name = :plan.name
 						RETURNING id`
-	err := dbase.ExecWithChekOne(tenant, sqlQuery)
+	err := dbase.ExecWithChekOne(ctx, tenant, sqlQuery)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func Update(tenant *DBStruct) error {
-	err := dbase.ExecWithChekOne(tenant,
+func Update(ctx context.Context, tenant *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, tenant,
 		`UPDATE tenants
 			SET 
 			    (name, organisation, order_form, order_link, description, type, domain_id, plan_id) = 
@@ -152,3 +149,28 @@ func Update(tenant *DBStruct) error {
 	}
 	return nil
 }
+
+type Repository interface {
+	Query(ctx context.Context, p params.QueryParams) (*List, error)
+	Insert(ctx context.Context, tenant *DBStruct) error
+	Update(ctx context.Context, tenant *DBStruct) error
+	Delete(ctx context.Context, p params.QueryParams) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	return Query(ctx, p)
+}
+
+func (SQLRepository) Insert(ctx context.Context, tenant *DBStruct) error {
+	return Insert(ctx, tenant)
+}
+
+func (SQLRepository) Update(ctx context.Context, tenant *DBStruct) error {
+	return Update(ctx, tenant)
+}
+
+func (SQLRepository) Delete(ctx context.Context, p params.QueryParams) error {
+	return Delete(ctx, p)
+}
@@ -0,0 +1,10 @@
+package dbtenants
+
+import (
+	"files-back/dbase/dbasetest"
+	"testing"
+)
+
+func TestSelectTenantsSQL(t *testing.T) {
+	dbasetest.Golden(t, dbasetest.Combinations(selectTenants, "search", "domain", "tenant", "plan", "disabled", "deleted"))
+}
@@ -0,0 +1,206 @@
+package dbtokens
+
+import (
+	"context"
+	"files-back/dbase"
+	"log"
+	"time"
+)
+
+type DBStruct struct {
+	TokenHash  string    `db:"token_hash"`
+	FamilyID   string    `db:"family_id"`
+	Username   string    `db:"username"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	Used       bool      `db:"used"`
+	Revoked    bool      `db:"revoked"`
+	Role       *string   `db:"role"`
+	RoleDomain *string   `db:"role_domain"`
+	RoleTenant *string   `db:"role_tenant"`
+}
+
+type RevokedStruct struct {
+	ID        string    `db:"id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func Insert(ctx context.Context, token *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, token, `
+			INSERT INTO refresh_tokens
+				(token_hash, family_id, username, expires_at, role, role_domain, role_tenant)
+			VALUES
+			    (:token_hash, :family_id, :username, :expires_at, :role, :role_domain, :role_tenant)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func QueryByHash(ctx context.Context, tokenHash string) (*DBStruct, error) {
+	var res DBStruct
+	err := dbase.DB.GetContext(ctx, &res, `
+		SELECT
+				token_hash, family_id, username, expires_at, used, revoked, role, role_domain, role_tenant
+		FROM refresh_tokens
+		WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func Use(ctx context.Context, tokenHash string) (*DBStruct, error) {
+	err := dbase.ExecWithChekOne(ctx, DBStruct{TokenHash: tokenHash}, `
+		UPDATE refresh_tokens SET used = true
+		WHERE token_hash = :token_hash AND NOT used AND NOT revoked AND expires_at > now()
+		RETURNING id`)
+	if err != nil {
+		return nil, err
+	}
+	return QueryByHash(ctx, tokenHash)
+}
+
+func RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	_, err := dbase.DB.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = true WHERE family_id = $1`, familyID)
+	if err != nil {
+		return err
+	}
+	return Revoke(ctx, &RevokedStruct{
+		ID:        familyID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func Revoke(ctx context.Context, revoked *RevokedStruct) error {
+	err := dbase.ExecWithChekOne(ctx, revoked, `
+			INSERT INTO revoked_tokens
+				(id, expires_at)
+			VALUES
+			    (:id, :expires_at)
+			ON CONFLICT (id) DO UPDATE SET expires_at = GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func IsRevoked(ctx context.Context, id string) (bool, error) {
+	var revoked bool
+	err := dbase.DB.GetContext(ctx, &revoked, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE id = $1)`, id)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+func RevokeUser(ctx context.Context, username, keepFamily string) ([]DBStruct, error) {
+	var families []DBStruct
+	err := dbase.DB.SelectContext(ctx, &families, `
+		SELECT family_id, MAX(expires_at) as expires_at
+		FROM refresh_tokens
+		WHERE username = $1 AND family_id <> $2 AND NOT revoked
+		GROUP BY family_id`, username, keepFamily)
+	if err != nil {
+		return nil, err
+	}
+	for _, family := range families {
+		if err := RevokeFamily(ctx, family.FamilyID, family.ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+	return families, nil
+}
+
+type Repository interface {
+	Insert(ctx context.Context, token *DBStruct) error
+	QueryByHash(ctx context.Context, tokenHash string) (*DBStruct, error)
+	Use(ctx context.Context, tokenHash string) (*DBStruct, error)
+	RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error
+	Revoke(ctx context.Context, revoked *RevokedStruct) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Insert(ctx context.Context, token *DBStruct) error {
+	return Insert(ctx, token)
+}
+
+func (SQLRepository) QueryByHash(ctx context.Context, tokenHash string) (*DBStruct, error) {
+	return QueryByHash(ctx, tokenHash)
+}
+
+func (SQLRepository) Use(ctx context.Context, tokenHash string) (*DBStruct, error) {
+	return Use(ctx, tokenHash)
+}
+
+func (SQLRepository) RevokeFamily(ctx context.Context, familyID string, expiresAt time.Time) error {
+	return RevokeFamily(ctx, familyID, expiresAt)
+}
+
+func (SQLRepository) Revoke(ctx context.Context, revoked *RevokedStruct) error {
+	return Revoke(ctx, revoked)
+}
+
+type SessionStruct struct {
+	FamilyID   string    `db:"family_id" json:"id"`
+	Username   string    `db:"username" json:"email"`
+	StartedAt  time.Time `db:"started_at" json:"startedAt"`
+	LastUsedAt time.Time `db:"last_used_at" json:"lastUsedAt"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expiresAt"`
+	IP         *string   `db:"ip" json:"ip,omitempty"`
+	UserAgent  *string   `db:"user_agent" json:"userAgent,omitempty"`
+	Method     *string   `db:"method" json:"method,omitempty"`
+	Current    bool      `db:"-" json:"current,omitempty"`
+}
+
+type SessionFilter struct {
+	FamilyID *string `db:"family_id"`
+	Email    *string `db:"email"`
+	Domain   *string `db:"domain_name"`
+	Tenant   *string `db:"tenant_name"`
+	Limit    *int    `db:"limit"`
+	Offset   *int    `db:"offset"`
+}
+
+func QuerySessions(ctx context.Context, f SessionFilter) ([]*SessionStruct, error) {
+	res := []*SessionStruct{}
+	rows, err := dbase.DB.NamedQueryContext(ctx, `
+		SELECT
+				s.family_id, s.username, s.started_at, s.last_used_at, s.expires_at, a.ip, a.user_agent, a.method
+		FROM (
+			SELECT family_id, username, MIN(created_at) as started_at, MAX(created_at) as last_used_at, MAX(expires_at) as expires_at
+			FROM refresh_tokens
+			WHERE NOT revoked
+			GROUP BY family_id, username
+			HAVING MAX(expires_at) > now()
+		) s
+		LEFT JOIN login_attempts a ON a.family_id = s.family_id
+		LEFT JOIN users u ON u.email = s.username
+		LEFT JOIN tenants t ON t.id = u.tenant_id
+		LEFT JOIN domains d ON d.id = t.domain_id
+		WHERE (CAST (:family_id AS text) IS NULL OR s.family_id = :family_id)
+			AND (CAST (:email AS text) IS NULL OR s.username = :email)
+			AND (CAST (:domain_name AS text) IS NULL OR d.name = :domain_name)
+			AND (CAST (:tenant_name AS text) IS NULL OR t.name = :tenant_name)
+		ORDER BY s.last_used_at DESC
+		LIMIT :limit
+		    OFFSET :offset`, f)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	for rows.Next() {
+		var session SessionStruct
+		if err := rows.StructScan(&session); err != nil {
+			return nil, err
+		}
+		res = append(res, &session)
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package dbtotp
+
+import (
+	"context"
+	"files-back/dbase"
+)
+
+type DBStruct struct {
+	Email       string `db:"email"`
+	Secret      string `db:"secret"`
+	Confirmed   bool   `db:"confirmed"`
+	LastCounter int64  `db:"last_counter"`
+}
+
+type RecoveryStruct struct {
+	Email    string `db:"email"`
+	CodeHash string `db:"code_hash"`
+}
+
+func QueryByEmail(ctx context.Context, email string) (*DBStruct, error) {
+	var res DBStruct
+	err := dbase.DB.GetContext(ctx, &res, `
+		SELECT
+				email, secret, confirmed, last_counter
+		FROM user_totp
+		WHERE email = $1`, email)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func Enroll(ctx context.Context, totp *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, totp, `
+			INSERT INTO user_totp
+				(email, secret)
+			VALUES
+			    (:email, :secret)
+			ON CONFLICT (email) DO UPDATE SET secret = EXCLUDED.secret, confirmed = false, last_counter = 0
+				WHERE NOT user_totp.confirmed
+			RETURNING email`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func Use(ctx context.Context, totp *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, totp, `
+		UPDATE user_totp SET last_counter = :last_counter, confirmed = true
+		WHERE email = :email AND last_counter < :last_counter
+			RETURNING email`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func Delete(ctx context.Context, email string) error {
+	err := dbase.ExecWithChekOne(ctx, DBStruct{Email: email}, `
+		DELETE FROM user_totp WHERE email = :email
+			RETURNING email`)
+	if err != nil {
+		return err
+	}
+	_, err = dbase.DB.ExecContext(ctx, `DELETE FROM recovery_codes WHERE email = $1`, email)
+	return err
+}
+
+func ReplaceRecoveryCodes(ctx context.Context, email string, codeHashes []string) error {
+	tx, err := dbase.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE email = $1`, email)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		_, err = tx.NamedExecContext(ctx, `INSERT INTO recovery_codes (email, code_hash) VALUES (:email, :code_hash)`,
+			RecoveryStruct{Email: email, CodeHash: codeHash})
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func UseRecoveryCode(ctx context.Context, recovery *RecoveryStruct) error {
+	err := dbase.ExecWithChekOne(ctx, recovery, `
+		UPDATE recovery_codes SET used_at = now()
+		WHERE email = :email AND code_hash = :code_hash AND used_at IS NULL
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type Repository interface {
+	QueryByEmail(ctx context.Context, email string) (*DBStruct, error)
+	Enroll(ctx context.Context, totp *DBStruct) error
+	Use(ctx context.Context, totp *DBStruct) error
+	Delete(ctx context.Context, email string) error
+	ReplaceRecoveryCodes(ctx context.Context, email string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, recovery *RecoveryStruct) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) QueryByEmail(ctx context.Context, email string) (*DBStruct, error) {
+	return QueryByEmail(ctx, email)
+}
+
+func (SQLRepository) Enroll(ctx context.Context, totp *DBStruct) error {
+	return Enroll(ctx, totp)
+}
+
+func (SQLRepository) Use(ctx context.Context, totp *DBStruct) error {
+	return Use(ctx, totp)
+}
+
+func (SQLRepository) Delete(ctx context.Context, email string) error {
+	return Delete(ctx, email)
+}
+
+func (SQLRepository) ReplaceRecoveryCodes(ctx context.Context, email string, codeHashes []string) error {
+	return ReplaceRecoveryCodes(ctx, email, codeHashes)
+}
+
+func (SQLRepository) UseRecoveryCode(ctx context.Context, recovery *RecoveryStruct) error {
+	return UseRecoveryCode(ctx, recovery)
+}
@@ -1,16 +1,16 @@
 package dbusers
 
 import (
+	"context"
 	"files-back/dbase"
 	"files-back/dbase/dbdomains"
 	"files-back/dbase/dbtariffs"
 	"files-back/dbase/dbtenants"
 	"files-back/handlers/params"
-	"github.com/jmoiron/sqlx"
-	"log"
 )
 
 type DBStruct struct {
+	ID          int64               `db:"id"`
 	Email       string              `db:"email"`
 	OldEmail    *string             `db:"old_email"`
 	DisplayName *string             `db:"display_name"`
@@ -21,7 +21,7 @@ type DBStruct struct {
 	Domain      *dbdomains.DBStruct `db:"domain"`
 }
 
-func (dbUsers *DBStruct) toJSON() *JSONStruct {
+func (dbUsers *DBStruct) ToJSON() *JSONStruct {
 	return &JSONStruct{
 		Email:       &dbUsers.Email,
 		DisplayName: dbUsers.DisplayName,
@@ -41,60 +41,63 @@ type JSONStruct struct {
 	Domain      *string `json:"domain"`
 }
 
-func Query(p params.QueryParams) ([]*JSONStruct, error) {
-	var res []*JSONStruct
-	var rows *sqlx.Rows
-	var err error
-	var sqlWhere string
-	if p.Search != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(u.email LIKE :search OR u.display_name LIKE :search) "
+type List struct {
+	Items []*JSONStruct `json:"items"`
+	dbase.Page
+}
+
+func (row *DBStruct) Cursor() dbase.Cursor {
+	return dbase.Cursor{Key: row.Email, ID: row.ID}
+}
+
+func Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	q := selectUsers(p)
+	var rows []*DBStruct
+	page, err := q.Paginate(ctx, &rows, "u.email", "u.id", dbase.Keyset{After: p.After, Before: p.Before, Limit: p.Limit})
+	if err != nil {
+		return nil, err
 	}
-	if p.TenantName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(t.name = :tenant_name AND d.name = :domain_name) "
+	res := List{Items: []*JSONStruct{}, Page: *page}
+	for _, row := range rows {
+		res.Items = append(res.Items, row.ToJSON())
 	}
-	if p.GroupName != nil {
-		sqlWhere = dbase.AppendWhere(sqlWhere) + "(u.name = :group_name) "
+	return &res, nil
+}
+
+func selectUsers(p params.QueryParams) *dbase.Query {
+	q := dbase.Select(
+		"u.id as id", "u.email as email", "u.display_name as display_name", "u.type as type", "u.free as free",
+		`COALESCE(tf.name, '') as "tariff.name"`, `t.name as "tenant.name"`, `d.name as "domain.name"`).
+		From("users u").
+		LeftJoin("tariffs tf", "tf.id = u.tariff_id").
+		Join("tenants t", "t.id = u.tenant_id").
+		Join("domains d", "d.id = t.domain_id")
+	if p.Search != nil {
+		q.Where(dbase.Or(dbase.Like("u.email", *p.Search), dbase.Like("u.display_name", *p.Search)))
 	}
-	sqlQuery := `
-		SELECT
-				u.email as email, u.display_name as display_name, u.type as type, u.free as free, tf.name as "tariff.name", t.name as "tenant.name", d.name as "domain.name"
-		FROM users u
-		JOIN tariff tf ON tf.id = u.tariff_id
-		JOIN tenants t ON t.id = u.tenant_id
-		JOIN domains d ON d.id = t.domain_id ` + sqlWhere + `
-		LIMIT :limit
-		    OFFSET :offset`
-	rows, err = dbase.DB.NamedQuery(sqlQuery, p)
-	if err != nil {
-		return res, err
+	if p.DomainName != nil {
+		q.Where(dbase.Eq("d.name", *p.DomainName))
+	}
+	if p.TenantName != nil {
+		q.Where(dbase.Eq("t.name", *p.TenantName))
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-	for rows.Next() {
-		var resultDomain DBStruct
-		err := rows.StructScan(&resultDomain)
-		if err != nil {
-			return res, err
-		}
-		domainResponse := resultDomain.toJSON()
-		res = append(res, domainResponse)
+	if p.Email != nil {
+		q.Where(dbase.Eq("u.email", *p.Email))
 	}
-	return res, nil
+	q.Where(dbase.Visible("u.type", p.ShowDisabled, p.ShowDeleted))
+	return q
 }
 
-func Delete(p params.QueryParams) error {
-	err := dbase.ExecWithChekOne(p, `
-		UPDATE users SET type = :delete WHERE id IN 
+func Delete(ctx context.Context, p params.QueryParams) error {
+	err := dbase.ExecWithChekOne(ctx, p, `
+		UPDATE users SET type = CAST (:delete AS user_type) WHERE id IN 
 			(SELECT
 		       u.id
 		    FROM users u
 		    JOIN tenants t ON t.id = u.tenant_id
 			JOIN domains d ON d.id = t.domain_id
 			WHERE
-				t.name=:tenant_name AND u.name=:email AND d.name=:domain_name)
+				t.name=:tenant_name AND u.email=:email AND d.name=:domain_name)
 			RETURNING id`,
 	)
 	if err != nil {
@@ -103,15 +106,15 @@ func Delete(p params.QueryParams) error {
 	return nil
 }
 
-func Insert(group *DBStruct) error {
-	err := dbase.ExecWithChekOne(group, `INSERT INTO groups
+func Insert(ctx context.Context, user *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, user, `INSERT INTO users
 							(email, display_name, type, tariff_id, tenant_id)
 						SELECT
-							:email, :display_name, , CAST (:type AS group_type), tf.id, t.id
+							:email, :display_name, CAST (:type AS user_type), tf.id, t.id
 						FROM tariffs tf
 						JOIN domains d ON d.id = tf.domain_id
-						JOIN tenants t ON t.domain_id = d.id 
-						WHERE d.name = :domain.name AND t.name = :tenant.name AND :tariff.name
+						JOIN tenants t ON t.domain_id = d.id
+						WHERE d.name = :domain.name AND t.name = :tenant.name AND tf.name = :tariff.name
 						RETURNING id`)
 	if err != nil {
 		return err
@@ -119,28 +122,116 @@ func Insert(group *DBStruct) error {
 	return nil
 }
 
-func Update(group *DBStruct) error {
-	err := dbase.ExecWithChekOne(group,
-		`UPDATE users SET
-					SET 
-			    		(email, display_name, type, tariff_id, tenant_id)
-						(SELECT
-							:email, :display_name, , CAST (:type AS group_type), tf.id, t.id
-						FROM tariffs tf
-						JOIN domains d ON d.id = tf.domain_id
-						JOIN tenants t ON t.domain_id = d.id 
-						WHERE d.name = :domain.name AND t.name = :tenant.name AND :tariff.name)
-					WHERE id IN 
-						(SELECT
-		       				u.id
-						FROM users u
-						JOIN tenants t ON t.id = u.tenant_id
-						JOIN domains d ON d.id = t.domain_id
-						WHERE
-							t.name=:tenant_name AND u.name=:old_email AND d.name=:domain_name)
-						RETURNING id`)
+func Update(ctx context.Context, user *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, user,
+		`UPDATE users u
+			SET
+			    email = :email,
+				display_name = :display_name,
+				type = CAST (:type AS user_type),
+				tariff_id = tf.id
+			FROM tariffs tf
+			JOIN domains d ON d.id = tf.domain_id
+			JOIN tenants t ON t.domain_id = d.id
+			WHERE
+				u.tenant_id = t.id AND u.email = :old_email AND
+				d.name = :domain.name AND t.name = :tenant.name AND tf.name = :tariff.name
+			RETURNING u.id`)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func Purge(ctx context.Context, email string) error {
+	err := dbase.ExecWithChekOne(ctx, DBStruct{Email: email}, `
+		DELETE FROM users WHERE email = :email
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func QueryByEmail(ctx context.Context, email string) (*DBStruct, error) {
+	var res DBStruct
+	err := dbase.DB.GetContext(ctx, &res, `
+		SELECT
+				u.email as email, u.display_name as display_name, u.type as type, COALESCE(tf.name, '') as "tariff.name", t.name as "tenant.name", d.name as "domain.name"
+		FROM users u
+		LEFT JOIN tariffs tf ON tf.id = u.tariff_id
+		JOIN tenants t ON t.id = u.tenant_id
+		JOIN domains d ON d.id = t.domain_id
+		WHERE u.email = $1`, email)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func QueryByDomain(ctx context.Context, domainName string) ([]*DBStruct, error) {
+	var res []*DBStruct
+	err := dbase.DB.SelectContext(ctx, &res, `
+		SELECT
+				u.email as email, u.display_name as display_name, u.type as type, t.name as "tenant.name", d.name as "domain.name"
+		FROM users u
+		JOIN tenants t ON t.id = u.tenant_id
+		JOIN domains d ON d.id = t.domain_id
+		WHERE d.name = $1`, domainName)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func SetDisplayName(ctx context.Context, user *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, user, `
+		UPDATE users SET display_name = :display_name
+		WHERE email = :email
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func SetType(ctx context.Context, user *DBStruct) error {
+	err := dbase.ExecWithChekOne(ctx, user, `
+		UPDATE users SET type = CAST (:type AS user_type)
+		WHERE email = :email
+			RETURNING id`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type Repository interface {
+	Query(ctx context.Context, p params.QueryParams) (*List, error)
+	Insert(ctx context.Context, user *DBStruct) error
+	Update(ctx context.Context, user *DBStruct) error
+	Delete(ctx context.Context, p params.QueryParams) error
+	Purge(ctx context.Context, email string) error
+}
+
+type SQLRepository struct{}
+
+func (SQLRepository) Query(ctx context.Context, p params.QueryParams) (*List, error) {
+	return Query(ctx, p)
+}
+
+func (SQLRepository) Insert(ctx context.Context, user *DBStruct) error {
+	return Insert(ctx, user)
+}
+
+func (SQLRepository) Update(ctx context.Context, user *DBStruct) error {
+	return Update(ctx, user)
+}
+
+func (SQLRepository) Delete(ctx context.Context, p params.QueryParams) error {
+	return Delete(ctx, p)
+}
+
+func (SQLRepository) Purge(ctx context.Context, email string) error {
+	return Purge(ctx, email)
+}
@@ -0,0 +1,10 @@
+package dbusers
+
+import (
+	"files-back/dbase/dbasetest"
+	"testing"
+)
+
+func TestSelectUsersSQL(t *testing.T) {
+	dbasetest.Golden(t, dbasetest.Combinations(selectUsers, "search", "domain", "tenant", "email", "disabled", "deleted"))
+}
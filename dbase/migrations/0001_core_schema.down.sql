@@ -0,0 +1,12 @@
+DROP TABLE groups;
+DROP TABLE users;
+DROP TABLE tenants;
+DROP TABLE tariffs;
+DROP TABLE plans;
+DROP TABLE domains;
+
+DROP TYPE user_type;
+DROP TYPE group_type;
+DROP TYPE tenant_type;
+DROP TYPE plan_type;
+DROP TYPE domain_type;
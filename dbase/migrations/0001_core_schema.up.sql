@@ -0,0 +1,75 @@
+CREATE TYPE domain_type AS ENUM ('primary', 'wholesale', 'premium', 'disabled', 'deleted');
+CREATE TYPE plan_type AS ENUM ('personal', 'group', 'options', 'disabled', 'deleted');
+CREATE TYPE tenant_type AS ENUM ('primary', 'regular', 'premium', 'disabled', 'deleted');
+CREATE TYPE group_type AS ENUM ('regular', 'office', 'access', 'disabled', 'deleted');
+CREATE TYPE user_type AS ENUM ('full_Admin', 'domain_admin', 'tenant_admin', 'regular', 'disabled', 'deleted');
+
+CREATE TABLE domains (
+    id           serial PRIMARY KEY,
+    name         text        NOT NULL UNIQUE,
+    organisation text,
+    primary_url  text,
+    admin_url    text,
+    data_path    text,
+    password     text,
+    user_name    text,
+    version      text,
+    type         domain_type NOT NULL DEFAULT 'primary',
+    description  text
+);
+
+CREATE TABLE plans (
+    id          serial PRIMARY KEY,
+    name        text      NOT NULL,
+    domain_id   integer   NOT NULL REFERENCES domains (id),
+    from_date   timestamptz,
+    due_date    timestamptz,
+    type        plan_type NOT NULL DEFAULT 'personal',
+    description text,
+    UNIQUE (domain_id, name)
+);
+
+CREATE TABLE tariffs (
+    id          serial PRIMARY KEY,
+    name        text      NOT NULL,
+    domain_id   integer   NOT NULL REFERENCES domains (id),
+    plan_id     integer   NOT NULL REFERENCES plans (id),
+    type        plan_type NOT NULL DEFAULT 'personal',
+    description text,
+    disk_quota  integer,
+    office      boolean   NOT NULL DEFAULT false,
+    price       integer,
+    regularity  text CHECK (regularity IN ('daily', 'monthly')),
+    UNIQUE (plan_id, name)
+);
+
+CREATE TABLE tenants (
+    id           serial PRIMARY KEY,
+    name         text        NOT NULL,
+    domain_id    integer     NOT NULL REFERENCES domains (id),
+    plan_id      integer REFERENCES plans (id),
+    organisation text,
+    order_form   text,
+    order_link   text,
+    type         tenant_type NOT NULL DEFAULT 'regular',
+    description  text,
+    UNIQUE (domain_id, name)
+);
+
+CREATE TABLE users (
+    id           serial PRIMARY KEY,
+    email        text      NOT NULL UNIQUE,
+    display_name text,
+    type         user_type NOT NULL DEFAULT 'regular',
+    free         integer,
+    tariff_id    integer REFERENCES tariffs (id),
+    tenant_id    integer   NOT NULL REFERENCES tenants (id)
+);
+
+CREATE TABLE groups (
+    id        serial PRIMARY KEY,
+    name      text       NOT NULL,
+    type      group_type NOT NULL DEFAULT 'regular',
+    tenant_id integer    NOT NULL REFERENCES tenants (id),
+    UNIQUE (tenant_id, name)
+);
@@ -0,0 +1,21 @@
+CREATE TABLE refresh_tokens (
+    id          bigserial PRIMARY KEY,
+    token_hash  text        NOT NULL UNIQUE,
+    family_id   text        NOT NULL,
+    username    text        NOT NULL,
+    role        text,
+    role_domain text,
+    role_tenant text,
+    used        boolean     NOT NULL DEFAULT false,
+    revoked     boolean     NOT NULL DEFAULT false,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    expires_at  timestamptz NOT NULL
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_username_idx ON refresh_tokens (username);
+
+CREATE TABLE revoked_tokens (
+    id         text PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
@@ -0,0 +1,7 @@
+ALTER TABLE domains
+    DROP COLUMN ldap_server,
+    DROP COLUMN ldap_base_dn,
+    DROP COLUMN ldap_bind_username,
+    DROP COLUMN ldap_bind_password,
+    DROP COLUMN ldap_user_filter,
+    DROP COLUMN ldap_mail_domain;
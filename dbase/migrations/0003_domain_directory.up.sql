@@ -0,0 +1,9 @@
+ALTER TABLE domains
+    ADD COLUMN ldap_server        text,
+    ADD COLUMN ldap_base_dn       text,
+    ADD COLUMN ldap_bind_username text,
+    ADD COLUMN ldap_bind_password text,
+    ADD COLUMN ldap_user_filter   text,
+    ADD COLUMN ldap_mail_domain   text;
+
+CREATE INDEX domains_ldap_mail_domain_idx ON domains (ldap_mail_domain);
@@ -0,0 +1,22 @@
+CREATE TABLE service_accounts (
+    id                  serial PRIMARY KEY,
+    name                text      NOT NULL UNIQUE,
+    type                user_type NOT NULL DEFAULT 'regular',
+    description         text,
+    certificate_subject text UNIQUE,
+    domain_id           integer REFERENCES domains (id),
+    tenant_id           integer REFERENCES tenants (id)
+);
+
+CREATE TABLE api_tokens (
+    id                 bigserial PRIMARY KEY,
+    name               text        NOT NULL,
+    token_hash         text        NOT NULL UNIQUE,
+    owner_email        text,
+    service_account_id integer REFERENCES service_accounts (id),
+    scopes             text        NOT NULL DEFAULT '',
+    created_at         timestamptz NOT NULL DEFAULT now(),
+    expires_at         timestamptz,
+    last_used_at       timestamptz,
+    revoked_at         timestamptz
+);
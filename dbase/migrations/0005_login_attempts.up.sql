@@ -0,0 +1,14 @@
+CREATE TABLE login_attempts (
+    id         bigserial PRIMARY KEY,
+    username   text        NOT NULL,
+    ip         text        NOT NULL,
+    user_agent text,
+    method     text,
+    family_id  text,
+    success    boolean     NOT NULL,
+    reason     text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_attempts_username_idx ON login_attempts (username, created_at);
+CREATE INDEX login_attempts_family_id_idx ON login_attempts (family_id);
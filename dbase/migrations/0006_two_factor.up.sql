@@ -0,0 +1,15 @@
+CREATE TABLE user_totp (
+    email        text PRIMARY KEY,
+    secret       text        NOT NULL,
+    confirmed    boolean     NOT NULL DEFAULT false,
+    last_counter bigint      NOT NULL DEFAULT 0,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE recovery_codes (
+    id        bigserial PRIMARY KEY,
+    email     text NOT NULL,
+    code_hash text NOT NULL,
+    used_at   timestamptz,
+    UNIQUE (email, code_hash)
+);
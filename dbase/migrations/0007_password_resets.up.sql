@@ -0,0 +1,10 @@
+CREATE TABLE password_resets (
+    id         bigserial PRIMARY KEY,
+    token_hash text        NOT NULL UNIQUE,
+    email      text        NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+
+CREATE INDEX password_resets_email_idx ON password_resets (email);
@@ -0,0 +1,5 @@
+ALTER TABLE domains
+    DROP COLUMN saml_entity_id,
+    DROP COLUMN saml_sso_url,
+    DROP COLUMN saml_certificate,
+    DROP COLUMN saml_email_attribute;
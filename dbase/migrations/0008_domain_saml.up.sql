@@ -0,0 +1,5 @@
+ALTER TABLE domains
+    ADD COLUMN saml_entity_id       text,
+    ADD COLUMN saml_sso_url         text,
+    ADD COLUMN saml_certificate     text,
+    ADD COLUMN saml_email_attribute text;
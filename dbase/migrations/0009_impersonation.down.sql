@@ -0,0 +1,2 @@
+DROP TABLE impersonation_requests;
+DROP TABLE impersonation_sessions;
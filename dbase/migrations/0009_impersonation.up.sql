@@ -0,0 +1,22 @@
+CREATE TABLE impersonation_sessions (
+    id           text PRIMARY KEY,
+    impersonator text        NOT NULL,
+    subject      text        NOT NULL,
+    domain_name  text        NOT NULL,
+    tenant_name  text        NOT NULL,
+    reason       text        NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL,
+    ended_at     timestamptz
+);
+
+CREATE TABLE impersonation_requests (
+    id         bigserial PRIMARY KEY,
+    session_id text        NOT NULL REFERENCES impersonation_sessions (id),
+    method     text        NOT NULL,
+    path       text        NOT NULL,
+    status     integer,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX impersonation_requests_session_id_idx ON impersonation_requests (session_id);
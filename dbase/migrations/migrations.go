@@ -0,0 +1,205 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lockID = 720391
+
+//go:embed *.sql
+var files embed.FS
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64      `db:"version" json:"version"`
+	Name      string     `db:"name" json:"name"`
+	AppliedAt *time.Time `db:"applied_at" json:"appliedAt,omitempty"`
+}
+
+func Load() ([]Migration, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, file := range names {
+		version, name, direction, err := parseName(file)
+		if err != nil {
+			return nil, err
+		}
+		body, err := files.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+	res := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", migration.Version, migration.Name)
+		}
+		res = append(res, *migration)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+	return res, nil
+}
+
+func parseName(file string) (int64, string, string, error) {
+	parts := strings.Split(strings.TrimSuffix(file, ".sql"), ".")
+	if len(parts) != 2 || (parts[1] != "up" && parts[1] != "down") {
+		return 0, "", "", fmt.Errorf("bad migration file name %q", file)
+	}
+	split := strings.SplitN(parts[0], "_", 2)
+	if len(split) != 2 {
+		return 0, "", "", fmt.Errorf("bad migration file name %q", file)
+	}
+	version, err := strconv.ParseInt(split[0], 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("bad migration version in %q: %v", file, err)
+	}
+	return version, split[1], parts[1], nil
+}
+
+func Up(ctx context.Context, db *sqlx.DB) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range migrations {
+		done, err := apply(ctx, db, migration, true)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+func Down(ctx context.Context, db *sqlx.DB, steps int) ([]Migration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	var reverted []Migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		done, err := apply(ctx, db, migrations[i], false)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d_%s: %w", migrations[i].Version, migrations[i].Name, err)
+		}
+		if done {
+			reverted = append(reverted, migrations[i])
+		}
+	}
+	return reverted, nil
+}
+
+func StatusOf(ctx context.Context, db *sqlx.DB) ([]Status, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureTable(ctx, db); err != nil {
+		return nil, err
+	}
+	var applied []Status
+	if err := db.SelectContext(ctx, &applied, `SELECT version, name, applied_at FROM schema_migrations`); err != nil {
+		return nil, err
+	}
+	appliedAt := map[int64]*time.Time{}
+	for _, status := range applied {
+		appliedAt[status.Version] = status.AppliedAt
+	}
+	res := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		res = append(res, Status{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: appliedAt[migration.Version],
+		})
+	}
+	return res, nil
+}
+
+func ensureTable(ctx context.Context, db *sqlx.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    bigint PRIMARY KEY,
+			name       text        NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+func apply(ctx context.Context, db *sqlx.DB, migration Migration, up bool) (bool, error) {
+	if err := ensureTable(ctx, db); err != nil {
+		return false, err
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	var applied bool
+	err = tx.GetContext(ctx, &applied, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if applied == up {
+		_ = tx.Rollback()
+		return false, nil
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, migration.Up)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, migration.Down)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		}
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
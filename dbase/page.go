@@ -0,0 +1,196 @@
+package dbase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+)
+
+var ErrBadCursor = errors.New("bad cursor")
+
+var (
+	DefaultLimit = 10
+	MaxLimit     = 100
+)
+
+type Cursor struct {
+	Key string `json:"k"`
+	ID  int64  `json:"i"`
+}
+
+type Keyed interface {
+	Cursor() Cursor
+}
+
+type Page struct {
+	Total int     `json:"total"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+}
+
+type Keyset struct {
+	After  *string
+	Before *string
+	Limit  *int
+}
+
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrBadCursor
+	}
+	return &c, nil
+}
+
+func (k Keyset) cursors() (after, before *Cursor, err error) {
+	if k.After != nil && k.Before != nil {
+		return nil, nil, ErrBadCursor
+	}
+	if k.After != nil {
+		after, err = ParseCursor(*k.After)
+	}
+	if k.Before != nil {
+		before, err = ParseCursor(*k.Before)
+	}
+	return after, before, err
+}
+
+func (k Keyset) limit() int {
+	switch {
+	case k.Limit == nil:
+		return DefaultLimit
+	case *k.Limit < 1:
+		return 1
+	case *k.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return *k.Limit
+}
+
+func (q *Query) count() *Query {
+	return &Query{
+		columns: []string{"COUNT(*)"},
+		from:    q.from,
+		joins:   q.joins,
+		where:   q.where,
+		args:    q.args,
+	}
+}
+
+func (q *Query) Count(ctx context.Context) (int, error) {
+	var total int
+	err := q.count().Get(ctx, &total)
+	return total, err
+}
+
+func (q *Query) keyset(key, id string, after, before *Cursor, limit int) *Query {
+	switch {
+	case after != nil:
+		q.Where(keyAfter(key, id, ">", *after)).OrderBy(key, id)
+	case before != nil:
+		q.Where(keyAfter(key, id, "<", *before)).OrderBy(key+" DESC", id+" DESC")
+	default:
+		q.OrderBy(key, id)
+	}
+	return q.Limit(limit + 1)
+}
+
+func (q *Query) Paginate(ctx context.Context, dest interface{}, key, id string, k Keyset) (*Page, error) {
+	after, before, err := k.cursors()
+	if err != nil {
+		return nil, err
+	}
+	total, err := q.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit := k.limit()
+	query, args, err := sqlx.Named(q.keyset(key, id, after, before, limit).SQL(), q.args)
+	if err != nil {
+		return nil, err
+	}
+	if err := DB.SelectContext(ctx, dest, DB.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	more := rows.Len() > limit
+	if more {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if before != nil {
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	page := Page{Total: total}
+	if n := rows.Len(); n > 0 {
+		first := rows.Index(0).Interface().(Keyed).Cursor()
+		last := rows.Index(n - 1).Interface().(Keyed).Cursor()
+		page.link(first, last, after != nil, before != nil, more)
+	}
+	return &page, nil
+}
+
+func Window(n int, cursorAt func(i int) Cursor, k Keyset) (int, int, *Page, error) {
+	after, before, err := k.cursors()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	page := Page{Total: n}
+	start, end := 0, n
+	if after != nil {
+		for start < n && !after.Less(cursorAt(start)) {
+			start++
+		}
+	}
+	if before != nil {
+		for end > start && !cursorAt(end-1).Less(*before) {
+			end--
+		}
+	}
+	limit := k.limit()
+	more := end-start > limit
+	if more && before != nil {
+		start = end - limit
+	} else if more {
+		end = start + limit
+	}
+	if end > start {
+		page.link(cursorAt(start), cursorAt(end-1), after != nil, before != nil, more)
+	}
+	return start, end, &page, nil
+}
+
+func (c Cursor) Less(other Cursor) bool {
+	return c.Key < other.Key || (c.Key == other.Key && c.ID < other.ID)
+}
+
+func (p *Page) link(first, last Cursor, forward, backward, more bool) {
+	if more || backward {
+		next := last.String()
+		p.Next = &next
+	}
+	if forward || (backward && more) {
+		prev := first.String()
+		p.Prev = &prev
+	}
+}
+
+func keyAfter(key, id, operator string, c Cursor) Condition {
+	return func(q *Query) string {
+		return "(" + key + ", " + id + ") " + operator + " (" + q.bind(c.Key) + ", " + q.bind(c.ID) + ")"
+	}
+}
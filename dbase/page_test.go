@@ -0,0 +1,136 @@
+package dbase
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func pageQuery() *Query {
+	return Select("u.id", "u.email").From("users u").Where(Eq("u.type", "regular"))
+}
+
+func TestKeysetSQL(t *testing.T) {
+	after, before := &Cursor{Key: "b@d1.com", ID: 2}, &Cursor{Key: "y@d1.com", ID: 9}
+	tests := []struct {
+		name          string
+		after, before *Cursor
+		sql           string
+		args          map[string]interface{}
+	}{
+		{
+			name: "first page",
+			sql:  "SELECT u.id, u.email FROM users u WHERE u.type = :arg1 ORDER BY u.email, u.id LIMIT :arg2",
+			args: map[string]interface{}{"arg1": "regular", "arg2": 11},
+		},
+		{
+			name:  "after",
+			after: after,
+			sql:   "SELECT u.id, u.email FROM users u WHERE u.type = :arg1 AND (u.email, u.id) > (:arg2, :arg3) ORDER BY u.email, u.id LIMIT :arg4",
+			args:  map[string]interface{}{"arg1": "regular", "arg2": "b@d1.com", "arg3": int64(2), "arg4": 11},
+		},
+		{
+			name:   "before",
+			before: before,
+			sql:    "SELECT u.id, u.email FROM users u WHERE u.type = :arg1 AND (u.email, u.id) < (:arg2, :arg3) ORDER BY u.email DESC, u.id DESC LIMIT :arg4",
+			args:   map[string]interface{}{"arg1": "regular", "arg2": "y@d1.com", "arg3": int64(9), "arg4": 11},
+		},
+	}
+	for _, test := range tests {
+		q := pageQuery().keyset("u.email", "u.id", test.after, test.before, 10)
+		if sql := q.SQL(); sql != test.sql {
+			t.Errorf("%s:\n got: %s\nwant: %s", test.name, sql, test.sql)
+		}
+		if !reflect.DeepEqual(q.Args(), test.args) {
+			t.Errorf("%s: args = %v, want %v", test.name, q.Args(), test.args)
+		}
+	}
+}
+
+func TestCountSQL(t *testing.T) {
+	q := pageQuery().Join("tenants t", "t.id = u.tenant_id").OrderBy("u.email")
+	want := "SELECT COUNT(*) FROM users u JOIN tenants t ON t.id = u.tenant_id WHERE u.type = :arg1"
+	if sql := q.count().SQL(); sql != want {
+		t.Errorf("count:\n got: %s\nwant: %s", sql, want)
+	}
+}
+
+func TestKeysetCursors(t *testing.T) {
+	cursor := Cursor{Key: "a@d1.com", ID: 7}.String()
+	parsed, err := ParseCursor(cursor)
+	if err != nil || *parsed != (Cursor{Key: "a@d1.com", ID: 7}) {
+		t.Errorf("round trip = %+v, %v", parsed, err)
+	}
+	bad := "not a cursor"
+	tests := []Keyset{
+		{After: &bad},
+		{Before: &bad},
+		{After: &cursor, Before: &cursor},
+	}
+	for _, k := range tests {
+		if _, _, err := k.cursors(); !errors.Is(err, ErrBadCursor) {
+			t.Errorf("cursors(%+v): err = %v, want ErrBadCursor", k, err)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+	cursorAt := func(i int) Cursor {
+		return Cursor{Key: keys[i], ID: int64(i)}
+	}
+	limit := 2
+	after, before := cursorAt(1).String(), cursorAt(4).String()
+	tests := []struct {
+		name       string
+		k          Keyset
+		start, end int
+		next, prev bool
+	}{
+		{"first page", Keyset{Limit: &limit}, 0, 2, true, false},
+		{"after", Keyset{After: &after, Limit: &limit}, 2, 4, true, true},
+		{"before", Keyset{Before: &before, Limit: &limit}, 2, 4, true, true},
+	}
+	for _, test := range tests {
+		start, end, page, err := Window(len(keys), cursorAt, test.k)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if start != test.start || end != test.end || (page.Next != nil) != test.next || (page.Prev != nil) != test.prev {
+			t.Errorf("%s: window = [%d, %d) next=%v prev=%v", test.name, start, end, page.Next != nil, page.Prev != nil)
+		}
+	}
+}
+
+func TestKeysetLimit(t *testing.T) {
+	zero, negative, huge, five := 0, -5, MaxLimit*10, 5
+	tests := []struct {
+		limit *int
+		want  int
+	}{
+		{nil, DefaultLimit},
+		{&zero, 1},
+		{&negative, 1},
+		{&five, 5},
+		{&huge, MaxLimit},
+	}
+	for _, test := range tests {
+		if got := (Keyset{Limit: test.limit}).limit(); got != test.want {
+			t.Errorf("limit(%v) = %d, want %d", test.limit, got, test.want)
+		}
+		q := pageQuery().keyset("u.email", "u.id", nil, nil, Keyset{Limit: test.limit}.limit())
+		if arg := q.Args()["arg2"]; arg != test.want+1 {
+			t.Errorf("limit(%v): LIMIT = %v, want %d", test.limit, arg, test.want+1)
+		}
+	}
+	keys := make([]string, MaxLimit+5)
+	cursorAt := func(i int) Cursor {
+		return Cursor{Key: keys[i], ID: int64(i)}
+	}
+	if start, end, _, _ := Window(len(keys), cursorAt, Keyset{Limit: &huge}); end-start != MaxLimit {
+		t.Errorf("window with huge limit = %d rows, want %d", end-start, MaxLimit)
+	}
+	if start, end, _, _ := Window(len(keys), cursorAt, Keyset{Limit: &zero}); end-start != 1 {
+		t.Errorf("window with zero limit = %d rows, want 1", end-start)
+	}
+}
@@ -0,0 +1,179 @@
+package dbase
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+)
+
+type Condition func(q *Query) string
+
+type Query struct {
+	columns []string
+	from    string
+	joins   []string
+	where   []string
+	orderBy []string
+	limit   string
+	args    map[string]interface{}
+}
+
+func Select(columns ...string) *Query {
+	return &Query{columns: columns, args: map[string]interface{}{}}
+}
+
+func (q *Query) From(table string) *Query {
+	q.from = table
+	return q
+}
+
+func (q *Query) Join(table, on string) *Query {
+	q.joins = append(q.joins, "JOIN "+table+" ON "+on)
+	return q
+}
+
+func (q *Query) LeftJoin(table, on string) *Query {
+	q.joins = append(q.joins, "LEFT JOIN "+table+" ON "+on)
+	return q
+}
+
+func (q *Query) Where(conditions ...Condition) *Query {
+	for _, condition := range conditions {
+		if condition != nil {
+			q.where = append(q.where, condition(q))
+		}
+	}
+	return q
+}
+
+func (q *Query) OrderBy(columns ...string) *Query {
+	q.orderBy = append(q.orderBy, columns...)
+	return q
+}
+
+func (q *Query) Limit(limit int) *Query {
+	q.limit = q.bind(limit)
+	return q
+}
+
+func (q *Query) SQL() string {
+	var b strings.Builder
+	b.WriteString("SELECT " + strings.Join(q.columns, ", "))
+	b.WriteString(" FROM " + q.from)
+	for _, join := range q.joins {
+		b.WriteString(" " + join)
+	}
+	if len(q.where) > 0 {
+		b.WriteString(" WHERE " + strings.Join(q.where, " AND "))
+	}
+	if len(q.orderBy) > 0 {
+		b.WriteString(" ORDER BY " + strings.Join(q.orderBy, ", "))
+	}
+	if q.limit != "" {
+		b.WriteString(" LIMIT " + q.limit)
+	}
+	return b.String()
+}
+
+func (q *Query) Args() map[string]interface{} {
+	return q.args
+}
+
+func (q *Query) Rows(ctx context.Context) (*sqlx.Rows, error) {
+	return DB.NamedQueryContext(ctx, q.SQL(), q.args)
+}
+
+func (q *Query) Get(ctx context.Context, dest interface{}) error {
+	query, args, err := sqlx.Named(q.SQL(), q.args)
+	if err != nil {
+		return err
+	}
+	return DB.GetContext(ctx, dest, DB.Rebind(query), args...)
+}
+
+func (q *Query) bind(value interface{}) string {
+	name := fmt.Sprintf("arg%d", len(q.args)+1)
+	q.args[name] = value
+	return ":" + name
+}
+
+func Expr(sql string) Condition {
+	return func(q *Query) string {
+		return sql
+	}
+}
+
+func Eq(column string, value interface{}) Condition {
+	return func(q *Query) string {
+		return column + " = " + q.bind(value)
+	}
+}
+
+func Like(column string, value interface{}) Condition {
+	return func(q *Query) string {
+		return column + " LIKE " + q.bind(value)
+	}
+}
+
+func IsNull(column string) Condition {
+	return Expr(column + " IS NULL")
+}
+
+func In(column string, values ...interface{}) Condition {
+	return list(column, "IN", values)
+}
+
+func NotIn(column string, values ...interface{}) Condition {
+	return list(column, "NOT IN", values)
+}
+
+func list(column, operator string, values []interface{}) Condition {
+	return func(q *Query) string {
+		if len(values) == 0 {
+			if operator == "IN" {
+				return "FALSE"
+			}
+			return "TRUE"
+		}
+		names := make([]string, 0, len(values))
+		for _, value := range values {
+			names = append(names, q.bind(value))
+		}
+		return column + " " + operator + " (" + strings.Join(names, ", ") + ")"
+	}
+}
+
+func And(conditions ...Condition) Condition {
+	return group(" AND ", conditions)
+}
+
+func Or(conditions ...Condition) Condition {
+	return group(" OR ", conditions)
+}
+
+func group(separator string, conditions []Condition) Condition {
+	return func(q *Query) string {
+		parts := make([]string, 0, len(conditions))
+		for _, condition := range conditions {
+			if condition != nil {
+				parts = append(parts, condition(q))
+			}
+		}
+		if len(parts) == 0 {
+			return "TRUE"
+		}
+		return "(" + strings.Join(parts, separator) + ")"
+	}
+}
+
+func Visible(column string, showDisabled, showDeleted bool) Condition {
+	switch {
+	case showDeleted:
+		return nil
+	case showDisabled:
+		return NotIn(column, "deleted")
+	default:
+		return NotIn(column, "disabled", "deleted")
+	}
+}
@@ -0,0 +1,100 @@
+package dbase
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuerySQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+		sql   string
+		args  map[string]interface{}
+	}{
+		{
+			name:  "select",
+			query: Select("a", "b").From("t"),
+			sql:   "SELECT a, b FROM t",
+			args:  map[string]interface{}{},
+		},
+		{
+			name:  "joins",
+			query: Select("a").From("t").Join("u", "u.id = t.u_id").LeftJoin("v", "v.id = t.v_id"),
+			sql:   "SELECT a FROM t JOIN u ON u.id = t.u_id LEFT JOIN v ON v.id = t.v_id",
+			args:  map[string]interface{}{},
+		},
+		{
+			name:  "eq and like",
+			query: Select("a").From("t").Where(Eq("a", 1), Like("b", "x%")),
+			sql:   "SELECT a FROM t WHERE a = :arg1 AND b LIKE :arg2",
+			args:  map[string]interface{}{"arg1": 1, "arg2": "x%"},
+		},
+		{
+			name:  "nil conditions",
+			query: Select("a").From("t").Where(nil, Expr("a > 0"), nil),
+			sql:   "SELECT a FROM t WHERE a > 0",
+			args:  map[string]interface{}{},
+		},
+		{
+			name:  "in",
+			query: Select("a").From("t").Where(In("a", "x", "y"), NotIn("b", "z")),
+			sql:   "SELECT a FROM t WHERE a IN (:arg1, :arg2) AND b NOT IN (:arg3)",
+			args:  map[string]interface{}{"arg1": "x", "arg2": "y", "arg3": "z"},
+		},
+		{
+			name:  "empty in",
+			query: Select("a").From("t").Where(In("a"), NotIn("b")),
+			sql:   "SELECT a FROM t WHERE FALSE AND TRUE",
+			args:  map[string]interface{}{},
+		},
+		{
+			name:  "groups",
+			query: Select("a").From("t").Where(Or(Eq("a", 1), And(IsNull("b"), Eq("c", 2)), nil)),
+			sql:   "SELECT a FROM t WHERE (a = :arg1 OR (b IS NULL AND c = :arg2))",
+			args:  map[string]interface{}{"arg1": 1, "arg2": 2},
+		},
+		{
+			name:  "empty group",
+			query: Select("a").From("t").Where(And(), Or(nil)),
+			sql:   "SELECT a FROM t WHERE TRUE AND TRUE",
+			args:  map[string]interface{}{},
+		},
+		{
+			name:  "order and limit",
+			query: Select("a").From("t").Where(Eq("a", 1)).OrderBy("a", "b DESC").Limit(5),
+			sql:   "SELECT a FROM t WHERE a = :arg1 ORDER BY a, b DESC LIMIT :arg2",
+			args:  map[string]interface{}{"arg1": 1, "arg2": 5},
+		},
+	}
+	for _, test := range tests {
+		if sql := test.query.SQL(); sql != test.sql {
+			t.Errorf("%s:\n got: %s\nwant: %s", test.name, sql, test.sql)
+		}
+		if args := test.query.Args(); !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: args = %v, want %v", test.name, args, test.args)
+		}
+	}
+}
+
+func TestVisibleSQL(t *testing.T) {
+	tests := []struct {
+		disabled, deleted bool
+		sql               string
+		args              map[string]interface{}
+	}{
+		{false, false, "SELECT a FROM t WHERE type NOT IN (:arg1, :arg2)", map[string]interface{}{"arg1": "disabled", "arg2": "deleted"}},
+		{true, false, "SELECT a FROM t WHERE type NOT IN (:arg1)", map[string]interface{}{"arg1": "deleted"}},
+		{false, true, "SELECT a FROM t", map[string]interface{}{}},
+		{true, true, "SELECT a FROM t", map[string]interface{}{}},
+	}
+	for _, test := range tests {
+		q := Select("a").From("t").Where(Visible("type", test.disabled, test.deleted))
+		if sql := q.SQL(); sql != test.sql {
+			t.Errorf("disabled=%v deleted=%v:\n got: %s\nwant: %s", test.disabled, test.deleted, sql, test.sql)
+		}
+		if !reflect.DeepEqual(q.Args(), test.args) {
+			t.Errorf("disabled=%v deleted=%v: args = %v", test.disabled, test.deleted, q.Args())
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package domains
 
 import (
+	"database/sql"
+	"errors"
 	"files-back/dbase/dbdomains"
 	"files-back/handlers"
 	"files-back/handlers/incoming"
@@ -8,16 +10,28 @@ import (
 	"net/http"
 )
 
+var Repository dbdomains.Repository = dbdomains.SQLRepository{}
+
+var MissingBindPassword = errors.New("directory bind password is required")
+
+func List(w http.ResponseWriter, r *http.Request) {
+	domains, err := Repository.Query(r.Context(), params.GetQueryParams(r))
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, domains)
+}
+
 func Get(w http.ResponseWriter, r *http.Request) {
-	domains, err := dbdomains.Query(params.GetQueryParams(r))
+	domains, err := Repository.Query(r.Context(), params.GetQueryParams(r))
 	switch {
 	case err != nil:
-		handlers.StatusBadData(err, w)
-		return
-	case len(domains) == 1:
-		handlers.ResponseJSON(w, domains[0])
+		handlers.ReturnError(w, err)
+	case len(domains.Items) == 0:
+		handlers.StatusNotFound(sql.ErrNoRows, w)
 	default:
-		handlers.ResponseJSON(w, domains)
+		handlers.ResponseJSON(w, domains.Items[0])
 	}
 }
 
@@ -27,7 +41,11 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbdomains.Insert(n.ToDB(r)); err != nil {
+	if n.Directory != nil && n.Directory.BindPassword == nil {
+		handlers.StatusBadData(MissingBindPassword, w)
+		return
+	}
+	if err := Repository.Insert(r.Context(), n.ToDB(r)); err != nil {
 		handlers.ReturnError(w, err)
 		return
 	}
@@ -40,16 +58,16 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbdomains.Update(n.ToDB(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if err := Repository.Update(r.Context(), n.ToDB(r)); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusInserted(w)
 }
 
 func Delete(w http.ResponseWriter, r *http.Request) {
-	if err := dbdomains.Delete(params.GetQueryParams(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if err := Repository.Delete(r.Context(), params.GetQueryParams(r)); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusDeleted(w)
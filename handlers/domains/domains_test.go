@@ -0,0 +1,114 @@
+package domains
+
+import (
+	"encoding/json"
+	"files-back/dbase/dbmemory"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newStore(t *testing.T) *dbmemory.Store {
+	t.Helper()
+	store := dbmemory.New()
+	repository := Repository
+	Repository = store.Domains()
+	t.Cleanup(func() {
+		Repository = repository
+	})
+	return store
+}
+
+func serve(method, path, body string) (int, int) {
+	router := mux.NewRouter()
+	router.HandleFunc("/domains", List).Methods(http.MethodGet)
+	router.HandleFunc("/domains", Create).Methods(http.MethodPost)
+	router.HandleFunc("/domains/{domainName}", Get).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}", Update).Methods(http.MethodPut)
+	router.HandleFunc("/domains/{domainName}", Delete).Methods(http.MethodDelete)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var status handlers.Status
+	_ = json.NewDecoder(w.Body).Decode(&status)
+	return w.Code, status.Code
+}
+
+func domainBody(name, directory string) string {
+	body := `{"name":"` + name + `","organisation":"Org","primaryUrl":"https://` + name + `.com","adminUrl":"https://admin.` + name +
+		`.com","data_path":"/data/` + name + `","user_name":"` + name + `admin","password":"long-enough-password","type":"primary"`
+	if directory != "" {
+		body += `,"directory":` + directory
+	}
+	return body + "}"
+}
+
+func TestCreateDirectoryNeedsBindCredentials(t *testing.T) {
+	newStore(t)
+	tests := []struct {
+		directory string
+		code      int
+	}{
+		{`{"server":"ldap://ldap.d1.com","baseDn":"dc=d1,dc=com"}`, http.StatusBadRequest},
+		{`{"server":"ldap://ldap.d1.com","baseDn":"dc=d1,dc=com","bindUsername":"cn=reader"}`, http.StatusBadRequest},
+		{`{"server":"ldap://ldap.d1.com","baseDn":"dc=d1,dc=com","bindUsername":"","bindPassword":"secret"}`, http.StatusBadRequest},
+		{`{"server":"ldap://ldap.d1.com","baseDn":"dc=d1,dc=com","bindUsername":"cn=reader","bindPassword":""}`, http.StatusBadRequest},
+		{`{"server":"ldap://ldap.d1.com","baseDn":"dc=d1,dc=com","bindUsername":"cn=reader","bindPassword":"secret"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		if _, code := serve(http.MethodPost, "/domains", domainBody("d1", test.directory)); code != test.code {
+			t.Errorf("%s: code = %d, want %d", test.directory, code, test.code)
+		}
+	}
+	directory := `{"server":"ldap://ldap.d1.com","baseDn":"dc=d1,dc=com","bindUsername":"cn=reader"}`
+	if _, code := serve(http.MethodPut, "/domains/d1", domainBody("d1", directory)); code != http.StatusOK {
+		t.Errorf("update keeping the stored bind password: code = %d", code)
+	}
+}
+
+func TestDomainLifecycle(t *testing.T) {
+	newStore(t)
+	if _, code := serve(http.MethodPost, "/domains", domainBody("d1", "")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, "/domains", domainBody("d2", "")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, "/domains", domainBody("d1", "")); code != http.StatusBadRequest {
+		t.Errorf("duplicate create: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if _, code := serve(http.MethodPut, "/domains/d2", domainBody("d1", "")); code != http.StatusBadRequest {
+		t.Errorf("rename onto an existing domain: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := serve(http.MethodPut, "/domains/missing", domainBody("missing", "")); code != http.StatusNotFound {
+		t.Errorf("update missing domain: code = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if _, code := serve(http.MethodDelete, "/domains/d1", ""); code != http.StatusOK {
+		t.Fatalf("delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d1", ""); code != http.StatusNotFound {
+		t.Errorf("disabled domain visible by default: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d1?disabled=true", ""); code != http.StatusOK {
+		t.Errorf("disabled domain hidden with disabled=true: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, "/domains", domainBody("d1", "")); code != http.StatusBadRequest {
+		t.Errorf("disabled domain name reused: code = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	if _, code := serve(http.MethodDelete, "/domains/d2?forced=true", ""); code != http.StatusOK {
+		t.Fatalf("forced delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d2?disabled=true", ""); code != http.StatusNotFound {
+		t.Errorf("deleted domain visible with disabled=true: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d2?deleted=true", ""); code != http.StatusOK {
+		t.Errorf("deleted domain hidden with deleted=true: code = %d", code)
+	}
+	if code, _ := serve(http.MethodDelete, "/domains/missing", ""); code != http.StatusNotFound {
+		t.Errorf("delete missing domain: code = %d, want %d", code, http.StatusNotFound)
+	}
+}
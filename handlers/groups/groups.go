@@ -1,23 +1,36 @@
 package groups
 
 import (
+	"database/sql"
+	"files-back/auth/directory"
 	"files-back/dbase/dbgroups"
 	"files-back/handlers"
 	"files-back/handlers/incoming"
 	"files-back/handlers/params"
+	"log"
 	"net/http"
 )
 
-func Get(w http.ResponseWriter, r *http.Request) {
-	tenants, err := dbgroups.Query(params.GetQueryParams(r))
+var Repository dbgroups.Repository = dbgroups.SQLRepository{}
+
+func List(w http.ResponseWriter, r *http.Request) {
+	groups, err := Repository.Query(r.Context(), params.GetQueryParams(r))
 	if err != nil {
-		handlers.StatusBadData(err, w)
+		handlers.ReturnError(w, err)
 		return
 	}
-	if len(tenants) == 1 {
-		handlers.ResponseJSON(w, tenants[0])
-	} else {
-		handlers.ResponseJSON(w, tenants)
+	handlers.ResponseJSON(w, groups)
+}
+
+func Get(w http.ResponseWriter, r *http.Request) {
+	groups, err := Repository.Query(r.Context(), params.GetQueryParams(r))
+	switch {
+	case err != nil:
+		handlers.ReturnError(w, err)
+	case len(groups.Items) == 0:
+		handlers.StatusNotFound(sql.ErrNoRows, w)
+	default:
+		handlers.ResponseJSON(w, groups.Items[0])
 	}
 }
 
@@ -27,10 +40,18 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbgroups.Insert(n.ToDB(r)); err != nil {
+	group := n.ToDB(r)
+	if err := Repository.Insert(r.Context(), group); err != nil {
 		handlers.ReturnError(w, err)
 		return
 	}
+	if err := directory.Provisioning.CreateGroup(groupEntry(group)); err != nil {
+		if pErr := Repository.Purge(r.Context(), group); pErr != nil {
+			log.Printf("groups: failed to remove %s after provisioning error: %v", group.Name, pErr)
+		}
+		handlers.StatusDirectoryError(err, w)
+		return
+	}
 	handlers.StatusInserted(w)
 }
 
@@ -38,8 +59,30 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	var n incoming.Groups
 	if err := incoming.Extract(r, &n); err != nil {
 		handlers.StatusBadData(err, w)
+		return
 	}
-	if err := dbgroups.Update(n.ToDB(r)); err != nil {
+	p := params.GetQueryParams(r)
+	p.ShowDisabled, p.ShowDeleted = true, true
+	current, err := Repository.Query(r.Context(), p)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	if len(current.Items) == 0 {
+		handlers.StatusNotFound(sql.ErrNoRows, w)
+		return
+	}
+	group := n.ToDB(r)
+	old := groupEntry(group)
+	old.Name = *current.Items[0].Name
+	if err := directory.Provisioning.UpdateGroup(old.Name, groupEntry(group)); err != nil {
+		handlers.StatusDirectoryError(err, w)
+		return
+	}
+	if err := Repository.Update(r.Context(), group); err != nil {
+		if pErr := directory.Provisioning.UpdateGroup(group.Name, old); pErr != nil {
+			log.Printf("groups: failed to restore directory entry %s: %v", old.Name, pErr)
+		}
 		handlers.ReturnError(w, err)
 		return
 	}
@@ -47,17 +90,37 @@ func Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func Delete(w http.ResponseWriter, r *http.Request) {
-	if err := dbgroups.Delete(params.GetQueryParams(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	p := params.GetQueryParams(r)
+	if err := Repository.Delete(r.Context(), p); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
+	if *p.DeleteType == "deleted" {
+		err := directory.Provisioning.DeleteGroup(directory.GroupEntry{
+			Name:   *p.GroupName,
+			Domain: *p.DomainName,
+			Tenant: *p.TenantName,
+		})
+		if err != nil {
+			handlers.StatusDirectoryError(err, w)
+			return
+		}
+	}
 	handlers.StatusDeleted(w)
 }
 
 func Add(w http.ResponseWriter, r *http.Request) {
-	if err := dbgroups.Delete(params.GetQueryParams(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if err := Repository.Delete(r.Context(), params.GetQueryParams(r)); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusDeleted(w)
 }
+
+func groupEntry(group *dbgroups.DBStruct) directory.GroupEntry {
+	return directory.GroupEntry{
+		Name:   group.Name,
+		Domain: group.Domain.Name,
+		Tenant: group.Tenant.Name,
+	}
+}
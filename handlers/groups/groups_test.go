@@ -0,0 +1,240 @@
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/auth/directory"
+	"files-back/auth/directory/ldaptest"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbgroups"
+	"files-back/dbase/dbmemory"
+	"files-back/dbase/dbplans"
+	"files-back/dbase/dbtenants"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const groupsOU = "ou=groups,ou=t1,ou=d1,dc=example,dc=com"
+
+func newStore(t *testing.T) *dbmemory.Store {
+	t.Helper()
+	ctx := context.Background()
+	store := dbmemory.New()
+	domain, plan := "d1", "p1"
+	steps := []error{
+		store.Domains().Insert(ctx, &dbdomains.DBStruct{Name: domain}),
+		store.Plans().Insert(ctx, &dbplans.DBStruct{Name: plan, DomainName: &domain}),
+		store.Tenants().Insert(ctx, &dbtenants.DBStruct{
+			Name:   "t1",
+			Domain: &dbdomains.DBStruct{Name: domain},
+			Plan:   &dbplans.DBStruct{Name: plan},
+		}),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	repository := Repository
+	Repository = store.Groups()
+	t.Cleanup(func() {
+		Repository = repository
+	})
+	return store
+}
+
+func addGroup(t *testing.T, name string) {
+	t.Helper()
+	typ := "regular"
+	err := Repository.Insert(context.Background(), &dbgroups.DBStruct{
+		Name:   name,
+		Type:   &typ,
+		Tenant: &dbtenants.DBStruct{Name: "t1"},
+		Domain: &dbdomains.DBStruct{Name: "d1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withDirectory(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+	server.Add("dc=example,dc=com", map[string][]string{"objectClass": {"domain"}})
+	server.Add("cn=admin,dc=example,dc=com", map[string][]string{"cn": {"admin"}, "userPassword": {"secret"}})
+	pool, err := directory.NewPool(directory.Config{
+		Servers:      []string{server.URL},
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "secret",
+		BaseDN:       "dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	provisioning := directory.Provisioning
+	directory.Provisioning = directory.NewLDAPProvisioner(func(string) (*directory.Pool, error) {
+		return pool, nil
+	})
+	t.Cleanup(func() {
+		directory.Provisioning = provisioning
+	})
+	return server
+}
+
+func serve(method, path, body string) (int, int) {
+	router := mux.NewRouter()
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/groups", List).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/groups", Create).Methods(http.MethodPost)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/groups/{groupName}", Get).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/groups/{groupName}", Update).Methods(http.MethodPut)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/groups/{groupName}", Delete).Methods(http.MethodDelete)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var status handlers.Status
+	_ = json.NewDecoder(w.Body).Decode(&status)
+	return w.Code, status.Code
+}
+
+func groupBody(name string) string {
+	return `{"name":"` + name + `","type":"regular"}`
+}
+
+func TestCreateProvisioningFailure(t *testing.T) {
+	newStore(t)
+	server := withDirectory(t)
+	server.Add("ou=d1,dc=example,dc=com", nil)
+	server.Add("ou=t1,ou=d1,dc=example,dc=com", nil)
+	server.Add(groupsOU, nil)
+	server.Add("cn=taken,"+groupsOU, map[string][]string{"cn": {"taken"}})
+	const groups = "/domains/d1/tenants/t1/groups"
+	if code, _ := serve(http.MethodPost, groups, groupBody("taken")); code != http.StatusBadGateway {
+		t.Fatalf("create: code = %d, want %d", code, http.StatusBadGateway)
+	}
+	if code, _ := serve(http.MethodGet, groups+"/taken", ""); code != http.StatusNotFound {
+		t.Errorf("row left behind after provisioning failure: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, groups, groupBody("staff")); code != http.StatusOK {
+		t.Errorf("create after failure: code = %d", code)
+	}
+	if server.Entry("cn=staff,"+groupsOU) == nil {
+		t.Errorf("directory entry not created: %v", server.DNs())
+	}
+}
+
+func TestUpdateProvisioningFailure(t *testing.T) {
+	newStore(t)
+	withDirectory(t)
+	addGroup(t, "staff")
+	const groups = "/domains/d1/tenants/t1/groups"
+	if code, _ := serve(http.MethodPut, groups+"/staff", groupBody("crew")); code != http.StatusBadGateway {
+		t.Fatalf("update without directory entry: code = %d, want %d", code, http.StatusBadGateway)
+	}
+	if code, _ := serve(http.MethodGet, groups+"/staff", ""); code != http.StatusOK {
+		t.Errorf("row changed despite provisioning failure: code = %d", code)
+	}
+}
+
+func TestUpdateRestoresDirectory(t *testing.T) {
+	newStore(t)
+	server := withDirectory(t)
+	const groups = "/domains/d1/tenants/t1/groups"
+	if _, code := serve(http.MethodPost, groups, groupBody("staff")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	addGroup(t, "crew")
+	if _, code := serve(http.MethodPut, groups+"/staff", groupBody("crew")); code != http.StatusBadRequest {
+		t.Fatalf("rename onto an existing group: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if server.Entry("cn=staff,"+groupsOU) == nil || server.Entry("cn=crew,"+groupsOU) != nil {
+		t.Errorf("directory not restored after database failure: %v", server.DNs())
+	}
+	if _, code := serve(http.MethodPut, groups+"/staff", groupBody("team")); code != http.StatusOK {
+		t.Fatalf("rename: code = %d", code)
+	}
+	if server.Entry("cn=team,"+groupsOU) == nil {
+		t.Errorf("directory entry not renamed: %v", server.DNs())
+	}
+}
+
+func TestUpdateMissingGroup(t *testing.T) {
+	newStore(t)
+	server := withDirectory(t)
+	if code, _ := serve(http.MethodPut, "/domains/d1/tenants/t1/groups/ghost", groupBody("crew")); code != http.StatusNotFound {
+		t.Errorf("update missing group: code = %d, want %d", code, http.StatusNotFound)
+	}
+	if dns := server.DNs(); len(dns) != 2 {
+		t.Errorf("directory touched for a missing group: %v", dns)
+	}
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	store := newStore(t)
+	domain := "d1"
+	err := store.Tenants().Insert(context.Background(), &dbtenants.DBStruct{
+		Name:   "t2",
+		Domain: &dbdomains.DBStruct{Name: domain},
+		Plan:   &dbplans.DBStruct{Name: "p1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const t1 = "/domains/d1/tenants/t1/groups"
+	if _, code := serve(http.MethodPost, t1, groupBody("staff")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, t1, groupBody("crew")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, t1, groupBody("staff")); code != http.StatusBadRequest {
+		t.Errorf("duplicate create: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if _, code := serve(http.MethodPost, "/domains/d1/tenants/t2/groups", groupBody("staff")); code != http.StatusOK {
+		t.Errorf("same name in another tenant: code = %d", code)
+	}
+
+	if _, code := serve(http.MethodDelete, t1+"/staff", ""); code != http.StatusOK {
+		t.Fatalf("delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, t1+"/staff", ""); code != http.StatusNotFound {
+		t.Errorf("disabled group visible by default: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, t1+"/staff?disabled=true", ""); code != http.StatusOK {
+		t.Errorf("disabled group hidden with disabled=true: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d1/tenants/t2/groups/staff", ""); code != http.StatusOK {
+		t.Errorf("deleting a group touched another tenant: code = %d", code)
+	}
+	if _, code := serve(http.MethodDelete, t1+"/crew?forced=true", ""); code != http.StatusOK {
+		t.Fatalf("forced delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, t1+"/crew?deleted=true", ""); code != http.StatusOK {
+		t.Errorf("deleted group hidden with deleted=true: code = %d", code)
+	}
+}
+
+func TestGroupMissingParent(t *testing.T) {
+	newStore(t)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/domains/missing/tenants/t1/groups", groupBody("staff")},
+		{http.MethodPost, "/domains/d1/tenants/missing/groups", groupBody("staff")},
+		{http.MethodGet, "/domains/d1/tenants/missing/groups/staff", ""},
+		{http.MethodPut, "/domains/d1/tenants/missing/groups/staff", groupBody("crew")},
+		{http.MethodDelete, "/domains/d1/tenants/t1/groups/missing", ""},
+		{http.MethodDelete, "/domains/d1/tenants/missing/groups/staff", ""},
+	}
+	for _, test := range tests {
+		if code, _ := serve(test.method, test.path, test.body); code != http.StatusNotFound {
+			t.Errorf("%s %s: code = %d, want %d", test.method, test.path, code, http.StatusNotFound)
+		}
+	}
+}
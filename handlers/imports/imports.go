@@ -0,0 +1,163 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"files-back/auth"
+	"files-back/auth/directory"
+	"files-back/dbase/dbimport"
+	"files-back/handlers"
+	"files-back/handlers/incoming"
+	"files-back/handlers/params"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var Directory = func(ctx context.Context, domain string) (*directory.Pool, error) {
+	return directory.DefaultPool()
+}
+
+var SharedDirectory = errors.New("domain has no directory of its own")
+
+type User struct {
+	Email  string   `json:"email"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+type Conflict struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type Report struct {
+	Users     []User     `json:"users"`
+	Groups    []string   `json:"groups"`
+	Conflicts []Conflict `json:"conflicts"`
+	Applied   bool       `json:"applied"`
+}
+
+func Create(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	if !auth.CanManage(principal, auth.RoleDomainAdmin) {
+		handlers.StatusForbidden(auth.Forbidden, w)
+		return
+	}
+	var n incoming.Import
+	if err := incoming.Extract(r, &n); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	p := params.GetQueryParams(r)
+	shared := principal.Type == auth.RoleFullAdmin && !principal.ServiceAccount
+	report, err := Run(r.Context(), *p.DomainName, *p.TenantName, n, shared)
+	if errors.Is(err, SharedDirectory) {
+		handlers.StatusForbidden(err, w)
+		return
+	}
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, report)
+}
+
+func Run(ctx context.Context, domainName, tenantName string, n incoming.Import, shared bool) (*Report, error) {
+	pool, err := Directory(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+	if !shared && pool.Config.Domain != domainName {
+		return nil, SharedDirectory
+	}
+	if err := dbimport.CheckTariff(ctx, domainName, n.Tariff); err != nil {
+		return nil, err
+	}
+	found, err := pool.SearchUsers(n.BaseDN, n.Filter)
+	if err != nil {
+		return nil, err
+	}
+	report, data, err := plan(ctx, domainName, tenantName, found)
+	if err != nil {
+		return nil, err
+	}
+	data.TariffName = n.Tariff
+	if n.Apply {
+		if err := dbimport.Apply(ctx, data); err != nil {
+			return nil, err
+		}
+		report.Applied = true
+	}
+	return report, nil
+}
+
+func plan(ctx context.Context, domainName, tenantName string, found []*directory.User) (*Report, *dbimport.DBStruct, error) {
+	validate := validator.New()
+	report := Report{
+		Users:     []User{},
+		Groups:    []string{},
+		Conflicts: []Conflict{},
+	}
+	data := dbimport.DBStruct{
+		DomainName: domainName,
+		TenantName: tenantName,
+	}
+	emails := make([]string, 0, len(found))
+	for _, user := range found {
+		emails = append(emails, user.Email)
+	}
+	existing, err := dbimport.ExistingEmails(ctx, emails)
+	if err != nil {
+		return nil, nil, err
+	}
+	taken := make(map[string]string, len(existing))
+	for _, email := range existing {
+		taken[email] = "email already exists"
+	}
+	existingGroups, err := dbimport.ExistingGroups(ctx, domainName, tenantName)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := make(map[string]bool, len(existingGroups))
+	for _, name := range existingGroups {
+		groups[name] = false
+	}
+	for _, user := range found {
+		if validate.Var(user.Email, "required,email") != nil {
+			report.Conflicts = append(report.Conflicts, Conflict{Name: user.DN, Reason: "missing or invalid email"})
+			continue
+		}
+		if reason, ok := taken[user.Email]; ok {
+			report.Conflicts = append(report.Conflicts, Conflict{Name: user.Email, Reason: reason})
+			continue
+		}
+		taken[user.Email] = "duplicate email in directory"
+		name := strings.TrimSpace(user.DisplayName)
+		if name == "" {
+			name = user.Email
+		}
+		imported := User{Email: user.Email, Name: name, Groups: []string{}}
+		for _, dn := range user.Groups {
+			group := directory.GroupName(dn)
+			if validate.Var(group, "alphanum,min=2,max=15,lowercase") != nil {
+				continue
+			}
+			imported.Groups = append(imported.Groups, group)
+			if _, ok := groups[group]; !ok {
+				groups[group] = true
+			}
+		}
+		report.Users = append(report.Users, imported)
+		data.Users = append(data.Users, dbimport.UserStruct{Email: user.Email, DisplayName: name})
+	}
+	for group, create := range groups {
+		if create {
+			report.Groups = append(report.Groups, group)
+		}
+	}
+	sort.Strings(report.Groups)
+	data.Groups = report.Groups
+	return &report, &data, nil
+}
@@ -0,0 +1,81 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"files-back/auth"
+	"files-back/auth/directory"
+	"files-back/auth/directory/ldaptest"
+	"files-back/handlers/incoming"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCreateRequiresDomainAdmin(t *testing.T) {
+	for _, role := range []string{auth.RoleRegular, auth.RoleTenantAdmin} {
+		principal := &auth.Principal{Username: "admin@d1.com", Type: role, Domain: "d1", Tenant: "t1"}
+		body := `{"baseDn":"dc=example,dc=com","filter":"(mail=*)","tariff":"basic","apply":true}`
+		r := httptest.NewRequest(http.MethodPost, "/domains/d1/tenants/t1/import", strings.NewReader(body))
+		r = r.WithContext(auth.ContextWithPrincipal(r.Context(), principal))
+		w := httptest.NewRecorder()
+		Create(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: code = %d, want %d", role, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func withDirectory(t *testing.T, domain string) {
+	t.Helper()
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+	server.Add("dc=example,dc=com", map[string][]string{"objectClass": {"domain"}})
+	server.Add("cn=admin,dc=example,dc=com", map[string][]string{"cn": {"admin"}, "userPassword": {"secret"}})
+	server.Add("uid=user@other.com,dc=example,dc=com", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"mail":        {"user@other.com"},
+		"displayName": {"user"},
+	})
+	pool, err := directory.NewPool(directory.Config{
+		Domain:        domain,
+		Servers:       []string{server.URL},
+		BindDN:        "cn=admin,dc=example,dc=com",
+		BindPassword:  "secret",
+		BaseDN:        "dc=example,dc=com",
+		ObjectClasses: []string{"inetOrgPerson"},
+		MailAttribute: "mail",
+		NameAttribute: "displayName",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	lookup := Directory
+	Directory = func(ctx context.Context, domain string) (*directory.Pool, error) {
+		return pool, nil
+	}
+	t.Cleanup(func() {
+		Directory = lookup
+	})
+}
+
+func TestCreateRejectsSharedDirectory(t *testing.T) {
+	withDirectory(t, "")
+	principal := &auth.Principal{Username: "admin@d1.com", Type: auth.RoleDomainAdmin, Domain: "d1", Tenant: "t1"}
+	body := `{"baseDn":"dc=example,dc=com","filter":"(mail=*)","tariff":"basic"}`
+	r := httptest.NewRequest(http.MethodPost, "/domains/d1/tenants/t1/import", strings.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"domainName": "d1", "tenantName": "t1"})
+	r = r.WithContext(auth.ContextWithPrincipal(r.Context(), principal))
+	w := httptest.NewRecorder()
+	Create(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if _, err := Run(context.Background(), "d1", "t1", incoming.Import{Tariff: "basic"}, false); !errors.Is(err, SharedDirectory) {
+		t.Errorf("err = %v, want %v", err, SharedDirectory)
+	}
+}
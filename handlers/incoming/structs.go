@@ -5,6 +5,7 @@ import (
 	"files-back/dbase/dbdomains"
 	"files-back/dbase/dbgroups"
 	"files-back/dbase/dbplans"
+	"files-back/dbase/dbserviceaccounts"
 	"files-back/dbase/dbtariffs"
 	"files-back/dbase/dbtenants"
 	"files-back/dbase/dbusers"
@@ -30,15 +31,33 @@ func Extract(r *http.Request, new interface{}) error {
 }
 
 type Domain struct {
-	Name         string `json:"name" validate:"required,alphanum,min=2,max=15,lowercase"`
-	Organisation string `json:"organisation" validate:"required"`
-	PrimaryURL   string `json:"primaryUrl" validate:"required,url"`
-	AdminURL     string `json:"adminUrl" validate:"required,url"`
-	DataPath     string `json:"data_path" validate:"required"`
-	UserName     string `json:"user_name" validate:"required,alphanum,min=2,max=15,lowercase"`
-	Password     string `json:"password" validate:"required,min=12"`
-	Type         string `json:"type" validate:"required,oneof=primary wholesale premium"`
-	Description  string `json:"description"`
+	Name         string           `json:"name" validate:"required,alphanum,min=2,max=15,lowercase"`
+	Organisation string           `json:"organisation" validate:"required"`
+	PrimaryURL   string           `json:"primaryUrl" validate:"required,url"`
+	AdminURL     string           `json:"adminUrl" validate:"required,url"`
+	DataPath     string           `json:"data_path" validate:"required"`
+	UserName     string           `json:"user_name" validate:"required,alphanum,min=2,max=15,lowercase"`
+	Password     string           `json:"password" validate:"required,min=12"`
+	Type         string           `json:"type" validate:"required,oneof=primary wholesale premium"`
+	Description  string           `json:"description"`
+	Directory    *DomainDirectory `json:"directory"`
+	SAML         *DomainSAML      `json:"saml"`
+}
+
+type DomainDirectory struct {
+	Server       string  `json:"server" validate:"required"`
+	BaseDN       string  `json:"baseDn" validate:"required"`
+	BindUsername *string `json:"bindUsername" validate:"required,min=1"`
+	BindPassword *string `json:"bindPassword" validate:"omitempty,min=1"`
+	UserFilter   *string `json:"userFilter"`
+	MailDomain   *string `json:"mailDomain" validate:"omitempty,fqdn,lowercase"`
+}
+
+type DomainSAML struct {
+	EntityID       string  `json:"entityId" validate:"required"`
+	SSOURL         string  `json:"ssoUrl" validate:"required,url"`
+	Certificate    string  `json:"certificate" validate:"required"`
+	EmailAttribute *string `json:"emailAttribute"`
 }
 
 func (incoming *Domain) ToDB(r *http.Request) *dbdomains.DBStruct {
@@ -55,6 +74,24 @@ func (incoming *Domain) ToDB(r *http.Request) *dbdomains.DBStruct {
 		UserName:     &incoming.UserName,
 		Type:         &incoming.Type,
 	}
+	if incoming.Directory != nil {
+		res.DirectoryStruct = dbdomains.DirectoryStruct{
+			Server:       &incoming.Directory.Server,
+			BaseDN:       &incoming.Directory.BaseDN,
+			BindUsername: incoming.Directory.BindUsername,
+			BindPassword: incoming.Directory.BindPassword,
+			UserFilter:   incoming.Directory.UserFilter,
+			MailDomain:   incoming.Directory.MailDomain,
+		}
+	}
+	if incoming.SAML != nil {
+		res.SAMLStruct = dbdomains.SAMLStruct{
+			EntityID:       &incoming.SAML.EntityID,
+			SSOURL:         &incoming.SAML.SSOURL,
+			Certificate:    &incoming.SAML.Certificate,
+			EmailAttribute: incoming.SAML.EmailAttribute,
+		}
+	}
 	return &res
 }
 
@@ -202,3 +239,47 @@ func (incoming *Groups) ToDB(r *http.Request) *dbgroups.DBStruct {
 	}
 	return &resp
 }
+
+type ServiceAccount struct {
+	Name        string  `json:"name" validate:"required,hostname,min=2,max=63,lowercase"`
+	Type        string  `json:"type" validate:"required,oneof=full_Admin domain_admin tenant_admin regular"`
+	Domain      string  `json:"domain" validate:"required_with=Tenant"`
+	Tenant      string  `json:"tenant"`
+	Description *string `json:"description"`
+	Certificate *string `json:"certificateSubject"`
+}
+
+func (incoming *ServiceAccount) ToDB() *dbserviceaccounts.DBStruct {
+	return &dbserviceaccounts.DBStruct{
+		Name:        incoming.Name,
+		Type:        &incoming.Type,
+		Description: incoming.Description,
+		Certificate: incoming.Certificate,
+		Domain: &dbdomains.DBStruct{
+			Name: incoming.Domain,
+		},
+		Tenant: &dbtenants.DBStruct{
+			Name: incoming.Tenant,
+		},
+	}
+}
+
+type APIToken struct {
+	Name           string   `json:"name" validate:"required,min=2,max=64"`
+	Scopes         []string `json:"scopes" validate:"required,min=1"`
+	ExpiresAt      *string  `json:"expiresAt" validate:"omitempty,datetime=2006-01-02"`
+	ServiceAccount *string  `json:"serviceAccount"`
+}
+
+type Import struct {
+	BaseDN string `json:"baseDn"`
+	Filter string `json:"filter"`
+	Tariff string `json:"tariff" validate:"required"`
+	Apply  bool   `json:"apply"`
+}
+
+type Impersonation struct {
+	Email   string `json:"email" validate:"required,email"`
+	Reason  string `json:"reason" validate:"required,min=5"`
+	Minutes int    `json:"minutes" validate:"omitempty,min=1,max=240"`
+}
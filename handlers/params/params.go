@@ -19,34 +19,40 @@ const (
 )
 
 type QueryParams struct {
-	Limit        *int    `db:"limit"`
-	Offset       *int    `db:"offset"`
-	Search       *string `db:"search"`
-	DeleteType   *string `db:"delete"`
-	ShowDeleted  bool
-	ShowDisabled bool
-	Email        *string `db:"email"`
-	DomainName   *string `db:"domain_name"`
-	TenantName   *string `db:"tenant_name"`
-	PlanName     *string `db:"plan_name"`
-	TariffName   *string `db:"tariff_name"`
-	GroupName    *string `db:"group_name"`
+	Limit          *int    `db:"limit"`
+	Offset         *int    `db:"offset"`
+	After          *string `db:"-"`
+	Before         *string `db:"-"`
+	Search         *string `db:"search"`
+	DeleteType     *string `db:"delete"`
+	ShowDeleted    bool
+	ShowDisabled   bool
+	Email          *string `db:"email"`
+	DomainName     *string `db:"domain_name"`
+	TenantName     *string `db:"tenant_name"`
+	PlanName       *string `db:"plan_name"`
+	TariffName     *string `db:"tariff_name"`
+	GroupName      *string `db:"group_name"`
+	ServiceAccount *string `db:"service_account"`
 }
 
 func GetQueryParams(r *http.Request) QueryParams {
 	resp := QueryParams{
-		Limit:        getLimit(r),
-		Offset:       getOffset(r),
-		Search:       getSearchLine(r),
-		Email:        getEmail(r),
-		DomainName:   getDomain(r),
-		TenantName:   getTenant(r),
-		GroupName:    getGroup(r),
-		PlanName:     getPlan(r),
-		TariffName:   getTariff(r),
-		DeleteType:   getDeleteType(r),
-		ShowDeleted:  getDeleted(r),
-		ShowDisabled: getDisabled(r),
+		Limit:          getLimit(r),
+		Offset:         getOffset(r),
+		After:          getCursor(r, "after"),
+		Before:         getCursor(r, "before"),
+		Search:         getSearchLine(r),
+		Email:          getEmail(r),
+		DomainName:     getDomain(r),
+		TenantName:     getTenant(r),
+		GroupName:      getGroup(r),
+		PlanName:       getPlan(r),
+		TariffName:     getTariff(r),
+		ServiceAccount: getServiceAccount(r),
+		DeleteType:     getDeleteType(r),
+		ShowDeleted:    getDeleted(r),
+		ShowDisabled:   getDisabled(r),
 	}
 	return resp
 }
@@ -77,6 +83,15 @@ func getOffset(r *http.Request) *int {
 	return &resp
 }
 
+func getCursor(r *http.Request, name string) *string {
+	switch resp := r.URL.Query().Get(name); resp {
+	case noData:
+		return nil
+	default:
+		return &resp
+	}
+}
+
 func getDomain(r *http.Request) *string {
 	switch resp := mux.Vars(r)["domainName"]; resp {
 	case noData:
@@ -122,6 +137,15 @@ func getEmail(r *http.Request) *string {
 	}
 }
 
+func getServiceAccount(r *http.Request) *string {
+	switch resp := mux.Vars(r)["serviceAccountName"]; resp {
+	case noData:
+		return nil
+	default:
+		return &resp
+	}
+}
+
 func getPlan(r *http.Request) *string {
 	switch resp := mux.Vars(r)["planName"]; resp {
 	case noData:
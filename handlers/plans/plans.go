@@ -1,6 +1,7 @@
 package plans
 
 import (
+	"database/sql"
 	"files-back/dbase/dbplans"
 	"files-back/handlers"
 	"files-back/handlers/incoming"
@@ -8,16 +9,26 @@ import (
 	"net/http"
 )
 
+var Repository dbplans.Repository = dbplans.SQLRepository{}
+
+func List(w http.ResponseWriter, r *http.Request) {
+	plans, err := Repository.Query(r.Context(), params.GetQueryParams(r))
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, plans)
+}
+
 func Get(w http.ResponseWriter, r *http.Request) {
-	plans, err := dbplans.Query(params.GetQueryParams(r))
+	plans, err := Repository.Query(r.Context(), params.GetQueryParams(r))
 	switch {
 	case err != nil:
-		handlers.StatusBadData(err, w)
-		return
-	case len(plans) == 1:
-		handlers.ResponseJSON(w, plans[0])
+		handlers.ReturnError(w, err)
+	case len(plans.Items) == 0:
+		handlers.StatusNotFound(sql.ErrNoRows, w)
 	default:
-		handlers.ResponseJSON(w, plans)
+		handlers.ResponseJSON(w, plans.Items[0])
 	}
 }
 
@@ -27,7 +38,7 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbplans.Insert(n.ToDB(r)); err != nil {
+	if err := Repository.Insert(r.Context(), n.ToDB(r)); err != nil {
 		handlers.ReturnError(w, err)
 		return
 	}
@@ -38,18 +49,20 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	var n incoming.Plan
 	if err := incoming.Extract(r, &n); err != nil {
 		handlers.StatusBadData(err, w)
+		return
 	}
 
-	if err := dbplans.Update(n.ToDB(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if err := Repository.Update(r.Context(), n.ToDB(r)); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusInserted(w)
 }
 
 func Delete(w http.ResponseWriter, r *http.Request) {
-	if err := dbplans.Delete(params.GetQueryParams(r)); err != nil {
+	if err := Repository.Delete(r.Context(), params.GetQueryParams(r)); err != nil {
 		handlers.ReturnError(w, err)
+		return
 	}
 	handlers.StatusDeleted(w)
 }
@@ -0,0 +1,97 @@
+package plans
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbmemory"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newStore(t *testing.T) *dbmemory.Store {
+	t.Helper()
+	ctx := context.Background()
+	store := dbmemory.New()
+	for _, domain := range []string{"d1", "d2"} {
+		if err := store.Domains().Insert(ctx, &dbdomains.DBStruct{Name: domain}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repository := Repository
+	Repository = store.Plans()
+	t.Cleanup(func() {
+		Repository = repository
+	})
+	return store
+}
+
+func serve(method, path, body string) (int, int) {
+	router := mux.NewRouter()
+	router.HandleFunc("/domains/{domainName}/plans", List).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/plans", Create).Methods(http.MethodPost)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}", Get).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}", Update).Methods(http.MethodPut)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}", Delete).Methods(http.MethodDelete)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var status handlers.Status
+	_ = json.NewDecoder(w.Body).Decode(&status)
+	return w.Code, status.Code
+}
+
+func planBody(name, domain string) string {
+	return `{"name":"` + name + `","domainName":"` + domain + `","type":"personal"}`
+}
+
+func TestPlanLifecycle(t *testing.T) {
+	newStore(t)
+	if _, code := serve(http.MethodPost, "/domains/d1/plans", planBody("basic", "d1")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, "/domains/d1/plans", planBody("extra", "d1")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, "/domains/d1/plans", planBody("basic", "d1")); code != http.StatusBadRequest {
+		t.Errorf("duplicate create: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if _, code := serve(http.MethodPost, "/domains/d2/plans", planBody("basic", "d2")); code != http.StatusOK {
+		t.Errorf("same name in another domain: code = %d", code)
+	}
+	if _, code := serve(http.MethodPut, "/domains/d1/plans/extra", planBody("basic", "d1")); code != http.StatusBadRequest {
+		t.Errorf("rename onto an existing plan: code = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	if _, code := serve(http.MethodDelete, "/domains/d1/plans/basic", ""); code != http.StatusOK {
+		t.Fatalf("delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d1/plans/basic", ""); code != http.StatusNotFound {
+		t.Errorf("disabled plan visible by default: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d1/plans/basic?disabled=true", ""); code != http.StatusOK {
+		t.Errorf("disabled plan hidden with disabled=true: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d2/plans/basic", ""); code != http.StatusOK {
+		t.Errorf("deleting a plan touched another domain: code = %d", code)
+	}
+}
+
+func TestPlanMissingParent(t *testing.T) {
+	newStore(t)
+	if code, _ := serve(http.MethodPost, "/domains/missing/plans", planBody("basic", "missing")); code != http.StatusNotFound {
+		t.Errorf("create in missing domain: code = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/missing/plans/basic", ""); code != http.StatusNotFound {
+		t.Errorf("get in missing domain: code = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := serve(http.MethodPut, "/domains/d1/plans/missing", planBody("basic", "d1")); code != http.StatusNotFound {
+		t.Errorf("update missing plan: code = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := serve(http.MethodDelete, "/domains/d1/plans/missing", ""); code != http.StatusNotFound {
+		t.Errorf("delete missing plan: code = %d, want %d", code, http.StatusNotFound)
+	}
+}
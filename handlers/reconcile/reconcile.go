@@ -0,0 +1,191 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"files-back/auth/directory"
+	"files-back/dbase/dbusers"
+	"files-back/handlers"
+	"files-back/handlers/params"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	FixNone      = ""
+	FixDirectory = "directory"
+	FixDatabase  = "database"
+	userDisabled = "disabled"
+	userDeleted  = "deleted"
+)
+
+var Directory = func(ctx context.Context, domain string) (*directory.Pool, error) {
+	return directory.DefaultPool()
+}
+
+var (
+	StoredUsers      = dbusers.QueryByDomain
+	ConfirmThreshold = 5
+)
+
+var (
+	BadFix               = errors.New("fix must be directory or database")
+	ProvisioningDisabled = errors.New("ldap provisioning is disabled")
+	SharedDirectory      = errors.New("domain has no directory of its own")
+	EmptyDirectory       = errors.New("directory search returned no users")
+	Unconfirmed          = errors.New("fix needs confirmation")
+)
+
+type Fix struct {
+	Email  string `json:"email"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Domain string `json:"domain"`
+	*directory.Drift
+	Fixed []Fix `json:"fixed"`
+}
+
+func Get(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	report, err := Run(r.Context(), *p.DomainName, FixNone, 0)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, report)
+}
+
+func Apply(w http.ResponseWriter, r *http.Request) {
+	p := params.GetQueryParams(r)
+	confirm, _ := strconv.Atoi(r.URL.Query().Get("confirm"))
+	report, err := Run(r.Context(), *p.DomainName, r.URL.Query().Get("fix"), confirm)
+	if err != nil {
+		if errors.Is(err, BadFix) || errors.Is(err, ProvisioningDisabled) || errors.Is(err, SharedDirectory) ||
+			errors.Is(err, EmptyDirectory) || errors.Is(err, Unconfirmed) {
+			handlers.StatusBadData(err, w)
+			return
+		}
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, report)
+}
+
+func Run(ctx context.Context, domainName, fix string, confirm int) (*Report, error) {
+	if fix != FixNone && fix != FixDirectory && fix != FixDatabase {
+		return nil, BadFix
+	}
+	if _, nop := directory.Provisioning.(directory.NopProvisioner); nop && fix == FixDirectory {
+		return nil, ProvisioningDisabled
+	}
+	stored, err := StoredUsers(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := Directory(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+	if fix == FixDatabase && pool.Config.Domain != domainName {
+		return nil, SharedDirectory
+	}
+	found, err := pool.SearchUsers("", "")
+	if err != nil {
+		return nil, err
+	}
+	if fix != FixNone && len(found) == 0 {
+		return nil, EmptyDirectory
+	}
+	accounts := make([]directory.Account, 0, len(stored))
+	deleted := make(map[string]bool)
+	for _, user := range stored {
+		account := directory.Account{Email: user.Email, Tenant: user.Tenant.Name}
+		if user.DisplayName != nil {
+			account.DisplayName = *user.DisplayName
+		}
+		if user.Type != nil {
+			account.Disabled = *user.Type == userDisabled || *user.Type == userDeleted
+			deleted[user.Email] = *user.Type == userDeleted
+		}
+		accounts = append(accounts, account)
+	}
+	report := Report{
+		Domain: domainName,
+		Drift:  directory.Reconcile(accounts, found),
+		Fixed:  []Fix{},
+	}
+	if changes := report.changes(fix); changes > ConfirmThreshold && confirm != changes {
+		return nil, fmt.Errorf("%w: fix would change %d users, pass confirm=%d", Unconfirmed, changes, changes)
+	}
+	switch fix {
+	case FixDirectory:
+		report.fixDirectory(deleted)
+	case FixDatabase:
+		report.fixDatabase(ctx)
+	}
+	return &report, nil
+}
+
+func (report *Report) changes(fix string) int {
+	switch fix {
+	case FixDirectory:
+		return len(report.Extra) + len(report.Mismatched) + len(report.DisabledButActive)
+	case FixDatabase:
+		return len(report.Extra) + len(report.Mismatched)
+	}
+	return 0
+}
+
+func (report *Report) fixDirectory(deleted map[string]bool) {
+	for _, entry := range report.Extra {
+		report.record(entry.Email, "create directory entry", directory.Provisioning.CreateUser(report.userEntry(entry)))
+	}
+	for _, mismatch := range report.Mismatched {
+		report.record(mismatch.Email, "update directory entry", directory.Provisioning.UpdateUser(directory.UserEntry{}, report.userEntry(mismatch.DriftEntry)))
+	}
+	for _, entry := range report.DisabledButActive {
+		if deleted[entry.Email] {
+			report.record(entry.Email, "delete directory entry", directory.Provisioning.DeleteUser(report.userEntry(entry)))
+			continue
+		}
+		report.record(entry.Email, "disable directory entry", directory.Provisioning.DisableUser(report.userEntry(entry)))
+	}
+}
+
+func (report *Report) fixDatabase(ctx context.Context) {
+	for _, mismatch := range report.Mismatched {
+		name := mismatch.Directory
+		report.record(mismatch.Email, "update display name", dbusers.SetDisplayName(ctx, &dbusers.DBStruct{
+			Email:       mismatch.Email,
+			DisplayName: &name,
+		}))
+	}
+	for _, entry := range report.Extra {
+		disabled := userDisabled
+		report.record(entry.Email, "disable user", dbusers.SetType(ctx, &dbusers.DBStruct{
+			Email: entry.Email,
+			Type:  &disabled,
+		}))
+	}
+}
+
+func (report *Report) record(email, action string, err error) {
+	fix := Fix{Email: email, Action: action}
+	if err != nil {
+		fix.Error = err.Error()
+	}
+	report.Fixed = append(report.Fixed, fix)
+}
+
+func (report *Report) userEntry(entry directory.DriftEntry) directory.UserEntry {
+	return directory.UserEntry{
+		Email:       entry.Email,
+		DisplayName: entry.Name,
+		Domain:      report.Domain,
+		Tenant:      entry.Tenant,
+	}
+}
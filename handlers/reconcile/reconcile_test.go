@@ -0,0 +1,120 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"files-back/auth/directory"
+	"files-back/auth/directory/ldaptest"
+	"files-back/dbase/dbtenants"
+	"files-back/dbase/dbusers"
+	"strconv"
+	"testing"
+)
+
+func withDirectory(t *testing.T, domain string, emails ...string) {
+	t.Helper()
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+	server.Add("dc=example,dc=com", map[string][]string{"objectClass": {"domain"}})
+	server.Add("cn=admin,dc=example,dc=com", map[string][]string{"cn": {"admin"}, "userPassword": {"secret"}})
+	for _, email := range emails {
+		server.Add("uid="+email+",dc=example,dc=com", map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"mail":        {email},
+			"displayName": {email},
+		})
+	}
+	pool, err := directory.NewPool(directory.Config{
+		Domain:        domain,
+		Servers:       []string{server.URL},
+		BindDN:        "cn=admin,dc=example,dc=com",
+		BindPassword:  "secret",
+		BaseDN:        "dc=example,dc=com",
+		ObjectClasses: []string{"inetOrgPerson"},
+		MailAttribute: "mail",
+		NameAttribute: "displayName",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	lookup := Directory
+	Directory = func(ctx context.Context, domain string) (*directory.Pool, error) {
+		return pool, nil
+	}
+	t.Cleanup(func() {
+		Directory = lookup
+	})
+}
+
+func withStoredUsers(t *testing.T, n int) {
+	stored := StoredUsers
+	StoredUsers = func(ctx context.Context, domainName string) ([]*dbusers.DBStruct, error) {
+		var users []*dbusers.DBStruct
+		for i := 0; i < n; i++ {
+			email := "user" + strconv.Itoa(i) + "@d1.com"
+			regular := "regular"
+			users = append(users, &dbusers.DBStruct{
+				Email:       email,
+				DisplayName: &email,
+				Type:        &regular,
+				Tenant:      &dbtenants.DBStruct{Name: "t1"},
+			})
+		}
+		return users, nil
+	}
+	t.Cleanup(func() {
+		StoredUsers = stored
+	})
+}
+
+func TestFixDatabaseNeedsDomainDirectory(t *testing.T) {
+	withStoredUsers(t, 2)
+	withDirectory(t, "", "user0@d1.com")
+	if _, err := Run(context.Background(), "d1", FixDatabase, 0); !errors.Is(err, SharedDirectory) {
+		t.Errorf("shared directory: err = %v, want SharedDirectory", err)
+	}
+	report, err := Run(context.Background(), "d1", FixNone, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Extra) != 1 || len(report.Fixed) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+type stubProvisioner struct {
+	directory.NopProvisioner
+}
+
+func TestFixRefusesEmptyDirectory(t *testing.T) {
+	withStoredUsers(t, 2)
+	withDirectory(t, "d1")
+	provisioning := directory.Provisioning
+	directory.Provisioning = stubProvisioner{}
+	defer func() {
+		directory.Provisioning = provisioning
+	}()
+	for _, fix := range []string{FixDatabase, FixDirectory} {
+		if _, err := Run(context.Background(), "d1", fix, 2); !errors.Is(err, EmptyDirectory) {
+			t.Errorf("%s: err = %v, want EmptyDirectory", fix, err)
+		}
+	}
+	report, err := Run(context.Background(), "d1", FixNone, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Extra) != 2 {
+		t.Errorf("extra = %d, want 2", len(report.Extra))
+	}
+}
+
+func TestFixNeedsConfirmation(t *testing.T) {
+	withStoredUsers(t, ConfirmThreshold+2)
+	withDirectory(t, "d1", "user0@d1.com")
+	for _, confirm := range []int{0, 1, ConfirmThreshold} {
+		if _, err := Run(context.Background(), "d1", FixDatabase, confirm); !errors.Is(err, Unconfirmed) {
+			t.Errorf("confirm=%d: err = %v, want Unconfirmed", confirm, err)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"files-back/dbase"
 	"github.com/jackc/pgx"
 	"log"
 	"net/http"
@@ -18,25 +20,34 @@ func ReturnError(w http.ResponseWriter, err error) {
 	var pgError *pgx.PgError
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
-		StatusDBNotFound(err, w)
-		return
-	case errors.As(err, &pgError):
-		switch pgError.Code {
-		case "42P01":
-			StatusDBError(err, w)
-			return
-		case "23505":
-			StatusDBAlreadyExist(err, w)
-			return
-		}
+		StatusNotFound(err, w)
+	case errors.Is(err, dbase.ErrBadCursor):
+		StatusBadData(err, w)
+	case errors.Is(err, context.DeadlineExceeded):
+		StatusDBTimeout(err, w)
+	case errors.Is(err, context.Canceled):
+		StatusDBUnavailable(err, w)
+	case errors.As(err, &pgError) && pgError.Code == "23505":
+		StatusDBAlreadyExist(err, w)
+	case errors.As(err, &pgError) && pgError.Code == "57014":
+		StatusDBTimeout(err, w)
 	default:
 		StatusDBError(err, w)
 	}
 }
 
+func responseStatus(w http.ResponseWriter, err error, resp Status) {
+	log.Println(err)
+	responseJSONCode(w, resp.Code, resp)
+}
+
 func ResponseJSON(w http.ResponseWriter, resp interface{}) {
+	responseJSONCode(w, http.StatusOK, resp)
+}
+
+func responseJSONCode(w http.ResponseWriter, code int, resp interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	err := json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		log.Println(err)
@@ -0,0 +1,52 @@
+package serviceaccounts
+
+import (
+	"database/sql"
+	"files-back/dbase/dbserviceaccounts"
+	"files-back/handlers"
+	"files-back/handlers/incoming"
+	"files-back/handlers/params"
+	"net/http"
+)
+
+func List(w http.ResponseWriter, r *http.Request) {
+	accounts, err := dbserviceaccounts.Query(r.Context(), params.GetQueryParams(r))
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, accounts)
+}
+
+func Get(w http.ResponseWriter, r *http.Request) {
+	accounts, err := dbserviceaccounts.Query(r.Context(), params.GetQueryParams(r))
+	switch {
+	case err != nil:
+		handlers.ReturnError(w, err)
+	case len(accounts.Items) == 0:
+		handlers.StatusNotFound(sql.ErrNoRows, w)
+	default:
+		handlers.ResponseJSON(w, accounts.Items[0])
+	}
+}
+
+func Create(w http.ResponseWriter, r *http.Request) {
+	var n incoming.ServiceAccount
+	if err := incoming.Extract(r, &n); err != nil {
+		handlers.StatusBadData(err, w)
+		return
+	}
+	if err := dbserviceaccounts.Insert(r.Context(), n.ToDB()); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.StatusInserted(w)
+}
+
+func Delete(w http.ResponseWriter, r *http.Request) {
+	if err := dbserviceaccounts.Delete(r.Context(), params.GetQueryParams(r)); err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.StatusDeleted(w)
+}
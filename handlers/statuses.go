@@ -44,8 +44,8 @@ func StatusDBAlreadyExist(err error, w http.ResponseWriter) {
 	})
 }
 
-func StatusDBNotFound(err error, w http.ResponseWriter) {
-	responseError(w, err, Status{
+func StatusNotFound(err error, w http.ResponseWriter) {
+	responseStatus(w, err, Status{
 		Code:    http.StatusNotFound,
 		Message: "Not found",
 	})
@@ -71,3 +71,59 @@ func StatusUnauthorized(err error, w http.ResponseWriter) {
 		Message: "Unauthorized",
 	})
 }
+
+func StatusForbidden(err error, w http.ResponseWriter) {
+	responseStatus(w, err, Status{
+		Code:    http.StatusForbidden,
+		Message: "Forbidden",
+	})
+}
+
+func StatusLoggedOut(w http.ResponseWriter) {
+	ResponseJSON(w, Status{
+		Code:    http.StatusOK,
+		Message: "Logged out",
+	})
+}
+
+func StatusTooManyRequests(err error, w http.ResponseWriter) {
+	responseStatus(w, err, Status{
+		Code:    http.StatusTooManyRequests,
+		Message: "Too many requests",
+	})
+}
+
+func StatusDirectoryError(err error, w http.ResponseWriter) {
+	responseStatus(w, err, Status{
+		Code:    http.StatusBadGateway,
+		Message: "Directory error",
+	})
+}
+
+func StatusPasswordChanged(w http.ResponseWriter) {
+	ResponseJSON(w, Status{
+		Code:    http.StatusOK,
+		Message: "Password changed",
+	})
+}
+
+func StatusResetRequested(w http.ResponseWriter) {
+	ResponseJSON(w, Status{
+		Code:    http.StatusOK,
+		Message: "Reset requested",
+	})
+}
+
+func StatusDBTimeout(err error, w http.ResponseWriter) {
+	responseStatus(w, err, Status{
+		Code:    http.StatusGatewayTimeout,
+		Message: "Database timeout",
+	})
+}
+
+func StatusDBUnavailable(err error, w http.ResponseWriter) {
+	responseStatus(w, err, Status{
+		Code:    http.StatusServiceUnavailable,
+		Message: "Request canceled",
+	})
+}
@@ -0,0 +1,111 @@
+package tariffs
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbmemory"
+	"files-back/dbase/dbplans"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newStore(t *testing.T) *dbmemory.Store {
+	t.Helper()
+	ctx := context.Background()
+	store := dbmemory.New()
+	domain := "d1"
+	steps := []error{
+		store.Domains().Insert(ctx, &dbdomains.DBStruct{Name: domain}),
+		store.Plans().Insert(ctx, &dbplans.DBStruct{Name: "p1", DomainName: &domain}),
+		store.Plans().Insert(ctx, &dbplans.DBStruct{Name: "p2", DomainName: &domain}),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	repository := Repository
+	Repository = store.Tariffs()
+	t.Cleanup(func() {
+		Repository = repository
+	})
+	return store
+}
+
+func serve(method, path, body string) (int, int) {
+	router := mux.NewRouter()
+	router.HandleFunc("/domains/{domainName}/plans/{planName}/tariffs", List).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}/tariffs", Create).Methods(http.MethodPost)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}/tariffs/{tariffName}", Get).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}/tariffs/{tariffName}", Update).Methods(http.MethodPut)
+	router.HandleFunc("/domains/{domainName}/plans/{planName}/tariffs/{tariffName}", Delete).Methods(http.MethodDelete)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var status handlers.Status
+	_ = json.NewDecoder(w.Body).Decode(&status)
+	return w.Code, status.Code
+}
+
+func tariffBody(name, plan string) string {
+	return `{"name":"` + name + `","planName":"` + plan + `","domainName":"d1","diskQuota":10,"price":5,"type":"personal","regularity":"monthly"}`
+}
+
+func TestTariffLifecycle(t *testing.T) {
+	newStore(t)
+	const p1 = "/domains/d1/plans/p1/tariffs"
+	if _, code := serve(http.MethodPost, p1, tariffBody("basic", "p1")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, p1, tariffBody("extra", "p1")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, p1, tariffBody("basic", "p1")); code != http.StatusBadRequest {
+		t.Errorf("duplicate create: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if _, code := serve(http.MethodPost, "/domains/d1/plans/p2/tariffs", tariffBody("basic", "p2")); code != http.StatusOK {
+		t.Errorf("same name in another plan: code = %d", code)
+	}
+	if _, code := serve(http.MethodPut, p1+"/extra", tariffBody("basic", "p1")); code != http.StatusBadRequest {
+		t.Errorf("rename onto an existing tariff: code = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	if _, code := serve(http.MethodDelete, p1+"/basic", ""); code != http.StatusOK {
+		t.Fatalf("delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, p1+"/basic", ""); code != http.StatusNotFound {
+		t.Errorf("disabled tariff visible by default: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, p1+"/basic?disabled=true", ""); code != http.StatusOK {
+		t.Errorf("disabled tariff hidden with disabled=true: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d1/plans/p2/tariffs/basic", ""); code != http.StatusOK {
+		t.Errorf("deleting a tariff touched another plan: code = %d", code)
+	}
+}
+
+func TestTariffMissingParent(t *testing.T) {
+	newStore(t)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/domains/missing/plans/p1/tariffs", tariffBody("basic", "p1")},
+		{http.MethodPost, "/domains/d1/plans/missing/tariffs", tariffBody("basic", "missing")},
+		{http.MethodGet, "/domains/d1/plans/missing/tariffs/basic", ""},
+		{http.MethodPut, "/domains/d1/plans/p1/tariffs/missing", tariffBody("basic", "p1")},
+		{http.MethodPut, "/domains/d1/plans/missing/tariffs/basic", tariffBody("basic", "missing")},
+		{http.MethodDelete, "/domains/d1/plans/p1/tariffs/missing", ""},
+		{http.MethodDelete, "/domains/missing/plans/p1/tariffs/basic", ""},
+	}
+	for _, test := range tests {
+		if code, _ := serve(test.method, test.path, test.body); code != http.StatusNotFound {
+			t.Errorf("%s %s: code = %d, want %d", test.method, test.path, code, http.StatusNotFound)
+		}
+	}
+}
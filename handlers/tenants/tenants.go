@@ -1,6 +1,7 @@
 package tenants
 
 import (
+	"database/sql"
 	"files-back/dbase/dbtenants"
 	"files-back/handlers"
 	"files-back/handlers/incoming"
@@ -8,16 +9,26 @@ import (
 	"net/http"
 )
 
-func Get(w http.ResponseWriter, r *http.Request) {
-	tenants, err := dbtenants.Query(params.GetQueryParams(r))
+var Repository dbtenants.Repository = dbtenants.SQLRepository{}
+
+func List(w http.ResponseWriter, r *http.Request) {
+	tenants, err := Repository.Query(r.Context(), params.GetQueryParams(r))
 	if err != nil {
-		handlers.StatusBadData(err, w)
+		handlers.ReturnError(w, err)
 		return
 	}
-	if len(tenants) == 1 {
-		handlers.ResponseJSON(w, tenants[0])
-	} else {
-		handlers.ResponseJSON(w, tenants)
+	handlers.ResponseJSON(w, tenants)
+}
+
+func Get(w http.ResponseWriter, r *http.Request) {
+	tenants, err := Repository.Query(r.Context(), params.GetQueryParams(r))
+	switch {
+	case err != nil:
+		handlers.ReturnError(w, err)
+	case len(tenants.Items) == 0:
+		handlers.StatusNotFound(sql.ErrNoRows, w)
+	default:
+		handlers.ResponseJSON(w, tenants.Items[0])
 	}
 }
 
@@ -27,7 +38,7 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbtenants.Insert(n.ToDB(r)); err != nil {
+	if err := Repository.Insert(r.Context(), n.ToDB(r)); err != nil {
 		handlers.ReturnError(w, err)
 		return
 	}
@@ -40,16 +51,16 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbtenants.Update(n.ToDB(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if err := Repository.Update(r.Context(), n.ToDB(r)); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusInserted(w)
 }
 
 func Delete(w http.ResponseWriter, r *http.Request) {
-	if err := dbtenants.Delete(params.GetQueryParams(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if err := Repository.Delete(r.Context(), params.GetQueryParams(r)); err != nil {
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusDeleted(w)
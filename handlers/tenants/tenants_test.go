@@ -0,0 +1,110 @@
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbmemory"
+	"files-back/dbase/dbplans"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newStore(t *testing.T) *dbmemory.Store {
+	t.Helper()
+	ctx := context.Background()
+	store := dbmemory.New()
+	for _, domain := range []string{"d1", "d2"} {
+		domain := domain
+		steps := []error{
+			store.Domains().Insert(ctx, &dbdomains.DBStruct{Name: domain}),
+			store.Plans().Insert(ctx, &dbplans.DBStruct{Name: "p1", DomainName: &domain}),
+		}
+		for _, err := range steps {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	repository := Repository
+	Repository = store.Tenants()
+	t.Cleanup(func() {
+		Repository = repository
+	})
+	return store
+}
+
+func serve(method, path, body string) (int, int) {
+	router := mux.NewRouter()
+	router.HandleFunc("/domains/{domainName}/tenants", List).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/tenants", Create).Methods(http.MethodPost)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}", Get).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}", Update).Methods(http.MethodPut)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}", Delete).Methods(http.MethodDelete)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var status handlers.Status
+	_ = json.NewDecoder(w.Body).Decode(&status)
+	return w.Code, status.Code
+}
+
+func tenantBody(name, plan string) string {
+	return `{"name":"` + name + `","organisation":"Org","orderForm":"form","orderLink":"https://order.example.com","type":"regular","planName":"` + plan + `"}`
+}
+
+func TestTenantLifecycle(t *testing.T) {
+	newStore(t)
+	const d1 = "/domains/d1/tenants"
+	if _, code := serve(http.MethodPost, d1, tenantBody("t1", "p1")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, d1, tenantBody("t2", "p1")); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if _, code := serve(http.MethodPost, d1, tenantBody("t1", "p1")); code != http.StatusBadRequest {
+		t.Errorf("duplicate create: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	if _, code := serve(http.MethodPost, "/domains/d2/tenants", tenantBody("t1", "p1")); code != http.StatusOK {
+		t.Errorf("same name in another domain: code = %d", code)
+	}
+	if _, code := serve(http.MethodPut, d1+"/t2", tenantBody("t1", "p1")); code != http.StatusBadRequest {
+		t.Errorf("rename onto an existing tenant: code = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	if _, code := serve(http.MethodDelete, d1+"/t1", ""); code != http.StatusOK {
+		t.Fatalf("delete: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, d1+"/t1", ""); code != http.StatusNotFound {
+		t.Errorf("disabled tenant visible by default: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, d1+"/t1?disabled=true", ""); code != http.StatusOK {
+		t.Errorf("disabled tenant hidden with disabled=true: code = %d", code)
+	}
+	if code, _ := serve(http.MethodGet, "/domains/d2/tenants/t1", ""); code != http.StatusOK {
+		t.Errorf("deleting a tenant touched another domain: code = %d", code)
+	}
+}
+
+func TestTenantMissingParent(t *testing.T) {
+	newStore(t)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/domains/missing/tenants", tenantBody("t1", "p1")},
+		{http.MethodPost, "/domains/d1/tenants", tenantBody("t1", "missing")},
+		{http.MethodGet, "/domains/missing/tenants/t1", ""},
+		{http.MethodPut, "/domains/d1/tenants/missing", tenantBody("t1", "p1")},
+		{http.MethodDelete, "/domains/d1/tenants/missing", ""},
+	}
+	for _, test := range tests {
+		if code, _ := serve(test.method, test.path, test.body); code != http.StatusNotFound {
+			t.Errorf("%s %s: code = %d, want %d", test.method, test.path, code, http.StatusNotFound)
+		}
+	}
+}
@@ -1,23 +1,39 @@
 package users
 
 import (
+	"database/sql"
+	"files-back/auth"
+	"files-back/auth/directory"
 	"files-back/dbase/dbusers"
 	"files-back/handlers"
 	"files-back/handlers/incoming"
 	"files-back/handlers/params"
+	"log"
 	"net/http"
 )
 
+const userDisabled = "disabled"
+
+var Repository dbusers.Repository = dbusers.SQLRepository{}
+
+func List(w http.ResponseWriter, r *http.Request) {
+	users, err := Repository.Query(r.Context(), params.GetQueryParams(r))
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return
+	}
+	handlers.ResponseJSON(w, users)
+}
+
 func Get(w http.ResponseWriter, r *http.Request) {
-	plans, err := dbusers.Query(params.GetQueryParams(r))
+	users, err := Repository.Query(r.Context(), params.GetQueryParams(r))
 	switch {
 	case err != nil:
-		handlers.StatusBadData(err, w)
-		return
-	case len(plans) == 1:
-		handlers.ResponseJSON(w, plans[0])
+		handlers.ReturnError(w, err)
+	case len(users.Items) == 0:
+		handlers.StatusNotFound(sql.ErrNoRows, w)
 	default:
-		handlers.ResponseJSON(w, plans)
+		handlers.ResponseJSON(w, users.Items[0])
 	}
 }
 
@@ -27,10 +43,21 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		handlers.StatusBadData(err, w)
 		return
 	}
-	if err := dbusers.Insert(n.ToDB(r)); err != nil {
+	if !assignable(w, r, n.Type) {
+		return
+	}
+	user := n.ToDB(r)
+	if err := Repository.Insert(r.Context(), user); err != nil {
 		handlers.ReturnError(w, err)
 		return
 	}
+	if err := directory.Provisioning.CreateUser(userEntry(user)); err != nil {
+		if pErr := Repository.Purge(r.Context(), user.Email); pErr != nil {
+			log.Printf("users: failed to remove %s after provisioning error: %v", user.Email, pErr)
+		}
+		handlers.StatusDirectoryError(err, w)
+		return
+	}
 	handlers.StatusInserted(w)
 }
 
@@ -38,25 +65,114 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	var n incoming.Users
 	if err := incoming.Extract(r, &n); err != nil {
 		handlers.StatusBadData(err, w)
+		return
 	}
-
-	if err := dbusers.Update(n.ToDB(r)); err != nil {
-		handlers.StatusBadData(err, w)
+	if !assignable(w, r, n.Type) {
+		return
+	}
+	current, ok := manageable(w, r)
+	if !ok {
+		return
+	}
+	if current == nil {
+		handlers.StatusNotFound(sql.ErrNoRows, w)
+		return
+	}
+	user := n.ToDB(r)
+	old := directory.UserEntry{Email: *current.Email, Domain: *current.Domain, Tenant: *current.Tenant, Disabled: disabled(current.Type)}
+	if current.DisplayName != nil {
+		old.DisplayName = *current.DisplayName
+	}
+	if err := directory.Provisioning.UpdateUser(old, userEntry(user)); err != nil {
+		handlers.StatusDirectoryError(err, w)
+		return
+	}
+	if err := Repository.Update(r.Context(), user); err != nil {
+		if pErr := directory.Provisioning.UpdateUser(userEntry(user), old); pErr != nil {
+			log.Printf("users: failed to restore directory entry %s: %v", old.Email, pErr)
+		}
+		handlers.ReturnError(w, err)
 		return
 	}
 	handlers.StatusInserted(w)
 }
 
 func Delete(w http.ResponseWriter, r *http.Request) {
-	if err := dbusers.Delete(params.GetQueryParams(r)); err != nil {
+	if _, ok := manageable(w, r); !ok {
+		return
+	}
+	p := params.GetQueryParams(r)
+	if err := Repository.Delete(r.Context(), p); err != nil {
 		handlers.ReturnError(w, err)
+		return
+	}
+	user := directory.UserEntry{
+		Email:  *p.Email,
+		Domain: *p.DomainName,
+		Tenant: *p.TenantName,
+	}
+	provision := directory.Provisioning.DisableUser
+	if *p.DeleteType == "deleted" {
+		provision = directory.Provisioning.DeleteUser
+	}
+	if err := provision(user); err != nil {
+		handlers.StatusDirectoryError(err, w)
+		return
 	}
 	handlers.StatusDeleted(w)
 }
 
 func Add(w http.ResponseWriter, r *http.Request) {
-	if err := dbusers.Delete(params.GetQueryParams(r)); err != nil {
+	if _, ok := manageable(w, r); !ok {
+		return
+	}
+	if err := Repository.Delete(r.Context(), params.GetQueryParams(r)); err != nil {
 		handlers.ReturnError(w, err)
+		return
 	}
 	handlers.StatusDeleted(w)
 }
+
+func assignable(w http.ResponseWriter, r *http.Request, role string) bool {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	if !auth.CanAssign(principal, role) {
+		handlers.StatusForbidden(auth.Forbidden, w)
+		return false
+	}
+	return true
+}
+
+func manageable(w http.ResponseWriter, r *http.Request) (*dbusers.JSONStruct, bool) {
+	p := params.GetQueryParams(r)
+	p.ShowDisabled, p.ShowDeleted = true, true
+	users, err := Repository.Query(r.Context(), p)
+	if err != nil {
+		handlers.ReturnError(w, err)
+		return nil, false
+	}
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	for _, user := range users.Items {
+		if user.Type != nil && !auth.CanManage(principal, *user.Type) {
+			handlers.StatusForbidden(auth.Forbidden, w)
+			return nil, false
+		}
+	}
+	if len(users.Items) == 0 {
+		return nil, true
+	}
+	return users.Items[0], true
+}
+
+func userEntry(user *dbusers.DBStruct) directory.UserEntry {
+	return directory.UserEntry{
+		Email:       user.Email,
+		DisplayName: *user.DisplayName,
+		Domain:      user.Domain.Name,
+		Tenant:      user.Tenant.Name,
+		Disabled:    disabled(user.Type),
+	}
+}
+
+func disabled(userType *string) bool {
+	return userType != nil && *userType == userDisabled
+}
@@ -0,0 +1,357 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"files-back/auth"
+	"files-back/auth/directory"
+	"files-back/auth/directory/ldaptest"
+	"files-back/dbase/dbdomains"
+	"files-back/dbase/dbmemory"
+	"files-back/dbase/dbplans"
+	"files-back/dbase/dbtariffs"
+	"files-back/dbase/dbtenants"
+	"files-back/dbase/dbusers"
+	"files-back/handlers"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newStore(t *testing.T) *dbmemory.Store {
+	t.Helper()
+	ctx := context.Background()
+	store := dbmemory.New()
+	domain, plan := "d1", "p1"
+	steps := []error{
+		store.Domains().Insert(ctx, &dbdomains.DBStruct{Name: domain}),
+		store.Plans().Insert(ctx, &dbplans.DBStruct{Name: plan, DomainName: &domain}),
+		store.Tariffs().Insert(ctx, &dbtariffs.DBStruct{
+			Name:   "basic",
+			Domain: &dbdomains.DBStruct{Name: domain},
+			Plan:   &dbplans.DBStruct{Name: plan},
+		}),
+		store.Tenants().Insert(ctx, &dbtenants.DBStruct{
+			Name:   "t1",
+			Domain: &dbdomains.DBStruct{Name: domain},
+			Plan:   &dbplans.DBStruct{Name: plan},
+		}),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	Repository = store.Users()
+	return store
+}
+
+func addUser(t *testing.T, email, role string) {
+	t.Helper()
+	name := email
+	err := Repository.Insert(context.Background(), &dbusers.DBStruct{
+		Email:       email,
+		DisplayName: &name,
+		Type:        &role,
+		Tariff:      &dbtariffs.DBStruct{Name: "basic"},
+		Tenant:      &dbtenants.DBStruct{Name: "t1"},
+		Domain:      &dbdomains.DBStruct{Name: "d1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withDirectory(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	server := ldaptest.NewServer()
+	t.Cleanup(server.Close)
+	server.Add("dc=example,dc=com", map[string][]string{"objectClass": {"domain"}})
+	server.Add("cn=admin,dc=example,dc=com", map[string][]string{"cn": {"admin"}, "userPassword": {"secret"}})
+	pool, err := directory.NewPool(directory.Config{
+		Servers:      []string{server.URL},
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "secret",
+		BaseDN:       "dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	provisioning := directory.Provisioning
+	directory.Provisioning = directory.NewLDAPProvisioner(func(string) (*directory.Pool, error) {
+		return pool, nil
+	})
+	t.Cleanup(func() {
+		directory.Provisioning = provisioning
+	})
+	return server
+}
+
+func serve(p *auth.Principal, method, path, body string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/users", List).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/users", Create).Methods(http.MethodPost)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/users/{email}", Get).Methods(http.MethodGet)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/users/{email}", Update).Methods(http.MethodPut)
+	router.HandleFunc("/domains/{domainName}/tenants/{tenantName}/users/{email}", Delete).Methods(http.MethodDelete)
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r = r.WithContext(auth.ContextWithPrincipal(r.Context(), p))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func userBody(email, role string) string {
+	return `{"email":"` + email + `","name":"Test","type":"` + role + `","tariff":"basic"}`
+}
+
+func TestCreateRoleCap(t *testing.T) {
+	tests := []struct {
+		caller string
+		role   string
+		code   int
+	}{
+		{auth.RoleTenantAdmin, auth.RoleRegular, http.StatusOK},
+		{auth.RoleTenantAdmin, auth.RoleTenantAdmin, http.StatusOK},
+		{auth.RoleTenantAdmin, auth.RoleDomainAdmin, http.StatusForbidden},
+		{auth.RoleTenantAdmin, auth.RoleFullAdmin, http.StatusForbidden},
+		{auth.RoleDomainAdmin, auth.RoleDomainAdmin, http.StatusOK},
+		{auth.RoleDomainAdmin, auth.RoleFullAdmin, http.StatusForbidden},
+		{auth.RoleFullAdmin, auth.RoleFullAdmin, http.StatusOK},
+	}
+	for _, test := range tests {
+		newStore(t)
+		caller := &auth.Principal{Username: "admin@d1", Type: test.caller, Domain: "d1", Tenant: "t1"}
+		w := serve(caller, http.MethodPost, "/domains/d1/tenants/t1/users", userBody("new@d1.com", test.role))
+		if w.Code != test.code {
+			t.Errorf("%s creating %s: code = %d, want %d", test.caller, test.role, w.Code, test.code)
+		}
+		created := serve(caller, http.MethodGet, "/domains/d1/tenants/t1/users/new@d1.com", "")
+		if exists := created.Code == http.StatusOK; exists != (test.code == http.StatusOK) {
+			t.Errorf("%s creating %s: user exists = %v", test.caller, test.role, exists)
+		}
+	}
+}
+
+func TestUpdateSelfEscalation(t *testing.T) {
+	newStore(t)
+	addUser(t, "tenant@d1.com", auth.RoleTenantAdmin)
+	caller := &auth.Principal{Username: "tenant@d1.com", Type: auth.RoleTenantAdmin, Domain: "d1", Tenant: "t1"}
+	w := serve(caller, http.MethodPut, "/domains/d1/tenants/t1/users/tenant@d1.com", userBody("tenant@d1.com", auth.RoleFullAdmin))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("self escalation: code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = serve(caller, http.MethodPut, "/domains/d1/tenants/t1/users/tenant@d1.com", userBody("tenant@d1.com", auth.RoleRegular))
+	if w.Code != http.StatusOK {
+		t.Fatalf("self demotion: code = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestManageHigherRole(t *testing.T) {
+	newStore(t)
+	addUser(t, "root@d1.com", auth.RoleFullAdmin)
+	caller := &auth.Principal{Username: "domain@d1.com", Type: auth.RoleDomainAdmin, Domain: "d1", Tenant: "t1"}
+	w := serve(caller, http.MethodPut, "/domains/d1/tenants/t1/users/root@d1.com", userBody("root@d1.com", auth.RoleRegular))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("demoting full admin: code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = serve(caller, http.MethodDelete, "/domains/d1/tenants/t1/users/root@d1.com", "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("deleting full admin: code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+const people = "ou=people,ou=t1,ou=d1,dc=example,dc=com"
+
+func TestCreateProvisions(t *testing.T) {
+	newStore(t)
+	server := withDirectory(t)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	w := serve(caller, http.MethodPost, "/domains/d1/tenants/t1/users", userBody("new@d1.com", auth.RoleRegular))
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: code = %d, body = %s", w.Code, w.Body)
+	}
+	if server.Entry("uid=new@d1.com,"+people) == nil {
+		t.Errorf("directory entry not created: %v", server.DNs())
+	}
+}
+
+func TestCreateProvisioningFailure(t *testing.T) {
+	newStore(t)
+	server := withDirectory(t)
+	server.Add("ou=d1,dc=example,dc=com", nil)
+	server.Add("ou=t1,ou=d1,dc=example,dc=com", nil)
+	server.Add(people, nil)
+	server.Add("uid=taken@d1.com,"+people, map[string][]string{"uid": {"taken@d1.com"}})
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	w := serve(caller, http.MethodPost, "/domains/d1/tenants/t1/users", userBody("taken@d1.com", auth.RoleRegular))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("create: code = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if w := serve(caller, http.MethodGet, "/domains/d1/tenants/t1/users/taken@d1.com", ""); w.Code != http.StatusNotFound {
+		t.Errorf("row left behind after provisioning failure: code = %d", w.Code)
+	}
+	w = serve(caller, http.MethodPost, "/domains/d1/tenants/t1/users", userBody("retry@d1.com", auth.RoleRegular))
+	if w.Code != http.StatusOK {
+		t.Errorf("create after failure: code = %d", w.Code)
+	}
+}
+
+func TestUpdateProvisioningFailure(t *testing.T) {
+	newStore(t)
+	withDirectory(t)
+	addUser(t, "user@d1.com", auth.RoleRegular)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	w := serve(caller, http.MethodPut, "/domains/d1/tenants/t1/users/user@d1.com", userBody("renamed@d1.com", auth.RoleRegular))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("update without directory entry: code = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if w := serve(caller, http.MethodGet, "/domains/d1/tenants/t1/users/user@d1.com", ""); w.Code != http.StatusOK {
+		t.Errorf("row changed despite provisioning failure: code = %d", w.Code)
+	}
+}
+
+func TestUpdateRestoresDirectory(t *testing.T) {
+	newStore(t)
+	server := withDirectory(t)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	if w := serve(caller, http.MethodPost, "/domains/d1/tenants/t1/users", userBody("user@d1.com", auth.RoleRegular)); w.Code != http.StatusOK {
+		t.Fatalf("create: code = %d", w.Code)
+	}
+	addUser(t, "other@d1.com", auth.RoleRegular)
+	w := serve(caller, http.MethodPut, "/domains/d1/tenants/t1/users/user@d1.com", userBody("other@d1.com", auth.RoleRegular))
+	var status handlers.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil || status.Code != http.StatusBadRequest {
+		t.Fatalf("rename onto an existing email: status = %+v, err = %v", status, err)
+	}
+	if server.Entry("uid=user@d1.com,"+people) == nil || server.Entry("uid=other@d1.com,"+people) != nil {
+		t.Errorf("directory not restored after database failure: %v", server.DNs())
+	}
+}
+
+func statusCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	var status handlers.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status.Code
+}
+
+func getUser(t *testing.T, caller *auth.Principal, path string) *dbusers.JSONStruct {
+	t.Helper()
+	w := serve(caller, http.MethodGet, path, "")
+	if w.Code != http.StatusOK {
+		return nil
+	}
+	var user dbusers.JSONStruct
+	if err := json.NewDecoder(w.Body).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestUserLifecycle(t *testing.T) {
+	newStore(t)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	const users = "/domains/d1/tenants/t1/users"
+	if code := statusCode(t, serve(caller, http.MethodPost, users, userBody("new@d1.com", auth.RoleRegular))); code != http.StatusOK {
+		t.Fatalf("create: code = %d", code)
+	}
+	if code := statusCode(t, serve(caller, http.MethodPost, users, userBody("new@d1.com", auth.RoleRegular))); code != http.StatusBadRequest {
+		t.Errorf("duplicate create: code = %d, want %d", code, http.StatusBadRequest)
+	}
+	user := getUser(t, caller, users+"/new@d1.com")
+	if user == nil || *user.DisplayName != "Test" || *user.Type != auth.RoleRegular || *user.Tenant != "t1" {
+		t.Fatalf("created user = %+v", user)
+	}
+
+	body := `{"email":"renamed@d1.com","name":"Renamed","type":"` + auth.RoleTenantAdmin + `","tariff":"basic"}`
+	if code := statusCode(t, serve(caller, http.MethodPut, users+"/new@d1.com", body)); code != http.StatusOK {
+		t.Fatalf("update: code = %d", code)
+	}
+	if getUser(t, caller, users+"/new@d1.com") != nil {
+		t.Error("old email still resolves after rename")
+	}
+	user = getUser(t, caller, users+"/renamed@d1.com")
+	if user == nil || *user.DisplayName != "Renamed" || *user.Type != auth.RoleTenantAdmin {
+		t.Fatalf("updated user = %+v", user)
+	}
+
+	if code := statusCode(t, serve(caller, http.MethodDelete, users+"/renamed@d1.com", "")); code != http.StatusOK {
+		t.Fatalf("disable: code = %d", code)
+	}
+	if getUser(t, caller, users+"/renamed@d1.com") != nil {
+		t.Error("disabled user listed by default")
+	}
+	user = getUser(t, caller, users+"/renamed@d1.com?disabled=true")
+	if user == nil || *user.Type != "disabled" {
+		t.Errorf("disabled user = %+v", user)
+	}
+	if code := statusCode(t, serve(caller, http.MethodDelete, users+"/renamed@d1.com?forced=true", "")); code != http.StatusOK {
+		t.Fatalf("delete: code = %d", code)
+	}
+	user = getUser(t, caller, users+"/renamed@d1.com?deleted=true")
+	if user == nil || *user.Type != "deleted" {
+		t.Errorf("deleted user = %+v", user)
+	}
+}
+
+func TestCreateUnknownTariff(t *testing.T) {
+	newStore(t)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	body := `{"email":"new@d1.com","name":"Test","type":"` + auth.RoleRegular + `","tariff":"gold"}`
+	if code := statusCode(t, serve(caller, http.MethodPost, "/domains/d1/tenants/t1/users", body)); code != http.StatusNotFound {
+		t.Errorf("unknown tariff: code = %d, want %d", code, http.StatusNotFound)
+	}
+	if getUser(t, caller, "/domains/d1/tenants/t1/users/new@d1.com") != nil {
+		t.Error("user created with an unknown tariff")
+	}
+}
+
+func TestUsersStayInTheirTenant(t *testing.T) {
+	store := newStore(t)
+	domain, plan := "d1", "p1"
+	err := store.Tenants().Insert(context.Background(), &dbtenants.DBStruct{
+		Name:   "t2",
+		Domain: &dbdomains.DBStruct{Name: domain},
+		Plan:   &dbplans.DBStruct{Name: plan},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addUser(t, "user@d1.com", auth.RoleRegular)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	const other = "/domains/d1/tenants/t2/users/user@d1.com"
+	if code := statusCode(t, serve(caller, http.MethodPut, other, userBody("user@d1.com", auth.RoleTenantAdmin))); code != http.StatusNotFound {
+		t.Errorf("update through another tenant: code = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := statusCode(t, serve(caller, http.MethodDelete, other, "")); code != http.StatusNotFound {
+		t.Errorf("delete through another tenant: code = %d, want %d", code, http.StatusNotFound)
+	}
+	user := getUser(t, caller, "/domains/d1/tenants/t1/users/user@d1.com")
+	if user == nil || *user.Type != auth.RoleRegular {
+		t.Errorf("user changed through another tenant: %+v", user)
+	}
+}
+
+func TestMissingUserNotFound(t *testing.T) {
+	newStore(t)
+	caller := &auth.Principal{Username: "admin@d1", Type: auth.RoleFullAdmin}
+	const missing = "/domains/d1/tenants/t1/users/missing@d1.com"
+	requests := []struct {
+		method, body string
+	}{
+		{http.MethodGet, ""},
+		{http.MethodPut, userBody("missing@d1.com", auth.RoleRegular)},
+		{http.MethodDelete, ""},
+	}
+	for _, request := range requests {
+		if w := serve(caller, request.method, missing, request.body); w.Code != http.StatusNotFound {
+			t.Errorf("%s missing user: status = %d, want %d", request.method, w.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"files-back/auth"
 	"files-back/auth/directory"
+	"files-back/auth/notify"
 	"files-back/dbase"
+	"files-back/dbase/migrations"
+	"files-back/handlers"
 	"files-back/handlers/domains"
 	"files-back/handlers/groups"
+	"files-back/handlers/imports"
 	"files-back/handlers/plans"
+	"files-back/handlers/reconcile"
+	"files-back/handlers/serviceaccounts"
 	"files-back/handlers/tariffs"
 	"files-back/handlers/tenants"
 	"files-back/handlers/users"
@@ -16,6 +23,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const defaultPort = "8080"
@@ -32,6 +44,17 @@ func main() {
 		port = defaultPort
 	}
 	auth.SecretKey = []byte(os.Getenv("SECRET"))
+	auth.KeyDir = os.Getenv("KEYDIR")
+	auth.ActiveKeyID = os.Getenv("SIGNINGKEY")
+	auth.TrustedProxies = envInt("TRUSTPROXY", 0)
+	if os.Getenv("TRUSTPROXY") == "true" {
+		auth.TrustedProxies = 1
+	}
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatal(err)
+	}
+	reloadKeysOnHangup()
+	go auth.SweepLimiters(time.Minute)
 
 	LDAPConnect()
 	DBConnect()
@@ -41,20 +64,101 @@ func main() {
 			log.Println(err)
 		}
 	}()
+	imports.Directory = domainDirectory
+	reconcile.Directory = domainDirectory
+	reconcile.ConfirmThreshold = envInt("RECONCILECONFIRM", reconcile.ConfirmThreshold)
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+	if os.Getenv("MIGRATEONSTART") == "true" {
+		applied, err := migrations.Up(context.Background(), dbase.DB)
+		logMigrations("applied", applied)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Panic(serve(":"+port, newRouter()))
+}
 
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(handlers.Timeout(envDuration("REQUESTTIMEOUT", 0)))
 	router.HandleFunc("/login", auth.Login).Methods(http.MethodGet)
+	router.HandleFunc("/login/2fa", auth.LoginSecondFactor).Methods(http.MethodPost)
+	router.HandleFunc("/token/refresh", auth.Refresh).Methods(http.MethodPost)
+	router.HandleFunc("/logout", auth.Logout).Methods(http.MethodPost)
+	router.HandleFunc("/.well-known/jwks.json", auth.JWKS).Methods(http.MethodGet)
+	oidcHandlers(router)
+	samlHandlers(router)
 	domainsHandlers(router)
 	plansHandlers(router)
 	tenantsHandlers(router)
 	groupsHandlers(router)
 	tariffsHandlers(router)
 	usersHandlers(router)
-	log.Panic(http.ListenAndServe(":"+port, router))
+	importHandlers(router)
+	reconcileHandlers(router)
+	tokensHandlers(router)
+	serviceAccountsHandlers(router)
+	lockoutsHandlers(router)
+	twoFactorHandlers(router)
+	impersonationHandlers(router)
+	sessionHandlers(router)
+	router.Handle("/me", auth.Authenticated(auth.Me(router))).Methods(http.MethodGet)
+	passwordHandlers(router)
+	return router
+}
+
+func serve(address string, handler http.Handler) error {
+	certFile, keyFile := os.Getenv("TLSCERT"), os.Getenv("TLSKEY")
+	if certFile == "" || keyFile == "" {
+		return http.ListenAndServe(address, handler)
+	}
+	tlsConfig, err := auth.ClientTLSConfig(os.Getenv("TLSCLIENTCA"))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:      address,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+func oidcHandlers(router *mux.Router) {
+	issuer := os.Getenv("OIDCISSUER")
+	if issuer == "" {
+		return
+	}
+	auth.OIDCBackend = &auth.OIDC{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDCCLIENTID"),
+		ClientSecret: os.Getenv("OIDCCLIENTSECRET"),
+		RedirectURL:  os.Getenv("OIDCREDIRECTURL"),
+	}
+	router.HandleFunc("/login/oidc", auth.OIDCBackend.Start).Methods(http.MethodGet)
+	router.Handle("/login/oidc/callback", auth.LoginWith(auth.OIDCBackend)).Methods(http.MethodGet)
+}
+
+func samlHandlers(router *mux.Router) {
+	entityID := os.Getenv("SAMLENTITYID")
+	if entityID == "" {
+		return
+	}
+	auth.SAMLBackend = &auth.SAML{
+		EntityID: entityID,
+		ACSURL:   os.Getenv("SAMLACSURL"),
+	}
+	router.HandleFunc("/saml/metadata", auth.SAMLBackend.Metadata).Methods(http.MethodGet)
+	router.HandleFunc("/login/saml", auth.SAMLBackend.Start).Methods(http.MethodGet)
+	router.Handle("/login/saml/acs", auth.LoginWith(auth.SAMLBackend)).Methods(http.MethodPost)
 }
 
 func domainsHandlers(router *mux.Router) {
-	router.Handle("/domains", auth.Middleware(http.HandlerFunc(domains.Get))).Methods(http.MethodGet)
+	router.Handle("/domains", auth.Middleware(http.HandlerFunc(domains.List))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}", auth.Middleware(http.HandlerFunc(domains.Get))).Methods(http.MethodGet)
 	router.Handle("/domains", auth.Middleware(http.HandlerFunc(domains.Create))).Methods(http.MethodPost)
 	router.Handle("/domains/{domainName}", auth.Middleware(http.HandlerFunc(domains.Update))).Methods(http.MethodPut)
@@ -62,8 +166,8 @@ func domainsHandlers(router *mux.Router) {
 }
 
 func plansHandlers(router *mux.Router) {
-	router.Handle("/plans", auth.Middleware(http.HandlerFunc(plans.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/plans", auth.Middleware(http.HandlerFunc(plans.Get))).Methods(http.MethodGet)
+	router.Handle("/plans", auth.Middleware(http.HandlerFunc(plans.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/plans", auth.Middleware(http.HandlerFunc(plans.List))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/plans/{planName}", auth.Middleware(http.HandlerFunc(plans.Get))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/plans", auth.Middleware(http.HandlerFunc(plans.Create))).Methods(http.MethodPost)
 	router.Handle("/domains/{domainName}/plans/{planName}", auth.Middleware(http.HandlerFunc(plans.Update))).Methods(http.MethodPut)
@@ -71,8 +175,8 @@ func plansHandlers(router *mux.Router) {
 }
 
 func tariffsHandlers(router *mux.Router) {
-	router.Handle("/tariffs", auth.Middleware(http.HandlerFunc(tariffs.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/plans/{planName}/tariffs", auth.Middleware(http.HandlerFunc(tariffs.Get))).Methods(http.MethodGet)
+	router.Handle("/tariffs", auth.Middleware(http.HandlerFunc(tariffs.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/plans/{planName}/tariffs", auth.Middleware(http.HandlerFunc(tariffs.List))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/plans/{planName}/tariffs/{tariffName}", auth.Middleware(http.HandlerFunc(tariffs.Get))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/plans/{planName}/tariffs", auth.Middleware(http.HandlerFunc(tariffs.Create))).Methods(http.MethodPost)
 	router.Handle("/domains/{domainName}/plans/{planName}/tariffs/{tariffName}", auth.Middleware(http.HandlerFunc(tariffs.Update))).Methods(http.MethodPut)
@@ -80,8 +184,8 @@ func tariffsHandlers(router *mux.Router) {
 }
 
 func tenantsHandlers(router *mux.Router) {
-	router.Handle("/tenants", auth.Middleware(http.HandlerFunc(tenants.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/tenants", auth.Middleware(http.HandlerFunc(tenants.Get))).Methods(http.MethodGet)
+	router.Handle("/tenants", auth.Middleware(http.HandlerFunc(tenants.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants", auth.Middleware(http.HandlerFunc(tenants.List))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/tenants", auth.Middleware(http.HandlerFunc(tenants.Create))).Methods(http.MethodPost)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}", auth.Middleware(http.HandlerFunc(tenants.Get))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}", auth.Middleware(http.HandlerFunc(tenants.Update))).Methods(http.MethodPut)
@@ -89,9 +193,9 @@ func tenantsHandlers(router *mux.Router) {
 }
 
 func usersHandlers(router *mux.Router) {
-	router.Handle("/users", auth.Middleware(http.HandlerFunc(users.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/tenants/{tenantName}/users", auth.Middleware(http.HandlerFunc(users.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/tenants/{tenantName}/users", auth.Middleware(http.HandlerFunc(users.Get))).Methods(http.MethodGet)
+	router.Handle("/users", auth.Middleware(http.HandlerFunc(users.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/users", auth.Middleware(http.HandlerFunc(users.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/users", auth.Middleware(http.HandlerFunc(users.List))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/users", auth.Middleware(http.HandlerFunc(users.Create))).Methods(http.MethodPost)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/users/{email}", auth.Middleware(http.HandlerFunc(users.Get))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/users/{email}", auth.Middleware(http.HandlerFunc(users.Update))).Methods(http.MethodPut)
@@ -100,9 +204,9 @@ func usersHandlers(router *mux.Router) {
 }
 
 func groupsHandlers(router *mux.Router) {
-	router.Handle("/groups", auth.Middleware(http.HandlerFunc(groups.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups", auth.Middleware(http.HandlerFunc(groups.Get))).Methods(http.MethodGet)
-	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups", auth.Middleware(http.HandlerFunc(groups.Get))).Methods(http.MethodGet)
+	router.Handle("/groups", auth.Middleware(http.HandlerFunc(groups.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups", auth.Middleware(http.HandlerFunc(groups.List))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups", auth.Middleware(http.HandlerFunc(groups.List))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups", auth.Middleware(http.HandlerFunc(groups.Create))).Methods(http.MethodPost)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups/{groupName}", auth.Middleware(http.HandlerFunc(groups.Get))).Methods(http.MethodGet)
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups/{groupName}", auth.Middleware(http.HandlerFunc(groups.Update))).Methods(http.MethodPut)
@@ -110,12 +214,106 @@ func groupsHandlers(router *mux.Router) {
 	router.Handle("/domains/{domainName}/tenants/{tenantName}/groups/{groupName}", auth.Middleware(http.HandlerFunc(groups.Add))).Methods(http.MethodPost)
 }
 
+func reloadKeysOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := auth.LoadKeys(); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+}
+
+func importHandlers(router *mux.Router) {
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/import", auth.Middleware(http.HandlerFunc(imports.Create))).Methods(http.MethodPost)
+}
+
+func reconcileHandlers(router *mux.Router) {
+	router.Handle("/domains/{domainName}/reconcile", auth.Middleware(http.HandlerFunc(reconcile.Get))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/reconcile", auth.Middleware(http.HandlerFunc(reconcile.Apply))).Methods(http.MethodPost)
+}
+
+func tokensHandlers(router *mux.Router) {
+	router.Handle("/tokens", auth.Authenticated(http.HandlerFunc(auth.ListAPITokens))).Methods(http.MethodGet)
+	router.Handle("/tokens", auth.Authenticated(http.HandlerFunc(auth.CreateAPIToken))).Methods(http.MethodPost)
+	router.Handle("/tokens/{tokenID}", auth.Authenticated(http.HandlerFunc(auth.RevokeAPIToken))).Methods(http.MethodDelete)
+}
+
+func serviceAccountsHandlers(router *mux.Router) {
+	router.Handle("/service-accounts", auth.Middleware(http.HandlerFunc(serviceaccounts.List))).Methods(http.MethodGet)
+	router.Handle("/service-accounts", auth.Middleware(http.HandlerFunc(serviceaccounts.Create))).Methods(http.MethodPost)
+	router.Handle("/service-accounts/{serviceAccountName}", auth.Middleware(http.HandlerFunc(serviceaccounts.Get))).Methods(http.MethodGet)
+	router.Handle("/service-accounts/{serviceAccountName}", auth.Middleware(http.HandlerFunc(serviceaccounts.Delete))).Methods(http.MethodDelete)
+}
+
+func lockoutsHandlers(router *mux.Router) {
+	router.Handle("/lockouts", auth.Middleware(http.HandlerFunc(auth.ListLockouts))).Methods(http.MethodGet)
+	router.Handle("/lockouts/{kind}/{key}", auth.Middleware(http.HandlerFunc(auth.ClearLockout))).Methods(http.MethodDelete)
+}
+
+func twoFactorHandlers(router *mux.Router) {
+	router.Handle("/2fa", auth.Authenticated(http.HandlerFunc(auth.EnrollTOTP))).Methods(http.MethodPost)
+	router.Handle("/2fa", auth.Authenticated(http.HandlerFunc(auth.DisableTOTP))).Methods(http.MethodDelete)
+	router.Handle("/2fa/verify", auth.Authenticated(http.HandlerFunc(auth.ConfirmTOTP))).Methods(http.MethodPost)
+}
+
+func passwordHandlers(router *mux.Router) {
+	auth.Passwords.MinLength = envInt("PASSWORDMINLENGTH", auth.Passwords.MinLength)
+	auth.Passwords.RequireSymbol = os.Getenv("PASSWORDSYMBOL") == "true"
+	auth.PasswordResetTTL = envDuration("PASSWORDRESETTTL", auth.PasswordResetTTL)
+	if resetURL := os.Getenv("PASSWORDRESETURL"); resetURL != "" {
+		auth.PasswordResetURL = resetURL
+	}
+	if address := os.Getenv("SMTPADDRESS"); address != "" {
+		auth.Notifier = &notify.SMTP{
+			Address:  address,
+			From:     os.Getenv("SMTPFROM"),
+			Username: os.Getenv("SMTPUSERNAME"),
+			Password: os.Getenv("SMTPPASSWORD"),
+		}
+	}
+	router.Handle("/me/password", auth.Authenticated(http.HandlerFunc(auth.ChangePassword))).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", auth.RequestPasswordReset).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset/confirm", auth.ConfirmPasswordReset).Methods(http.MethodPost)
+}
+
+func impersonationHandlers(router *mux.Router) {
+	auth.ImpersonationTTL = envDuration("IMPERSONATIONTTL", auth.ImpersonationTTL)
+	auth.AuditTimeout = envDuration("AUDITTIMEOUT", auth.AuditTimeout)
+	router.Handle("/impersonations", auth.Middleware(http.HandlerFunc(auth.ListImpersonations))).Methods(http.MethodGet)
+	router.Handle("/impersonations", auth.Middleware(http.HandlerFunc(auth.Impersonate))).Methods(http.MethodPost)
+	router.Handle("/impersonations/{sessionID}", auth.Middleware(http.HandlerFunc(auth.GetImpersonation))).Methods(http.MethodGet)
+	router.Handle("/impersonations/{sessionID}", auth.Middleware(http.HandlerFunc(auth.EndImpersonation))).Methods(http.MethodDelete)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/impersonations", auth.Middleware(http.HandlerFunc(auth.ListImpersonations))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/impersonations/{sessionID}", auth.Middleware(http.HandlerFunc(auth.GetImpersonation))).Methods(http.MethodGet)
+}
+
+func sessionHandlers(router *mux.Router) {
+	router.Handle("/me/sessions", auth.Authenticated(http.HandlerFunc(auth.ListMySessions))).Methods(http.MethodGet)
+	router.Handle("/me/sessions/{sessionID}", auth.Authenticated(http.HandlerFunc(auth.RevokeMySession))).Methods(http.MethodDelete)
+	router.Handle("/me/logins", auth.Authenticated(http.HandlerFunc(auth.ListMyLogins))).Methods(http.MethodGet)
+	router.Handle("/sessions", auth.Middleware(http.HandlerFunc(auth.ListSessions))).Methods(http.MethodGet)
+	router.Handle("/sessions/{sessionID}", auth.Middleware(http.HandlerFunc(auth.RevokeSession))).Methods(http.MethodDelete)
+	router.Handle("/domains/{domainName}/sessions", auth.Middleware(http.HandlerFunc(auth.ListSessions))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/sessions", auth.Middleware(http.HandlerFunc(auth.ListSessions))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/users/{email}/sessions", auth.Middleware(http.HandlerFunc(auth.ListSessions))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/users/{email}/sessions/{sessionID}", auth.Middleware(http.HandlerFunc(auth.RevokeSession))).Methods(http.MethodDelete)
+	router.Handle("/logins", auth.Middleware(http.HandlerFunc(auth.ListLogins))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/logins", auth.Middleware(http.HandlerFunc(auth.ListLogins))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/logins", auth.Middleware(http.HandlerFunc(auth.ListLogins))).Methods(http.MethodGet)
+	router.Handle("/domains/{domainName}/tenants/{tenantName}/users/{email}/logins", auth.Middleware(http.HandlerFunc(auth.ListLogins))).Methods(http.MethodGet)
+}
+
 func DBConnect() {
 	dbuser := os.Getenv("DBUSER")
 	dbpwd := os.Getenv("DBPWD")
 	dbname := os.Getenv("DB")
 	dbhost := os.Getenv("DBHOST")
 	dbport := os.Getenv("DBPORT")
+	dbase.StatementTimeout = envDuration("DBSTATEMENTTIMEOUT", dbase.StatementTimeout)
+	dbase.MaxLimit = envInt("DBMAXLIMIT", dbase.MaxLimit)
 	dbase.InitDB(dbuser, dbpwd, dbname, dbhost, dbport)
 }
 
@@ -124,4 +322,80 @@ func LDAPConnect() {
 	directory.LDAPUsername = os.Getenv("BINDUSERNAME")
 	directory.BaseDN = os.Getenv("BASEDN")
 	directory.LDAPServer = os.Getenv("BINDADDRESS")
+	directory.StartTLS = os.Getenv("LDAPSTARTTLS") != "false"
+	directory.CAFile = os.Getenv("LDAPCAFILE")
+	directory.ServerName = os.Getenv("LDAPSERVERNAME")
+	directory.InsecureSkipVerify = os.Getenv("LDAPINSECURE") == "true"
+	directory.ConnectTimeout = envDuration("LDAPCONNECTTIMEOUT", directory.ConnectTimeout)
+	directory.OperationTimeout = envDuration("LDAPTIMEOUT", directory.OperationTimeout)
+	directory.PoolSize = envInt("LDAPPOOLSIZE", directory.PoolSize)
+	if filter := os.Getenv("LDAPUSERFILTER"); filter != "" {
+		directory.UserFilter = filter
+	}
+	if classes := os.Getenv("LDAPOBJECTCLASSES"); classes != "" {
+		directory.ObjectClasses = strings.Split(classes, ",")
+	}
+	if attribute := os.Getenv("LDAPMAILATTR"); attribute != "" {
+		directory.MailAttribute = attribute
+	}
+	if attribute := os.Getenv("LDAPNAMEATTR"); attribute != "" {
+		directory.NameAttribute = attribute
+	}
+	if attribute := os.Getenv("LDAPGROUPATTR"); attribute != "" {
+		directory.GroupAttribute = attribute
+	}
+	directory.GroupBaseDN = os.Getenv("LDAPGROUPBASEDN")
+	directory.GroupFilter = os.Getenv("LDAPGROUPFILTER")
+	if attribute, ok := os.LookupEnv("LDAPDISABLEDATTR"); ok {
+		directory.DisabledAttribute = attribute
+	}
+	rules, err := directory.ParseRoleRules(os.Getenv("ROLEMAPPING"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	directory.RoleRules = rules
+	if err := directory.Connect(); err != nil {
+		log.Fatal(err)
+	}
+	if os.Getenv("LDAPPROVISION") == "true" {
+		provisioner := directory.NewLDAPProvisioner(func(domain string) (*directory.Pool, error) {
+			return domainDirectory(context.Background(), domain)
+		})
+		if layout := os.Getenv("LDAPUSEROU"); layout != "" {
+			provisioner.UserOU = layout
+		}
+		if layout := os.Getenv("LDAPGROUPOU"); layout != "" {
+			provisioner.GroupOU = layout
+		}
+		if attribute := os.Getenv("LDAPUSERRDN"); attribute != "" {
+			provisioner.UserRDN = attribute
+		}
+		if class := os.Getenv("LDAPGROUPCLASS"); class != "" {
+			provisioner.GroupClass = class
+		}
+		if member, ok := os.LookupEnv("LDAPGROUPMEMBER"); ok {
+			provisioner.GroupMember = member
+		}
+		directory.Provisioning = provisioner
+	}
+}
+
+func domainDirectory(ctx context.Context, domain string) (*directory.Pool, error) {
+	return auth.DomainDirectory(ctx, domain, "")
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
 }